@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"agent-samples/pkg/playbook"
+)
+
+func playbooksCommand(ctx context.Context, c *cli, args []string) error {
+	return subcommand(ctx, c, "playbooks", args, map[string]command{
+		"list": listPlaybooks,
+		"show": showPlaybook,
+	})
+}
+
+// listPlaybooks 按加载顺序列出运维方案
+func listPlaybooks(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("playbooks list", "playbooks list [--middle middleware]")
+	middle := fs.String("middle", "", "只列出指定中间件的方案")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	registry, err := playbook.LoadRegistry(c.playbookDir())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PLAYBOOK\tSTEPS\tTASK GOAL")
+	for _, book := range registry.List(*middle) {
+		steps := 0
+		book.Walk(func(path playbook.StepPath, step *playbook.Step) bool {
+			steps++
+			return true
+		})
+		fmt.Fprintf(w, "%s\t%d\t%s\n", playbook.Key(book.Middle, book.Name), steps, book.TaskGoal)
+	}
+	return w.Flush()
+}
+
+// showPlaybook 输出运维方案的步骤树，包括每个步骤的工具、依赖和结论
+func showPlaybook(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("playbooks show", "playbooks show <middleware>/<playbook>")
+	positional, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	book, err := c.findPlaybook(positional[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "方案名称: %s\n", playbook.Key(book.Middle, book.Name))
+	fmt.Fprintf(c.stdout, "方案目标: %s\n", book.TaskGoal)
+	if book.Models != (playbook.Models{}) {
+		fmt.Fprintf(c.stdout, "模型: tool=%s analysis=%s report=%s\n", book.Models.Tool, book.Models.Analysis, book.Models.Report)
+	}
+	if book.IsDAG() {
+		fmt.Fprintln(c.stdout, "执行方式: 按依赖关系并行")
+	}
+	book.Walk(func(path playbook.StepPath, step *playbook.Step) bool {
+		indent := strings.Repeat("  ", path.Depth())
+		fmt.Fprintf(c.stdout, "\n%s步骤%s: %s\n", indent, path, step.Name)
+		fmt.Fprintf(c.stdout, "%s  %s\n", indent, step.Details)
+		if len(step.ToolList) > 0 {
+			fmt.Fprintf(c.stdout, "%s  工具: %s\n", indent, step.GetToolNames())
+		}
+		if len(step.DependsOn) > 0 {
+			fmt.Fprintf(c.stdout, "%s  依赖: %s\n", indent, strings.Join(step.DependsOn, ","))
+		}
+		if step.Next != "" {
+			fmt.Fprintf(c.stdout, "%s  完成后进入: %s\n", indent, step.Next)
+		}
+		for _, outcome := range step.Outcomes {
+			switch {
+			case outcome.Stop:
+				fmt.Fprintf(c.stdout, "%s  - %s: 结束排查\n", indent, outcome.On)
+			case outcome.Next != "":
+				fmt.Fprintf(c.stdout, "%s  - %s: 进入%s\n", indent, outcome.On, outcome.Next)
+			default:
+				fmt.Fprintf(c.stdout, "%s  - %s\n", indent, outcome.On)
+			}
+		}
+		return true
+	})
+	return nil
+}
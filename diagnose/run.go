@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"agent-samples/pkg/checkpoint"
+	"agent-samples/pkg/model"
+	"agent-samples/pkg/samples/executor"
+	"agent-samples/pkg/tool"
+)
+
+// runCommand 执行运维方案，执行过程输出到标准错误，报告输出到标准输出或 --output 指定的文件
+// 遇到需要审批的工具调用时在终端询问是否批准
+func runCommand(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("run", "run <middleware>/<playbook> [--target node] [--set key=val]...")
+	target := fs.String("target", "", "诊断对象，如节点名称、Pod名称、实例地址")
+	inputs := keyValues{}
+	fs.Var(inputs, "set", "输入参数 key=val，可重复指定")
+	output := fs.String("output", "", "报告写入的文件，默认输出到标准输出")
+	checkpointDir := fs.String("checkpoints", "", "检查点目录，默认使用临时目录并在结束后删除")
+	verbose := fs.Bool("verbose", false, "输出模型的增量内容")
+	positional, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	book, err := c.findPlaybook(positional[0])
+	if err != nil {
+		return err
+	}
+	if err := c.initTools(); err != nil {
+		return err
+	}
+	defer tool.Close()
+	if err := model.Init(c.modelFile()); err != nil {
+		return err
+	}
+
+	dir := *checkpointDir
+	if dir == "" {
+		if dir, err = os.MkdirTemp("", "diagnose-checkpoints"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+	}
+	store, err := checkpoint.NewFileStore(dir)
+	if err != nil {
+		return err
+	}
+
+	// 注册表中的方案不修改，执行参数设置在副本上
+	b := *book
+	b.Target = *target
+	if len(inputs) > 0 {
+		b.Inputs = inputs
+	}
+	runner, err := executor.NewRunner(ctx, &b, store)
+	if err != nil {
+		return err
+	}
+
+	runID := checkpoint.NewRunID()
+	fmt.Fprintf(c.stderr, "开始执行 %s，执行id %s\n", positional[0], runID)
+	events := runner.RunEvents(ctx, runID)
+	for {
+		report, approvals, err := c.printEvents(ctx, events, *verbose)
+		if err != nil {
+			return err
+		}
+		if approvals == nil {
+			return c.writeReport(report, *output)
+		}
+		events = runner.ResumeEvents(ctx, runID, c.askApprovals(approvals))
+	}
+}
+
+// printEvents 输出执行过程，直到执行完成、失败或等待审批
+func (c *cli) printEvents(ctx context.Context, events <-chan executor.Event, verbose bool) (string, []*executor.ApprovalRequest, error) {
+	for ev := range events {
+		switch ev.Type {
+		case executor.EventStepStarted:
+			fmt.Fprintf(c.stderr, "\n== 步骤 %s %s ==\n", ev.Step.Path, ev.Step.Name)
+		case executor.EventStepFinished:
+			if ev.Step.Skipped {
+				fmt.Fprintf(c.stderr, "跳过步骤 %s %s\n", ev.Step.Path, ev.Step.Name)
+				continue
+			}
+			fmt.Fprintf(c.stderr, "\n步骤 %s 完成，状态：%s", ev.Step.Path, ev.Step.Status)
+			if ev.Step.Decision != "" {
+				fmt.Fprintf(c.stderr, "，%s", ev.Step.Decision)
+			}
+			fmt.Fprintln(c.stderr)
+		case executor.EventToolRequested:
+			fmt.Fprintf(c.stderr, "→ %s %s\n", ev.Tool.Name, ev.Tool.Arguments)
+		case executor.EventToolFinished:
+			if ev.Tool.Error != "" {
+				fmt.Fprintf(c.stderr, "← %s 失败（退出码 %d，耗时 %s）：%s\n", ev.Tool.Name, ev.Tool.ExitStatus, ev.Tool.Duration.Round(time.Millisecond), ev.Tool.Error)
+			} else {
+				fmt.Fprintf(c.stderr, "← %s 完成（耗时 %s）\n", ev.Tool.Name, ev.Tool.Duration.Round(time.Millisecond))
+			}
+		case executor.EventLLMDelta:
+			if verbose {
+				fmt.Fprint(c.stderr, ev.LLM.Delta)
+			}
+		case executor.EventInterrupted:
+			return "", ev.Approvals, nil
+		case executor.EventRunCompleted:
+			if ev.Model != "" {
+				fmt.Fprintf(c.stderr, "\n报告由模型 %s 生成\n", ev.Model)
+			}
+			return ev.Report, nil, nil
+		case executor.EventRunFailed:
+			return "", nil, errors.New(ev.Error)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	return "", nil, errors.New("执行意外结束")
+}
+
+// askApprovals 逐个询问待审批的工具调用，输入 y 批准，其他输入拒绝
+func (c *cli) askApprovals(requests []*executor.ApprovalRequest) map[string]executor.Decisions {
+	decisions := make(map[string]executor.Decisions, len(requests))
+	for _, req := range requests {
+		d := make(executor.Decisions, len(req.Calls))
+		for _, call := range req.Calls {
+			fmt.Fprintf(c.stderr, "\n工具 %s 需要审批，命令：\n  %s\n批准执行？[y/N] ", call.Tool, call.Command)
+			line, err := c.stdin.ReadString('\n')
+			if err != nil && line == "" {
+				// 没有可读取的输入时拒绝，避免在非交互环境中执行未经确认的命令
+				fmt.Fprintln(c.stderr)
+				line = "n"
+			}
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				d[call.CallID] = executor.Decision{Action: executor.ActionApprove}
+			default:
+				d[call.CallID] = executor.Decision{Action: executor.ActionDeny, Reason: "操作人拒绝执行"}
+			}
+		}
+		decisions[req.InterruptID] = d
+	}
+	return decisions
+}
+
+// writeReport 输出诊断报告，path 为空时输出到标准输出
+func (c *cli) writeReport(report, path string) error {
+	if path == "" {
+		fmt.Fprintln(c.stdout, report)
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(report), 0o644); err != nil {
+		return fmt.Errorf("写入报告失败: %w", err)
+	}
+	fmt.Fprintf(c.stderr, "\n报告已写入 %s\n", path)
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"agent-samples/pkg/secret"
+	"agent-samples/pkg/tool"
+	"agent-samples/pkg/tool/impl"
+
+	einotool "github.com/cloudwego/eino/components/tool"
+)
+
+func toolsCommand(ctx context.Context, c *cli, args []string) error {
+	return subcommand(ctx, c, "tools", args, map[string]command{
+		"list":     listTools,
+		"describe": describeTool,
+		"exec":     execTool,
+	})
+}
+
+// listTools 按名称列出所有启用的工具
+func listTools(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("tools list", "tools list")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if err := c.initTools(); err != nil {
+		return err
+	}
+	defer tool.Close()
+
+	tools := tool.GetToolMap()
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOOL\tDESCRIPTION")
+	for _, name := range sortedKeys(tools) {
+		info, err := tools[name].Info(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, info.Desc)
+	}
+	return w.Flush()
+}
+
+// describeTool 输出工具的描述、输出限制和参数的json schema
+func describeTool(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("tools describe", "tools describe <tool>")
+	positional, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.initTools(); err != nil {
+		return err
+	}
+	defer tool.Close()
+
+	t, err := lookupTool(positional[0])
+	if err != nil {
+		return err
+	}
+	info, err := t.Info(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "名称: %s\n描述: %s\n", info.Name, info.Desc)
+	if limiter, ok := t.(impl.OutputLimiter); ok {
+		if limit := limiter.OutputLimit(); limit.MaxTokens > 0 {
+			fmt.Fprintf(c.stdout, "输出限制: %d token，保留%s\n", limit.MaxTokens, limit.Keep)
+		}
+	}
+	if info.ParamsOneOf == nil {
+		return nil
+	}
+	params, err := info.ParamsOneOf.ToJSONSchema()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "参数:\n%s\n", data)
+	return nil
+}
+
+// execTool 按参数执行单个工具，输出经过与诊断执行相同的掩码和脱敏处理
+// 需要审批的调用先输出渲染后的命令，指定 --yes 后才会执行
+func execTool(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("tools exec", "tools exec <tool> [--set key=val]... [--args json] [--yes]")
+	values := keyValues{}
+	fs.Var(values, "set", "工具参数 key=val，可重复指定，按参数类型转换")
+	raw := fs.String("args", "", "json格式的工具参数，与 --set 同时指定时 --set 优先")
+	approved := fs.Bool("yes", false, "确认执行需要审批的命令")
+	positional, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.initTools(); err != nil {
+		return err
+	}
+	defer tool.Close()
+
+	name := positional[0]
+	t, err := lookupTool(name)
+	if err != nil {
+		return err
+	}
+	arguments, err := toolArguments(*raw, values)
+	if err != nil {
+		return err
+	}
+
+	if checker, ok := t.(impl.ApprovalChecker); ok {
+		approval, err := checker.CheckApproval(ctx, arguments)
+		if err != nil {
+			return err
+		}
+		if approval != nil && !*approved {
+			fmt.Fprintf(c.stderr, "命令：\n  %s\n", approval.Command)
+			return fmt.Errorf("工具 %s 需要审批，确认后使用 --yes 执行", name)
+		}
+	}
+
+	attempts := 0
+	out, err := t.InvokableRun(ctx, arguments, impl.WithAttempts(&attempts))
+	if attempts > 1 {
+		fmt.Fprintf(c.stderr, "重试 %d 次\n", attempts-1)
+	}
+	if err != nil {
+		msg, _ := tool.Redact(name, secret.Mask(err.Error()))
+		if status := impl.ExitStatus(err); status > 0 {
+			return fmt.Errorf("退出码 %d: %s", status, msg)
+		}
+		return errors.New(msg)
+	}
+	masked, stats := tool.Redact(name, secret.Mask(out))
+	fmt.Fprint(c.stdout, masked)
+	for rule, count := range stats {
+		fmt.Fprintf(c.stderr, "脱敏 %s: %d处\n", rule, count)
+	}
+	return nil
+}
+
+func lookupTool(name string) (einotool.InvokableTool, error) {
+	t := tool.GetTool(name)
+	if t == nil {
+		return nil, fmt.Errorf("工具不存在: %s", name)
+	}
+	return t, nil
+}
+
+// toolArguments 合并 --args 和 --set 指定的参数，生成工具调用的参数json
+func toolArguments(raw string, values keyValues) (string, error) {
+	args := make(map[string]any)
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &args); err != nil {
+			return "", fmt.Errorf("--args 格式错误: %w", err)
+		}
+	}
+	for k, v := range values {
+		args[k] = v
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"agent-samples/pkg/model"
+	"agent-samples/pkg/playbook"
+	"agent-samples/pkg/tool"
+)
+
+// validateCommand 校验工具、模型和运维方案配置，并检查方案引用的工具和模型是否存在
+// 只校验配置本身，不解析凭据引用，也不连接节点或模型服务
+func validateCommand(ctx context.Context, c *cli, args []string) error {
+	fs := c.flagSet("validate", "validate")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	failed := false
+	check := func(path string, err error) {
+		if err != nil {
+			failed = true
+			fmt.Fprintf(c.stdout, "FAIL %s: %s\n", path, strings.ReplaceAll(err.Error(), "\n", "\n     "))
+			return
+		}
+		fmt.Fprintf(c.stdout, "ok   %s\n", path)
+	}
+
+	toolErr := c.initTools()
+	defer tool.Close()
+	check(c.toolFile(), toolErr)
+	models, modelErr := model.LoadConfig(c.modelFile())
+	check(c.modelFile(), modelErr)
+	registry, err := playbook.LoadRegistry(c.playbookDir())
+	check(c.playbookDir(), err)
+
+	// 配置文件本身有错误时不再检查引用关系
+	if registry != nil {
+		for _, book := range registry.List("") {
+			var refErrs []error
+			if toolErr == nil {
+				refErrs = append(refErrs, checkTools(book)...)
+			}
+			if modelErr == nil {
+				refErrs = append(refErrs, checkModels(book, models)...)
+			}
+			check(playbook.Key(book.Middle, book.Name), errors.Join(refErrs...))
+		}
+	}
+
+	if failed {
+		return errors.New("配置校验失败")
+	}
+	return nil
+}
+
+// checkTools 检查方案中每个步骤引用的工具已在工具配置中启用
+func checkTools(book *playbook.PlayBook) []error {
+	var errs []error
+	book.Walk(func(path playbook.StepPath, step *playbook.Step) bool {
+		for _, name := range step.ToolList {
+			if tool.GetTool(name) == nil {
+				errs = append(errs, fmt.Errorf("步骤 %s 引用了不存在或未启用的工具: %s", path, name))
+			}
+		}
+		return true
+	})
+	return errs
+}
+
+// checkModels 检查方案按角色覆盖的模型在模型配置中存在
+func checkModels(book *playbook.PlayBook, cfg *model.Config) []error {
+	var errs []error
+	roles := []struct{ role, name string }{
+		{model.RoleTool, book.Models.Tool},
+		{model.RoleAnalysis, book.Models.Analysis},
+		{model.RoleReport, book.Models.Report},
+	}
+	for _, r := range roles {
+		if _, err := cfg.Resolve(r.role, r.name); err != nil {
+			errs = append(errs, fmt.Errorf("模型角色 %s: %w", r.role, err))
+		}
+	}
+	return errs
+}
@@ -1 +1,219 @@
 package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"agent-samples/pkg/playbook"
+	"agent-samples/pkg/tool"
+)
+
+// defaultConfigDir 默认的配置目录，目录结构与仓库中的 config/ 一致
+const defaultConfigDir = "config"
+
+const usage = `diagnose 运维诊断命令行工具
+
+用法：
+  diagnose [--config-dir dir] <命令> [参数]
+
+命令：
+  run <middleware>/<playbook>    执行运维方案，输出执行过程并生成诊断报告
+  playbooks list                 列出运维方案
+  playbooks show <middleware>/<playbook>
+                                 查看运维方案的步骤
+  tools list                     列出工具
+  tools describe <tool>          查看工具的描述和参数
+  tools exec <tool>              执行单个工具，用于测试执行模板
+  validate                       校验配置文件
+
+所有命令都支持 --config-dir 指定配置目录，默认为 config
+`
+
+// errUsage 命令行参数错误，已向标准错误输出说明
+var errUsage = errors.New("usage")
+
+// cli 命令的执行环境
+type cli struct {
+	configDir string
+	stdin     *bufio.Reader
+	stdout    io.Writer
+	stderr    io.Writer
+}
+
+// command 子命令，args 不含子命令名称
+type command func(ctx context.Context, c *cli, args []string) error
+
+var commands = map[string]command{
+	"run":       runCommand,
+	"playbooks": playbooksCommand,
+	"tools":     toolsCommand,
+	"validate":  validateCommand,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := execute(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// execute 执行命令并返回退出码：成功为0，执行失败为1，参数错误为2
+func execute(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: bufio.NewReader(stdin), stdout: stdout, stderr: stderr}
+	fs := flag.NewFlagSet("diagnose", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	fs.StringVar(&c.configDir, "config-dir", defaultConfigDir, "配置目录")
+	if err := fs.Parse(args); err != nil {
+		return exitCode(err)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "未知命令: %s\n\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+	err := cmd(ctx, c, fs.Args()[1:])
+	if err != nil && !errors.Is(err, errUsage) && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(stderr, "错误: %s\n", err)
+	}
+	return exitCode(err)
+}
+
+func exitCode(err error) int {
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	}
+	return 1
+}
+
+// flagSet 创建子命令的参数集合，所有子命令都可以通过 --config-dir 覆盖配置目录
+func (c *cli) flagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "用法：diagnose %s\n\n参数：\n", synopsis)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&c.configDir, "config-dir", c.configDir, "配置目录")
+	return fs
+}
+
+// parseFlags 解析子命令参数并返回位置参数，参数可以出现在位置参数之后，如 run kubectl/pods --target node-1
+func parseFlags(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+	var values []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		values = append(values, args[0])
+		args = args[1:]
+	}
+	if len(values) != positional {
+		fmt.Fprintf(fs.Output(), "需要%d个参数，实际为%d个\n", positional, len(values))
+		fs.Usage()
+		return nil, errUsage
+	}
+	return values, nil
+}
+
+// keyValues 可重复指定的 key=val 参数
+type keyValues map[string]string
+
+func (kv keyValues) String() string {
+	pairs := make([]string, 0, len(kv))
+	for k, v := range kv {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (kv keyValues) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("格式应为 key=val: %s", s)
+	}
+	kv[k] = v
+	return nil
+}
+
+func (c *cli) toolFile() string {
+	return filepath.Join(c.configDir, "tool", "tools.yaml")
+}
+
+func (c *cli) modelFile() string {
+	return filepath.Join(c.configDir, "model", "models.yaml")
+}
+
+func (c *cli) playbookDir() string {
+	return filepath.Join(c.configDir, "playbook")
+}
+
+// initTools 初始化工具，调用方需要在结束时调用 tool.Close
+func (c *cli) initTools() error {
+	return tool.InitTool(c.toolFile())
+}
+
+// findPlaybook 按 middleware/playbook 查找运维方案
+func (c *cli) findPlaybook(ref string) (*playbook.PlayBook, error) {
+	middle, name, ok := strings.Cut(ref, "/")
+	if !ok || middle == "" || name == "" {
+		return nil, fmt.Errorf("运维方案格式应为 <middleware>/<playbook>: %s", ref)
+	}
+	registry, err := playbook.LoadRegistry(c.playbookDir())
+	if err != nil {
+		return nil, err
+	}
+	book, ok := registry.Get(middle, name)
+	if !ok {
+		return nil, fmt.Errorf("运维方案不存在: %s", ref)
+	}
+	return book, nil
+}
+
+// subcommand 处理 playbooks、tools 这类带二级命令的命令
+func subcommand(ctx context.Context, c *cli, group string, args []string, subs map[string]command) error {
+	if len(args) == 0 {
+		fmt.Fprintf(c.stderr, "用法：diagnose %s <%s>\n", group, strings.Join(sortedKeys(subs), "|"))
+		return errUsage
+	}
+	sub, ok := subs[args[0]]
+	if !ok {
+		fmt.Fprintf(c.stderr, "未知命令: %s %s\n", group, args[0])
+		return errUsage
+	}
+	return sub(ctx, c, args[1:])
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTools = `
+local_tools:
+  - toolName: "shell"
+    authConfig:
+      type: "none"
+    execTemplates:
+      - name: "echo"
+        description: "回显"
+        exec: "echo {{.msg}}"
+        parameters:
+          - name: "msg"
+            required: true
+      - name: "restart_pod"
+        description: "重启Pod"
+        exec: "echo restarted {{.pod}}"
+        requires_approval: true
+        parameters:
+          - name: "pod"
+            required: true
+`
+
+const testModels = `
+providers:
+  - name: "local"
+    baseURL: "http://127.0.0.1:11434/v1"
+models:
+  - name: "qwen3"
+    provider: "local"
+    model: "qwen3"
+roles:
+  default: "qwen3"
+`
+
+const testPlaybooks = `
+playbooks:
+  - name: "pods"
+    task_goal: "检查Pod"
+    middle: "kubectl"
+    steps:
+      - name: "检查Pod"
+        details: "回显Pod状态"
+        tool_list: ["echo"]
+        outcomes:
+          - on: "Pod正常"
+            stop: true
+`
+
+// writeConfigDir 按 config/ 的目录结构写入测试配置
+func writeConfigDir(t *testing.T, playbooks string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		"tool/tools.yaml":    testTools,
+		"model/models.yaml":  testModels,
+		"playbook/pods.yaml": playbooks,
+	} {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return dir
+}
+
+func runCLI(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := execute(context.Background(), args, strings.NewReader(""), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestParseFlagsInterleaved(t *testing.T) {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	target := fs.String("target", "", "")
+	values := keyValues{}
+	fs.Var(values, "set", "")
+
+	positional, err := parseFlags(fs, []string{"--set", "a=1", "kubectl/pods", "--target", "node-1", "--set", "b=x=y"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kubectl/pods"}, positional)
+	assert.Equal(t, "node-1", *target)
+	assert.Equal(t, keyValues{"a": "1", "b": "x=y"}, values)
+
+	fs.SetOutput(&bytes.Buffer{})
+	_, err = parseFlags(fs, []string{"a", "b"}, 1)
+	assert.ErrorIs(t, err, errUsage)
+	_, err = parseFlags(fs, []string{"--set", "novalue", "a"}, 1)
+	assert.ErrorIs(t, err, errUsage)
+}
+
+func TestToolsExec(t *testing.T) {
+	dir := writeConfigDir(t, testPlaybooks)
+
+	code, stdout, _ := runCLI(t, "tools", "exec", "echo", "--config-dir", dir, "--set", "msg=hello")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "hello\n", stdout)
+
+	// 需要审批的命令只输出渲染后的命令，确认后才执行
+	code, stdout, stderr := runCLI(t, "--config-dir", dir, "tools", "exec", "restart_pod", "--args", `{"pod": "web-1"}`)
+	assert.Equal(t, 1, code)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "命令：\n  echo restarted web-1")
+	code, stdout, _ = runCLI(t, "--config-dir", dir, "tools", "exec", "restart_pod", "--args", `{"pod": "web-1"}`, "--yes")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "restarted web-1\n", stdout)
+
+	code, _, stderr = runCLI(t, "--config-dir", dir, "tools", "exec", "missing")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "工具不存在: missing")
+}
+
+func TestValidate(t *testing.T) {
+	code, stdout, _ := runCLI(t, "validate", "--config-dir", writeConfigDir(t, testPlaybooks))
+	assert.Equal(t, 0, code, stdout)
+	assert.Contains(t, stdout, "ok   kubectl/pods")
+
+	broken := strings.Replace(testPlaybooks, `tool_list: ["echo"]`, `tool_list: ["get_pods"]`, 1)
+	broken = strings.Replace(broken, `middle: "kubectl"`, "middle: \"kubectl\"\n    models:\n      report: \"gpt\"", 1)
+	code, stdout, _ = runCLI(t, "validate", "--config-dir", writeConfigDir(t, broken))
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "步骤 1 引用了不存在或未启用的工具: get_pods")
+	assert.Contains(t, stdout, "模型角色 report: 模型不存在: gpt")
+
+	// 工具模板构建失败时报告工具配置错误，而不是方案引用了不存在的工具
+	dir := writeConfigDir(t, testPlaybooks)
+	tools := strings.Replace(testTools, "            required: true\n", "            required: true\n            pattern: \"[a-z\"\n", 1)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tool/tools.yaml"), []byte(tools), 0o644))
+	code, stdout, _ = runCLI(t, "validate", "--config-dir", dir)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "FAIL "+filepath.Join(dir, "tool/tools.yaml")+": echo: parameter msg has invalid pattern")
+	assert.NotContains(t, stdout, "引用了不存在或未启用的工具")
+}
+
+func TestPlaybooksShow(t *testing.T) {
+	dir := writeConfigDir(t, testPlaybooks)
+
+	code, stdout, _ := runCLI(t, "--config-dir", dir, "playbooks", "list")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "kubectl/pods")
+
+	code, stdout, _ = runCLI(t, "--config-dir", dir, "playbooks", "show", "kubectl/pods")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "工具: echo")
+	assert.Contains(t, stdout, "- Pod正常: 结束排查")
+
+	code, _, _ = runCLI(t, "--config-dir", dir, "playbooks", "show", "pods")
+	assert.Equal(t, 1, code)
+	code, _, _ = runCLI(t, "--config-dir", dir, "playbooks")
+	assert.Equal(t, 2, code)
+}
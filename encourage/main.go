@@ -41,7 +41,10 @@ func main() {
 		},
 	})
 	ctx := context.TODO()
-	chatModel, err := model.OpenAI(ctx)
+	if err := model.Init("config/model/models.yaml"); err != nil {
+		panic(err.Error())
+	}
+	chatModel, err := model.ForRole(ctx, model.RoleDefault, "")
 	if err != nil {
 		panic(err.Error())
 	}
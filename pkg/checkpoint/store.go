@@ -0,0 +1,136 @@
+package checkpoint
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileExt 检查点文件的扩展名
+const fileExt = ".ckpt"
+
+// idPattern 检查点id只允许这些字符，避免通过id访问存储目录之外的文件
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// FileStore 基于文件的检查点存储，每个检查点保存为目录下的一个文件
+// 实现 compose.CheckPointStore，进程重启后仍可从检查点恢复执行
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore 创建文件检查点存储，目录不存在时自动创建
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create checkpoint dir %s: %w", dir, err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Get 读取检查点，不存在时 existed 为false
+func (s *FileStore) Get(ctx context.Context, id string) ([]byte, bool, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read checkpoint %s: %w", id, err)
+	}
+	return data, true, nil
+}
+
+// Set 保存检查点，先写入临时文件再重命名，写入过程中崩溃不会损坏已有的检查点
+func (s *FileStore) Set(ctx context.Context, id string, value []byte) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, id+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write checkpoint %s: %w", id, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write checkpoint %s: %w", id, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write checkpoint %s: %w", id, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write checkpoint %s: %w", id, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write checkpoint %s: %w", id, err)
+	}
+	return nil
+}
+
+// Delete 删除检查点，检查点不存在时不报错
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete checkpoint %s: %w", id, err)
+	}
+	return nil
+}
+
+// List 返回所有检查点的id，按id排序
+func (s *FileStore) List(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("list checkpoints: %w", err)
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileExt) {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(entry.Name(), fileExt))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	if !idPattern.MatchString(id) || strings.Trim(id, ".") == "" {
+		return "", fmt.Errorf("invalid checkpoint id %q", id)
+	}
+	return filepath.Join(s.dir, id+fileExt), nil
+}
+
+// NewRunID 生成执行id，以时间开头便于按时间排序，后缀随机避免冲突
+func NewRunID() string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
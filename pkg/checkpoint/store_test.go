@@ -0,0 +1,66 @@
+package checkpoint
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "checkpoints")
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	_, existed, err := store.Get(ctx, "run-1")
+	require.NoError(t, err)
+	assert.False(t, existed)
+
+	require.NoError(t, store.Set(ctx, "run-1", []byte("v1")))
+	require.NoError(t, store.Set(ctx, "run-1", []byte("v2")))
+	require.NoError(t, store.Set(ctx, "run-2", []byte("v1")))
+
+	// 重新打开目录后仍能读取
+	reopened, err := NewFileStore(dir)
+	require.NoError(t, err)
+	data, existed, err := reopened.Get(ctx, "run-1")
+	require.NoError(t, err)
+	assert.True(t, existed)
+	assert.Equal(t, "v2", string(data))
+
+	ids, err := reopened.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"run-1", "run-2"}, ids)
+
+	// 不会残留临时文件
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	require.NoError(t, reopened.Delete(ctx, "run-1"))
+	require.NoError(t, reopened.Delete(ctx, "run-1"))
+	_, existed, err = reopened.Get(ctx, "run-1")
+	require.NoError(t, err)
+	assert.False(t, existed)
+}
+
+func TestFileStoreRejectsInvalidID(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, id := range []string{"", "../escape", "a/b", ".."} {
+		_, _, err := store.Get(context.Background(), id)
+		assert.Error(t, err, id)
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	a, b := NewRunID(), NewRunID()
+	assert.NotEqual(t, a, b)
+	assert.Regexp(t, `^\d{8}-\d{6}-[0-9a-f]{8}$`, a)
+	assert.True(t, idPattern.MatchString(a))
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 模型角色，运维方案执行过程中不同阶段使用的模型
+const (
+	RoleDefault  = "default"  // 未单独配置的角色使用的模型
+	RoleTool     = "tool"     // 根据步骤目标选择并调用工具
+	RoleAnalysis = "analysis" // 分析单个步骤的工具调用结果
+	RoleReport   = "report"   // 汇总所有步骤生成诊断报告
+)
+
+// defaultTimeout 未配置超时时间时单次模型请求的超时时间
+const defaultTimeout = 120 * time.Second
+
+// Provider 模型服务提供方，使用 OpenAI 兼容接口
+type Provider struct {
+	Name    string `json:"name" yaml:"name"`
+	BaseURL string `json:"baseURL" yaml:"baseURL"`
+	APIKey  string `json:"apiKey" yaml:"apiKey"`   // API密钥，支持 ${env:VAR}、file:/path、keystore:name 引用
+	Timeout int    `json:"timeout" yaml:"timeout"` // 请求超时时间（秒），默认120秒
+}
+
+// ModelConfig 命名的模型配置
+type ModelConfig struct {
+	Name        string   `json:"name" yaml:"name"`                                   // 配置中引用模型使用的名称
+	Provider    string   `json:"provider" yaml:"provider"`                           // 提供方名称
+	Model       string   `json:"model" yaml:"model"`                                 // 提供方的模型标识
+	Temperature *float32 `json:"temperature,omitempty" yaml:"temperature,omitempty"` // 未设置时使用服务端默认值
+	MaxTokens   *int     `json:"maxTokens,omitempty" yaml:"maxTokens,omitempty"`     // 单次回复的最大token数
+	Timeout     int      `json:"timeout" yaml:"timeout"`                             // 请求超时时间（秒），未设置时使用提供方的超时时间
+	Fallbacks   []string `json:"fallbacks,omitempty" yaml:"fallbacks,omitempty"`     // 请求失败或熔断时按顺序使用的模型
+}
+
+// Config 模型配置文件结构
+type Config struct {
+	Providers []Provider        `json:"providers" yaml:"providers"`
+	Models    []ModelConfig     `json:"models" yaml:"models"`
+	Roles     map[string]string `json:"roles" yaml:"roles"`     // 角色使用的模型名称，未配置的角色使用default
+	Breaker   *BreakerConfig    `json:"breaker" yaml:"breaker"` // 模型熔断配置
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker // 按模型名称共享的熔断器，同一模型在不同回退链中的健康状态一致
+}
+
+// LoadConfig 从 yaml/json 文件加载模型配置
+func LoadConfig(path string) (*Config, error) {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json":
+	default:
+		return nil, fmt.Errorf("不支持的模型配置文件格式: %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取模型配置文件失败: %w", err)
+	}
+
+	cfg := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: 解析模型配置失败: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate 校验名称唯一，且模型和角色引用的配置存在
+func (c *Config) Validate() error {
+	providers := make(map[string]bool, len(c.Providers))
+	for _, p := range c.Providers {
+		switch {
+		case p.Name == "":
+			return errors.New("模型提供方缺少name")
+		case providers[p.Name]:
+			return fmt.Errorf("模型提供方重复定义: %s", p.Name)
+		case p.BaseURL == "":
+			return fmt.Errorf("模型提供方 %s 缺少baseURL", p.Name)
+		}
+		providers[p.Name] = true
+	}
+
+	models := make(map[string]bool, len(c.Models))
+	for _, m := range c.Models {
+		switch {
+		case m.Name == "":
+			return errors.New("模型缺少name")
+		case models[m.Name]:
+			return fmt.Errorf("模型重复定义: %s", m.Name)
+		case m.Model == "":
+			return fmt.Errorf("模型 %s 缺少model", m.Name)
+		case !providers[m.Provider]:
+			return fmt.Errorf("模型 %s 引用了不存在的提供方: %s", m.Name, m.Provider)
+		}
+		models[m.Name] = true
+	}
+	for _, m := range c.Models {
+		for _, fallback := range m.Fallbacks {
+			if fallback == m.Name {
+				return fmt.Errorf("模型 %s 不能回退到自身", m.Name)
+			}
+			if !models[fallback] {
+				return fmt.Errorf("模型 %s 回退到不存在的模型: %s", m.Name, fallback)
+			}
+		}
+	}
+
+	if _, ok := c.Roles[RoleDefault]; !ok {
+		return fmt.Errorf("roles 缺少 %s", RoleDefault)
+	}
+	for role, name := range c.Roles {
+		if !isRole(role) {
+			return fmt.Errorf("未知的模型角色: %s", role)
+		}
+		if !models[name] {
+			return fmt.Errorf("角色 %s 引用了不存在的模型: %s", role, name)
+		}
+	}
+	return nil
+}
+
+// Resolve 返回角色使用的模型名称，override 非空时优先使用
+func (c *Config) Resolve(role, override string) (string, error) {
+	if !isRole(role) {
+		return "", fmt.Errorf("未知的模型角色: %s", role)
+	}
+	name := override
+	if name == "" {
+		name = c.Roles[role]
+	}
+	if name == "" {
+		name = c.Roles[RoleDefault]
+	}
+	if _, _, err := c.lookup(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// lookup 按名称查找模型及其提供方
+func (c *Config) lookup(name string) (*ModelConfig, *Provider, error) {
+	for i := range c.Models {
+		m := &c.Models[i]
+		if m.Name != name {
+			continue
+		}
+		for j := range c.Providers {
+			if c.Providers[j].Name == m.Provider {
+				return m, &c.Providers[j], nil
+			}
+		}
+		return nil, nil, fmt.Errorf("模型 %s 引用了不存在的提供方: %s", name, m.Provider)
+	}
+	return nil, nil, fmt.Errorf("模型不存在: %s", name)
+}
+
+// breaker 获取模型的熔断器，不存在时创建
+func (c *Config) breaker(name string) *Breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.breakers == nil {
+		c.breakers = make(map[string]*Breaker)
+	}
+	b, ok := c.breakers[name]
+	if !ok {
+		b = NewBreaker(c.Breaker)
+		c.breakers[name] = b
+	}
+	return b
+}
+
+// timeout 模型配置的超时时间优先，其次使用提供方的超时时间
+func timeout(m *ModelConfig, p *Provider) time.Duration {
+	if m.Timeout > 0 {
+		return time.Duration(m.Timeout) * time.Second
+	}
+	if p.Timeout > 0 {
+		return time.Duration(p.Timeout) * time.Second
+	}
+	return defaultTimeout
+}
+
+func isRole(role string) bool {
+	switch role {
+	case RoleDefault, RoleTool, RoleAnalysis, RoleReport:
+		return true
+	}
+	return false
+}
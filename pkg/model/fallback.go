@@ -0,0 +1,230 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// BackendKey 回复消息的 Extra 中记录实际生成回复的模型名称
+const BackendKey = "model_backend"
+
+const (
+	defaultFailureThreshold = 3
+	defaultCooldown         = 30 * time.Second
+)
+
+// ErrNoBackendAvailable 所有模型均处于熔断状态，没有发起任何请求
+var ErrNoBackendAvailable = errors.New("所有模型均处于熔断状态")
+
+// BreakerConfig 模型熔断配置
+type BreakerConfig struct {
+	FailureThreshold int `json:"failureThreshold" yaml:"failureThreshold"` // 连续失败多少次后熔断，默认3次
+	Cooldown         int `json:"cooldown" yaml:"cooldown"`                 // 熔断持续时间（秒），之后放行一次试探请求，默认30秒
+}
+
+// Breaker 单个模型的熔断器，连续失败达到阈值后在冷却时间内跳过该模型
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// NewBreaker 创建熔断器，cfg 为nil或未设置的字段使用默认值
+func NewBreaker(cfg *BreakerConfig) *Breaker {
+	b := &Breaker{threshold: defaultFailureThreshold, cooldown: defaultCooldown, now: time.Now}
+	if cfg != nil && cfg.FailureThreshold > 0 {
+		b.threshold = cfg.FailureThreshold
+	}
+	if cfg != nil && cfg.Cooldown > 0 {
+		b.cooldown = time.Duration(cfg.Cooldown) * time.Second
+	}
+	return b
+}
+
+// allow 判断是否可以向模型发起请求
+// 冷却时间结束后只放行一次试探请求，试探失败时重新进入冷却
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+func (b *Breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+func (b *Breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// Open 熔断器是否处于熔断状态
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold && b.now().Before(b.openUntil)
+}
+
+// Backend 回退链中的一个模型
+type Backend struct {
+	Name    string
+	Model   model.ToolCallingChatModel
+	Breaker *Breaker // 同一模型的多个回退链共用熔断器，为nil时使用默认配置
+}
+
+// FallbackChatModel 按顺序尝试多个模型，请求失败或模型处于熔断状态时使用下一个模型
+// 流式调用只在建立流时回退，已经开始输出后的错误直接返回
+type FallbackChatModel struct {
+	backends []Backend
+}
+
+// NewFallbackChatModel 创建模型回退链，backends 按优先级排列
+func NewFallbackChatModel(backends ...Backend) (*FallbackChatModel, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("回退链中没有任何模型")
+	}
+	bs := make([]Backend, len(backends))
+	for i, b := range backends {
+		if b.Breaker == nil {
+			b.Breaker = NewBreaker(nil)
+		}
+		bs[i] = b
+	}
+	return &FallbackChatModel{backends: bs}, nil
+}
+
+// Generate 实现 model.BaseChatModel
+func (m *FallbackChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	var msg *schema.Message
+	err := m.try(ctx, func(b Backend) error {
+		out, err := b.Model.Generate(ctx, input, opts...)
+		if err != nil {
+			return err
+		}
+		msg = withBackend(out, b.Name)
+		return nil
+	})
+	return msg, err
+}
+
+// Stream 实现 model.BaseChatModel，模型名称记录在第一个消息块中，避免合并时重复拼接
+func (m *FallbackChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	var sr *schema.StreamReader[*schema.Message]
+	err := m.try(ctx, func(b Backend) error {
+		out, err := b.Model.Stream(ctx, input, opts...)
+		if err != nil {
+			return err
+		}
+		first := true
+		sr = schema.StreamReaderWithConvert(out, func(chunk *schema.Message) (*schema.Message, error) {
+			if first && chunk != nil {
+				first = false
+				return withBackend(chunk, b.Name), nil
+			}
+			return chunk, nil
+		})
+		return nil
+	})
+	return sr, err
+}
+
+// WithTools 实现 model.ToolCallingChatModel，为每个模型绑定工具，熔断状态与原回退链共享
+func (m *FallbackChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	bs := make([]Backend, len(m.backends))
+	for i, b := range m.backends {
+		bound, err := b.Model.WithTools(tools)
+		if err != nil {
+			return nil, fmt.Errorf("模型 %s 绑定工具失败: %w", b.Name, err)
+		}
+		bs[i] = Backend{Name: b.Name, Model: bound, Breaker: b.Breaker}
+	}
+	return &FallbackChatModel{backends: bs}, nil
+}
+
+// try 依次调用未熔断的模型直到成功，ctx 结束后不再尝试后续模型
+// 只有模型服务的故障计入熔断并回退，请求本身的错误直接返回
+func (m *FallbackChatModel) try(ctx context.Context, call func(b Backend) error) error {
+	var errs []string
+	tried := 0
+	for _, b := range m.backends {
+		if !b.Breaker.allow() {
+			errs = append(errs, fmt.Sprintf("%s: 熔断中", b.Name))
+			continue
+		}
+		tried++
+		err := call(b)
+		if err == nil {
+			b.Breaker.success()
+			return nil
+		}
+		if ctx.Err() != nil || !backendFailure(err) {
+			return err
+		}
+		b.Breaker.failure()
+		errs = append(errs, fmt.Sprintf("%s: %v", b.Name, err))
+	}
+
+	if tried == 0 {
+		return fmt.Errorf("%w: %s", ErrNoBackendAvailable, strings.Join(errs, "; "))
+	}
+	return fmt.Errorf("所有模型均调用失败: %s", strings.Join(errs, "; "))
+}
+
+// backendFailure 判断错误是否为模型服务的故障：网络错误、5xx和429
+// 其他4xx（如超出上下文长度、请求格式错误）换用其他模型通常同样失败，不应触发熔断
+func backendFailure(err error) bool {
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	status := apiErr.HTTPStatusCode
+	return status < 400 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// withBackend 在消息的 Extra 中记录模型名称
+func withBackend(msg *schema.Message, name string) *schema.Message {
+	if msg == nil {
+		return nil
+	}
+	if msg.Extra == nil {
+		msg.Extra = make(map[string]any)
+	}
+	msg.Extra[BackendKey] = name
+	return msg
+}
+
+// BackendOf 返回生成消息的模型名称，消息不是由回退链生成时返回空
+func BackendOf(msg *schema.Message) string {
+	if msg == nil {
+		return ""
+	}
+	name, _ := msg.Extra[BackendKey].(string)
+	return name
+}
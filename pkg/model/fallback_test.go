@@ -0,0 +1,230 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openAIStub OpenAI 兼容接口的替身，status 不为200时返回错误
+type openAIStub struct {
+	*httptest.Server
+	status atomic.Int32
+	calls  atomic.Int32
+	tools  atomic.Int32 // 最近一次请求携带的工具数量
+	auth   atomic.Value // 最近一次请求的认证头
+}
+
+func newOpenAIStub(t *testing.T, reply string) *openAIStub {
+	s := &openAIStub{}
+	s.status.Store(http.StatusOK)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.calls.Add(1)
+		s.auth.Store(r.Header.Get("Authorization"))
+		var req struct {
+			Stream bool              `json:"stream"`
+			Tools  []json.RawMessage `json:"tools"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		s.tools.Store(int32(len(req.Tools)))
+
+		if status := int(s.status.Load()); status != http.StatusOK {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"error":{"message":"rate limited","type":"rate_limit"}}`))
+			return
+		}
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(w, `data: {"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":"`+reply+`"}}]}`+"\n\n")
+			_, _ = io.WriteString(w, `data: {"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"!"},"finish_reason":"stop"}]}`+"\n\n")
+			_, _ = io.WriteString(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"1","object":"chat.completion","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"` + reply + `"}}]}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// fallbackConfig primary 回退到 secondary，连续失败2次后熔断
+func fallbackConfig(primary, secondary *openAIStub) *Config {
+	return &Config{
+		Providers: []Provider{
+			{Name: "hosted", BaseURL: primary.URL, Timeout: 5},
+			{Name: "local", BaseURL: secondary.URL, Timeout: 5},
+		},
+		Models: []ModelConfig{
+			{Name: "primary", Provider: "hosted", Model: "large", Fallbacks: []string{"secondary"}},
+			{Name: "secondary", Provider: "local", Model: "small"},
+		},
+		Roles:   map[string]string{RoleDefault: "primary"},
+		Breaker: &BreakerConfig{FailureThreshold: 2, Cooldown: 60},
+	}
+}
+
+func TestFallbackOnBackendFailure(t *testing.T) {
+	primary, secondary := newOpenAIStub(t, "from primary"), newOpenAIStub(t, "from secondary")
+	cfg := fallbackConfig(primary, secondary)
+	require.NoError(t, cfg.Validate())
+	ctx := context.Background()
+	input := []*schema.Message{schema.UserMessage("ping")}
+
+	cm, err := cfg.New(ctx, "primary")
+	require.NoError(t, err)
+	msg, err := cm.Generate(ctx, input)
+	require.NoError(t, err)
+	assert.Equal(t, "from primary", msg.Content)
+	assert.Equal(t, "primary", BackendOf(msg))
+
+	// 主模型被限流时使用回退模型，并记录实际使用的模型
+	primary.status.Store(http.StatusTooManyRequests)
+	msg, err = cm.Generate(ctx, input)
+	require.NoError(t, err)
+	assert.Equal(t, "from secondary", msg.Content)
+	assert.Equal(t, "secondary", BackendOf(msg))
+
+	// 连续失败达到阈值后熔断，不再请求主模型；熔断状态在同一配置创建的模型之间共享
+	_, err = cm.Generate(ctx, input)
+	require.NoError(t, err)
+	calls := primary.calls.Load()
+	another, err := cfg.New(ctx, "primary")
+	require.NoError(t, err)
+	msg, err = another.Generate(ctx, input)
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", BackendOf(msg))
+	assert.Equal(t, calls, primary.calls.Load())
+	assert.True(t, cfg.breaker("primary").Open())
+}
+
+func TestFallbackKeepsToolBindings(t *testing.T) {
+	primary, secondary := newOpenAIStub(t, "from primary"), newOpenAIStub(t, "from secondary")
+	primary.status.Store(http.StatusServiceUnavailable)
+	cfg := fallbackConfig(primary, secondary)
+	ctx := context.Background()
+
+	cm, err := cfg.New(ctx, "primary")
+	require.NoError(t, err)
+	bound, err := cm.WithTools([]*schema.ToolInfo{
+		{Name: "get_pods", Desc: "列出Pod"},
+		{Name: "get_nodes", Desc: "列出节点"},
+	})
+	require.NoError(t, err)
+
+	msg, err := bound.Generate(ctx, []*schema.Message{schema.UserMessage("ping")})
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", BackendOf(msg))
+	assert.Equal(t, int32(2), primary.tools.Load())
+	assert.Equal(t, int32(2), secondary.tools.Load())
+}
+
+func TestFallbackStream(t *testing.T) {
+	primary, secondary := newOpenAIStub(t, "from primary"), newOpenAIStub(t, "from secondary")
+	primary.status.Store(http.StatusBadGateway)
+	cfg := fallbackConfig(primary, secondary)
+	ctx := context.Background()
+
+	cm, err := cfg.New(ctx, "primary")
+	require.NoError(t, err)
+	sr, err := cm.Stream(ctx, []*schema.Message{schema.UserMessage("ping")})
+	require.NoError(t, err)
+	var chunks []*schema.Message
+	for {
+		chunk, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, chunk)
+	}
+	msg, err := schema.ConcatMessages(chunks)
+	require.NoError(t, err)
+	assert.Equal(t, "from secondary!", msg.Content)
+	assert.Equal(t, "secondary", BackendOf(msg), "模型名称只记录一次，合并后不会重复")
+}
+
+func TestFallbackAllBackendsFail(t *testing.T) {
+	primary, secondary := newOpenAIStub(t, "from primary"), newOpenAIStub(t, "from secondary")
+	primary.status.Store(http.StatusServiceUnavailable)
+	secondary.status.Store(http.StatusServiceUnavailable)
+	cfg := fallbackConfig(primary, secondary)
+	ctx := context.Background()
+
+	cm, err := cfg.New(ctx, "primary")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = cm.Generate(ctx, []*schema.Message{schema.UserMessage("ping")})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "所有模型均调用失败")
+		assert.Contains(t, err.Error(), "primary:")
+		assert.Contains(t, err.Error(), "secondary:")
+	}
+
+	_, err = cm.Generate(ctx, []*schema.Message{schema.UserMessage("ping")})
+	assert.ErrorIs(t, err, ErrNoBackendAvailable)
+}
+
+func TestFallbackSkipsRequestErrors(t *testing.T) {
+	primary, secondary := newOpenAIStub(t, "from primary"), newOpenAIStub(t, "from secondary")
+	primary.status.Store(http.StatusBadRequest)
+	cfg := fallbackConfig(primary, secondary)
+	ctx := context.Background()
+
+	// 请求本身的错误不回退，也不计入熔断
+	cm, err := cfg.New(ctx, "primary")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = cm.Generate(ctx, []*schema.Message{schema.UserMessage("ping")})
+		require.Error(t, err)
+	}
+	assert.Zero(t, secondary.calls.Load())
+	assert.False(t, cfg.breaker("primary").Open())
+
+	assert.True(t, backendFailure(errors.New("connection refused")))
+	assert.True(t, backendFailure(&openai.APIError{HTTPStatusCode: http.StatusBadGateway}))
+	assert.True(t, backendFailure(&openai.APIError{HTTPStatusCode: http.StatusTooManyRequests}))
+	assert.False(t, backendFailure(fmt.Errorf("wrap: %w", &openai.APIError{HTTPStatusCode: http.StatusBadRequest})))
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(&BreakerConfig{FailureThreshold: 1, Cooldown: 10})
+	b.now = func() time.Time { return now }
+
+	require.True(t, b.allow())
+	b.failure()
+	assert.True(t, b.Open())
+	assert.False(t, b.allow())
+
+	// 冷却结束后只放行一次试探请求
+	now = now.Add(11 * time.Second)
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+	b.success()
+	assert.False(t, b.Open())
+	assert.True(t, b.allow())
+}
+
+func TestValidateFallbacks(t *testing.T) {
+	cfg := &Config{
+		Providers: []Provider{{Name: "local", BaseURL: "http://127.0.0.1"}},
+		Models:    []ModelConfig{{Name: "m", Provider: "local", Model: "qwen3", Fallbacks: []string{"other"}}},
+		Roles:     map[string]string{RoleDefault: "m"},
+	}
+	assert.ErrorContains(t, cfg.Validate(), "回退到不存在的模型: other")
+	cfg.Models[0].Fallbacks = []string{"m"}
+	assert.ErrorContains(t, cfg.Validate(), "不能回退到自身")
+}
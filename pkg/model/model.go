@@ -0,0 +1,133 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"agent-samples/pkg/secret"
+
+	"github.com/bytedance/gopkg/util/logger"
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+)
+
+var (
+	mu     sync.RWMutex
+	config *Config
+)
+
+// Init 从配置文件初始化全局模型配置
+func Init(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	SetConfig(cfg)
+	return nil
+}
+
+// SetConfig 替换全局模型配置，配置需要已通过校验
+func SetConfig(cfg *Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	config = cfg
+}
+
+// GetConfig 获取全局模型配置，未初始化时返回nil
+func GetConfig() *Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return config
+}
+
+// ForRole 创建角色使用的模型，override 为运维方案中配置的模型名称，为空时使用全局配置
+func ForRole(ctx context.Context, role, override string) (model.ToolCallingChatModel, error) {
+	cfg := GetConfig()
+	if cfg == nil {
+		return nil, errors.New("模型配置未初始化")
+	}
+	name, err := cfg.Resolve(role, override)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.New(ctx, name)
+}
+
+// New 按名称创建模型，配置了fallbacks时返回按顺序回退的模型链
+// 回退模型自身配置的fallbacks不会展开，每个模型的熔断器在同一配置中共享
+// 无法创建的模型不加入回退链，所有模型都无法创建时返回错误
+func (c *Config) New(ctx context.Context, name string) (model.ToolCallingChatModel, error) {
+	m, _, err := c.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	names := append([]string{name}, m.Fallbacks...)
+	backends := make([]Backend, 0, len(names))
+	var errs []error
+	for _, n := range names {
+		cm, err := c.newChatModel(ctx, n)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		backends = append(backends, Backend{Name: n, Model: cm, Breaker: c.breaker(n)})
+	}
+	if len(backends) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		logger.Errorf("skip model backend: %s", err)
+	}
+	return NewFallbackChatModel(backends...)
+}
+
+// newChatModel 创建单个模型，API密钥在每次请求时才解析
+func (c *Config) newChatModel(ctx context.Context, name string) (model.ToolCallingChatModel, error) {
+	m, p, err := c.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cm, err := openai.NewChatModel(ctx, &openai.ChatModelConfig{
+		BaseURL:     p.BaseURL,
+		Model:       m.Model,
+		Temperature: m.Temperature,
+		MaxTokens:   m.MaxTokens,
+		HTTPClient: &http.Client{
+			Timeout:   timeout(m, p),
+			Transport: &apiKeyTransport{model: name, ref: p.APIKey, base: http.DefaultTransport},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("模型 %s: %w", name, err)
+	}
+	return cm, nil
+}
+
+// apiKeyTransport 每次请求时解析API密钥并设置认证头，环境变量、文件或keystore中的密钥轮换后无需重启
+// 密钥无法解析时请求失败，与连接失败一样会回退到下一个模型
+type apiKeyTransport struct {
+	model string
+	ref   string
+	base  http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	apiKey, err := secret.Resolve(t.ref)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("模型 %s: %w", t.model, err)
+	}
+	if apiKey != "" {
+		// 明文配置的密钥同样不能出现在输出中
+		secret.Register(apiKey)
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return t.base.RoundTrip(req)
+}
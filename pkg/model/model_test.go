@@ -0,0 +1,196 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "models.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadConfigFromConfigDir(t *testing.T) {
+	cfg, err := LoadConfig("../../config/model/models.yaml")
+	require.NoError(t, err)
+
+	for _, role := range []string{RoleDefault, RoleTool, RoleAnalysis, RoleReport} {
+		name, err := cfg.Resolve(role, "")
+		require.NoError(t, err)
+		assert.NotEmpty(t, name)
+	}
+}
+
+func TestResolveRole(t *testing.T) {
+	cfg := &Config{
+		Providers: []Provider{{Name: "local", BaseURL: "http://127.0.0.1:11434/v1"}},
+		Models:    []ModelConfig{{Name: "small", Provider: "local", Model: "qwen3"}, {Name: "large", Provider: "local", Model: "qwen3:32b"}},
+		Roles:     map[string]string{RoleDefault: "small", RoleReport: "large"},
+	}
+	require.NoError(t, cfg.Validate())
+
+	name, err := cfg.Resolve(RoleTool, "")
+	require.NoError(t, err)
+	assert.Equal(t, "small", name, "未配置的角色使用default")
+	name, err = cfg.Resolve(RoleReport, "")
+	require.NoError(t, err)
+	assert.Equal(t, "large", name)
+	name, err = cfg.Resolve(RoleTool, "large")
+	require.NoError(t, err)
+	assert.Equal(t, "large", name, "运维方案的配置优先")
+
+	_, err = cfg.Resolve(RoleTool, "missing")
+	assert.ErrorContains(t, err, "模型不存在: missing")
+	_, err = cfg.Resolve("summary", "")
+	assert.ErrorContains(t, err, "未知的模型角色")
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	cases := map[string]struct {
+		content string
+		err     string
+	}{
+		"unknown provider": {`
+providers: [{name: local, baseURL: "http://127.0.0.1"}]
+models: [{name: m, provider: remote, model: qwen3}]
+roles: {default: m}
+`, "引用了不存在的提供方: remote"},
+		"missing default": {`
+providers: [{name: local, baseURL: "http://127.0.0.1"}]
+models: [{name: m, provider: local, model: qwen3}]
+roles: {tool: m}
+`, "roles 缺少 default"},
+		"unknown role": {`
+providers: [{name: local, baseURL: "http://127.0.0.1"}]
+models: [{name: m, provider: local, model: qwen3}]
+roles: {default: m, summary: m}
+`, "未知的模型角色: summary"},
+		"unknown model": {`
+providers: [{name: local, baseURL: "http://127.0.0.1"}]
+models: [{name: m, provider: local, model: qwen3}]
+roles: {default: other}
+`, "引用了不存在的模型: other"},
+		"duplicate model": {`
+providers: [{name: local, baseURL: "http://127.0.0.1"}]
+models: [{name: m, provider: local, model: qwen3}, {name: m, provider: local, model: qwen3}]
+roles: {default: m}
+`, "模型重复定义: m"},
+		"unknown field": {`
+providers: [{name: local, baseURL: "http://127.0.0.1", apikey: x}]
+`, "field apikey not found"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, c.content))
+			assert.ErrorContains(t, err, c.err)
+		})
+	}
+}
+
+func TestForRoleUsesModelConfig(t *testing.T) {
+	var req struct {
+		Model       string   `json:"model"`
+		Temperature *float32 `json:"temperature"`
+		MaxTokens   *int     `json:"max_tokens"`
+	}
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"1","object":"chat.completion","model":"qwen3:32b",` +
+			`"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"pong"}}]}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("TEST_MODEL_API_KEY", "sk-test-model-key")
+	require.NoError(t, Init(writeConfig(t, `
+providers:
+  - name: local
+    baseURL: "`+srv.URL+`"
+    apiKey: "${env:TEST_MODEL_API_KEY}"
+models:
+  - {name: small, provider: local, model: qwen3}
+  - {name: large, provider: local, model: "qwen3:32b", temperature: 0.1, maxTokens: 512}
+roles:
+  default: small
+`)))
+	t.Cleanup(func() { SetConfig(nil) })
+
+	cm, err := ForRole(context.Background(), RoleReport, "large")
+	require.NoError(t, err)
+	msg, err := cm.Generate(context.Background(), []*schema.Message{schema.UserMessage("ping")})
+	require.NoError(t, err)
+	assert.Equal(t, "pong", msg.Content)
+
+	assert.Equal(t, "Bearer sk-test-model-key", auth)
+	assert.Equal(t, "qwen3:32b", req.Model)
+	require.NotNil(t, req.Temperature)
+	assert.InDelta(t, 0.1, *req.Temperature, 1e-6)
+	require.NotNil(t, req.MaxTokens)
+	assert.Equal(t, 512, *req.MaxTokens)
+}
+
+func TestAPIKeyResolvedPerRequest(t *testing.T) {
+	hosted := newOpenAIStub(t, "from hosted")
+	local := newOpenAIStub(t, "from local")
+	cfg := &Config{
+		Providers: []Provider{
+			{Name: "hosted", BaseURL: hosted.URL, APIKey: "${env:TEST_ROTATED_MODEL_KEY}"},
+			{Name: "local", BaseURL: local.URL},
+		},
+		Models: []ModelConfig{
+			{Name: "remote", Provider: "hosted", Model: "large", Fallbacks: []string{"qwen3"}},
+			{Name: "qwen3", Provider: "local", Model: "qwen3"},
+		},
+		Roles: map[string]string{RoleDefault: "qwen3"},
+	}
+	require.NoError(t, cfg.Validate())
+	ping := []*schema.Message{schema.UserMessage("ping")}
+
+	// 密钥未配置时也能创建模型，调用时回退到本地模型
+	cm, err := cfg.New(context.Background(), "remote")
+	require.NoError(t, err)
+	msg, err := cm.Generate(context.Background(), ping)
+	require.NoError(t, err)
+	assert.Equal(t, "qwen3", BackendOf(msg))
+	assert.Zero(t, hosted.calls.Load())
+	assert.Empty(t, local.auth.Load())
+
+	// 配置或轮换密钥后无需重新创建模型
+	t.Setenv("TEST_ROTATED_MODEL_KEY", "sk-test-first-key")
+	cm, err = cfg.New(context.Background(), "remote")
+	require.NoError(t, err)
+	msg, err = cm.Generate(context.Background(), ping)
+	require.NoError(t, err)
+	assert.Equal(t, "remote", BackendOf(msg))
+	assert.Equal(t, "Bearer sk-test-first-key", hosted.auth.Load())
+	t.Setenv("TEST_ROTATED_MODEL_KEY", "sk-test-second-key")
+	_, err = cm.Generate(context.Background(), ping)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer sk-test-second-key", hosted.auth.Load())
+
+	cfg.Models[0].Fallbacks = nil
+	cm, err = cfg.New(context.Background(), "remote")
+	require.NoError(t, err)
+	os.Unsetenv("TEST_ROTATED_MODEL_KEY")
+	_, err = cm.Generate(context.Background(), ping)
+	assert.ErrorContains(t, err, "模型 remote: secret env TEST_ROTATED_MODEL_KEY is not set")
+}
+
+func TestForRoleWithoutConfig(t *testing.T) {
+	SetConfig(nil)
+	_, err := ForRole(context.Background(), RoleTool, "")
+	assert.ErrorContains(t, err, "模型配置未初始化")
+}
@@ -0,0 +1,156 @@
+package playbook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 步骤分析结果的状态
+const (
+	StatusOK           = "ok"           // 未发现异常
+	StatusWarn         = "warn"         // 存在需要关注的问题
+	StatusCritical     = "critical"     // 存在严重问题
+	StatusInconclusive = "inconclusive" // 信息不足，无法判断
+)
+
+// trailingComma 匹配对象和数组末尾多余的逗号，模型输出的json中较常见
+var trailingComma = regexp.MustCompile(`,\s*([}\]])`)
+
+// Finding 分析发现的问题或需要关注的指标
+type Finding struct {
+	Summary  string   `json:"summary"`
+	Evidence []string `json:"evidence"` // 工具输出中支持该发现的原文摘录
+}
+
+// Entity 分析中涉及的具体对象，如Pod、节点、数据表
+type Entity struct {
+	Kind string `json:"kind"` // 对象类型，如 pod、node、namespace、table
+	Name string `json:"name"`
+}
+
+// Analysis 分析模型对单个步骤给出的结构化结果
+type Analysis struct {
+	Status     string    `json:"status"`
+	Summary    string    `json:"summary"`
+	Findings   []Finding `json:"findings,omitempty"`
+	Entities   []Entity  `json:"entities,omitempty"`
+	NextAction string    `json:"next_action,omitempty"` // 建议的下一步操作
+	Outcome    int       `json:"outcome"`               // 选择的结论序号，从1开始，0表示未匹配任何结论
+	Reason     string    `json:"reason,omitempty"`      // 选择结论的理由
+	Invalid    string    `json:"invalid,omitempty"`     // 模型输出无法解析的原因，此时 Summary 为模型的原始输出
+}
+
+// ParseAnalysis 从模型输出中解析结构化分析结果，outcomes 为步骤可选结论的数量
+// 兼容代码块包裹、json前后的说明文字和多余的逗号，解析或校验失败时返回的错误可直接提供给模型修正
+func ParseAnalysis(content string, outcomes int) (*Analysis, error) {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("输出中没有json对象")
+	}
+	raw := trailingComma.ReplaceAllString(content[start:end+1], "$1")
+
+	a := &Analysis{}
+	if err := json.Unmarshal([]byte(raw), a); err != nil {
+		return nil, fmt.Errorf("json格式错误: %w", err)
+	}
+	if err := a.validate(outcomes); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Analysis) validate(outcomes int) error {
+	a.Status = strings.ToLower(strings.TrimSpace(a.Status))
+	switch a.Status {
+	case StatusOK, StatusWarn, StatusCritical, StatusInconclusive:
+	default:
+		return fmt.Errorf("status必须是 %s、%s、%s、%s 之一，实际为%q", StatusOK, StatusWarn, StatusCritical, StatusInconclusive, a.Status)
+	}
+	if strings.TrimSpace(a.Summary) == "" {
+		return errors.New("缺少summary")
+	}
+	if (a.Status == StatusWarn || a.Status == StatusCritical) && len(a.Findings) == 0 {
+		return fmt.Errorf("status为%s时findings不能为空", a.Status)
+	}
+	for i, f := range a.Findings {
+		if strings.TrimSpace(f.Summary) == "" {
+			return fmt.Errorf("findings[%d]缺少summary", i)
+		}
+		if len(f.Evidence) == 0 {
+			return fmt.Errorf("findings[%d]缺少evidence", i)
+		}
+	}
+	for i, e := range a.Entities {
+		if e.Kind == "" || e.Name == "" {
+			return fmt.Errorf("entities[%d]缺少kind或name", i)
+		}
+	}
+	if a.Outcome < 0 || a.Outcome > outcomes {
+		return fmt.Errorf("outcome超出范围，可选值为0~%d", outcomes)
+	}
+	return nil
+}
+
+// FallbackAnalysis 模型多次输出均无法解析时，保留原始输出作为分析内容，结论仍尝试从末尾的json中提取
+func FallbackAnalysis(content string, err error) *Analysis {
+	summary, verdict := ParseVerdict(content)
+	a := &Analysis{Status: StatusInconclusive, Summary: summary, Invalid: err.Error()}
+	if verdict != nil {
+		a.Outcome = verdict.Outcome
+		a.Reason = verdict.Reason
+	}
+	return a
+}
+
+// Verdict 分析结果中的步骤结论
+func (a *Analysis) Verdict() *Verdict {
+	if a == nil {
+		return nil
+	}
+	return &Verdict{Outcome: a.Outcome, Reason: a.Reason}
+}
+
+// Format 将分析结果整理为文本，作为执行记录的结果进入后续步骤和报告的提示词
+func (a *Analysis) Format() string {
+	return a.format(true)
+}
+
+// Brief 不含证据原文的分析摘要，执行记录超出上下文预算时代替完整结果
+func (a *Analysis) Brief() string {
+	return a.format(false)
+}
+
+func (a *Analysis) format(evidence bool) string {
+	if a.Invalid != "" {
+		return a.Summary
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "状态：%s\n%s\n", a.Status, a.Summary)
+	if len(a.Findings) > 0 {
+		b.WriteString("发现：\n")
+		for i, f := range a.Findings {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, f.Summary)
+			if !evidence {
+				continue
+			}
+			for _, e := range f.Evidence {
+				fmt.Fprintf(&b, "   > %s\n", e)
+			}
+		}
+	}
+	if len(a.Entities) > 0 {
+		entities := make([]string, 0, len(a.Entities))
+		for _, e := range a.Entities {
+			entities = append(entities, e.Kind+"/"+e.Name)
+		}
+		fmt.Fprintf(&b, "涉及对象：%s\n", strings.Join(entities, "、"))
+	}
+	if a.NextAction != "" {
+		fmt.Fprintf(&b, "建议：%s\n", a.NextAction)
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,55 @@
+package playbook
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAnalysis(t *testing.T) {
+	content := "分析如下：\n```json\n" + `{
+  "status": "Critical",
+  "summary": "web-1 反复重启",
+  "findings": [{"summary": "容器OOM", "evidence": ["OOMKilled", "Restart Count: 7"],},],
+  "entities": [{"kind": "pod", "name": "web-1"}],
+  "next_action": "查看内存限制",
+  "outcome": 2,
+  "reason": "存在异常Pod"
+}` + "\n```"
+	a, err := ParseAnalysis(content, 2)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCritical, a.Status)
+	assert.Equal(t, []Finding{{Summary: "容器OOM", Evidence: []string{"OOMKilled", "Restart Count: 7"}}}, a.Findings)
+	assert.Equal(t, []Entity{{Kind: "pod", Name: "web-1"}}, a.Entities)
+	assert.Equal(t, &Verdict{Outcome: 2, Reason: "存在异常Pod"}, a.Verdict())
+	assert.Equal(t, "状态：critical\nweb-1 反复重启\n发现：\n1. 容器OOM\n   > OOMKilled\n   > Restart Count: 7\n涉及对象：pod/web-1\n建议：查看内存限制", a.Format())
+	assert.Equal(t, "状态：critical\nweb-1 反复重启\n发现：\n1. 容器OOM\n涉及对象：pod/web-1\n建议：查看内存限制", a.Brief())
+}
+
+func TestParseAnalysisInvalid(t *testing.T) {
+	cases := map[string]string{
+		"所有Pod正常":                              "输出中没有json对象",
+		`{"status": "ok", "summary": "正常"`:     "输出中没有json对象",
+		`{"status": "ok" "summary": "正常"}`:     "json格式错误",
+		`{"status": "good", "summary": "正常"}`:  "status必须是",
+		`{"status": "ok"}`:                     "缺少summary",
+		`{"status": "warn", "summary": "有异常"}`: "findings不能为空",
+		`{"status": "warn", "summary": "有异常", "findings": [{"summary": "OOM"}]}`: "findings[0]缺少evidence",
+		`{"status": "ok", "summary": "正常", "entities": [{"kind": "pod"}]}`:       "entities[0]缺少kind或name",
+		`{"status": "ok", "summary": "正常", "outcome": 3}`:                        "outcome超出范围，可选值为0~2",
+	}
+	for content, want := range cases {
+		_, err := ParseAnalysis(content, 2)
+		assert.ErrorContains(t, err, want, content)
+	}
+}
+
+func TestFallbackAnalysis(t *testing.T) {
+	a := FallbackAnalysis("所有Pod正常\n{\"outcome\": 1}", errors.New("缺少summary"))
+	assert.Equal(t, StatusInconclusive, a.Status)
+	assert.Equal(t, "所有Pod正常", a.Format())
+	assert.Equal(t, 1, a.Verdict().Outcome)
+	assert.Equal(t, "缺少summary", a.Invalid)
+}
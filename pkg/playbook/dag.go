@@ -0,0 +1,111 @@
+package playbook
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StepID 步骤标识，未配置id时使用步骤名称
+func (s *Step) StepID() string {
+	if s.Id != "" {
+		return s.Id
+	}
+	return s.Name
+}
+
+// IsDAG 任一步骤配置了depends_on时，方案按依赖关系并行执行
+func (p *PlayBook) IsDAG() bool {
+	dag := false
+	p.Walk(func(path StepPath, step *Step) bool {
+		dag = len(step.DependsOn) > 0
+		return !dag
+	})
+	return dag
+}
+
+// Dependents 返回直接依赖指定步骤的步骤下标
+func (p *PlayBook) Dependents(id string) []int {
+	dependents := make([]int, 0)
+	for i, step := range p.Steps {
+		for _, dep := range step.DependsOn {
+			if dep == id {
+				dependents = append(dependents, i)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+// validateDAG 校验依赖关系：依赖的步骤存在且不存在环
+// 并行执行的方案中没有顺序的概念，不支持next跳转和子步骤
+func (p *PlayBook) validateDAG() error {
+	key := Key(p.Middle, p.Name)
+	ids := make(map[string]int, len(p.Steps))
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		if _, ok := ids[step.StepID()]; ok {
+			return fmt.Errorf("运维方案 %s 的步骤id重复: %s", key, step.StepID())
+		}
+		ids[step.StepID()] = i
+	}
+	if !p.IsDAG() {
+		return nil
+	}
+
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		if step.Next != "" || len(step.Steps) > 0 {
+			return fmt.Errorf("运维方案 %s 配置了depends_on，步骤 %s 不能再使用next或子步骤", key, step.Name)
+		}
+		for _, outcome := range step.Outcomes {
+			if outcome.Next != "" {
+				return fmt.Errorf("运维方案 %s 配置了depends_on，步骤 %s 的结论不能使用next", key, step.Name)
+			}
+		}
+		for _, dep := range step.DependsOn {
+			if _, ok := ids[dep]; !ok {
+				return fmt.Errorf("运维方案 %s 的步骤 %s 依赖不存在的步骤: %s", key, step.Name, dep)
+			}
+		}
+	}
+
+	// 深度优先遍历检测环，0未访问 1访问中 2已完成
+	visit := make([]int, len(p.Steps))
+	var stack []string
+	var dfs func(i int) error
+	dfs = func(i int) error {
+		step := &p.Steps[i]
+		visit[i] = 1
+		stack = append(stack, step.StepID())
+		for _, dep := range step.DependsOn {
+			j := ids[dep]
+			switch visit[j] {
+			case 1:
+				start := 0
+				for k, id := range stack {
+					if id == dep {
+						start = k
+					}
+				}
+				cycle := append(append([]string{}, stack[start:]...), dep)
+				return fmt.Errorf("运维方案 %s 的步骤依赖存在环: %s", key, strings.Join(cycle, " -> "))
+			case 0:
+				if err := dfs(j); err != nil {
+					return err
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		visit[i] = 2
+		return nil
+	}
+	for i := range p.Steps {
+		if visit[i] == 0 {
+			if err := dfs(i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package playbook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDAGBook() *PlayBook {
+	return &PlayBook{Name: "dag", Middle: "m", Steps: []Step{
+		{Id: "a", Name: "A"},
+		{Id: "b", Name: "B"},
+		{Id: "c", Name: "C", DependsOn: []string{"a", "b"}},
+		{Name: "D", DependsOn: []string{"c"}},
+	}}
+}
+
+func TestDAG(t *testing.T) {
+	book := newDAGBook()
+	require.NoError(t, book.Validate())
+	assert.True(t, book.IsDAG())
+	assert.False(t, newTreeBook().IsDAG())
+
+	assert.Equal(t, []int{2}, book.Dependents("a"))
+	// 未配置id时使用步骤名称
+	assert.Equal(t, []int{3}, book.Dependents("c"))
+	assert.Empty(t, book.Dependents("D"))
+}
+
+func TestValidateDAGErrors(t *testing.T) {
+	cases := map[string]struct {
+		mutate func(p *PlayBook)
+		err    string
+	}{
+		"cycle": {
+			mutate: func(p *PlayBook) { p.Steps[0].DependsOn = []string{"D"} },
+			err:    "存在环: a -> D -> c -> a",
+		},
+		"missing dependency": {
+			mutate: func(p *PlayBook) { p.Steps[2].DependsOn = []string{"x"} },
+			err:    "依赖不存在的步骤: x",
+		},
+		"duplicate id": {
+			mutate: func(p *PlayBook) { p.Steps[1].Id = "a" },
+			err:    "步骤id重复: a",
+		},
+		"next": {
+			mutate: func(p *PlayBook) { p.Steps[0].Next = "B" },
+			err:    "不能再使用next或子步骤",
+		},
+		"outcome next": {
+			mutate: func(p *PlayBook) { p.Steps[0].Outcomes = []Outcome{{On: "x", Next: "B"}} },
+			err:    "的结论不能使用next",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			book := newDAGBook()
+			c.mutate(book)
+			err := book.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), c.err)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package playbook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// playbookFile 运维方案配置文件结构
+type playbookFile struct {
+	Playbooks []PlayBook `yaml:"playbooks" json:"playbooks"`
+}
+
+// playbookNodes 仅用于获取每个方案在文件中的行号
+type playbookNodes struct {
+	Playbooks []yaml.Node `yaml:"playbooks"`
+}
+
+// Registry 运维方案注册表，以 Middle + Name 作为唯一标识
+type Registry struct {
+	mu     sync.RWMutex
+	books  map[string]*PlayBook
+	keys   []string // 按加载顺序记录的key
+	nextId int
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		books:  make(map[string]*PlayBook),
+		nextId: 1,
+	}
+}
+
+// Key 生成运维方案在注册表中的标识
+func Key(middle, name string) string {
+	return middle + "/" + name
+}
+
+// LoadRegistry 从文件或目录加载运维方案并生成注册表
+func LoadRegistry(path string) (*Registry, error) {
+	r := NewRegistry()
+	if err := r.Load(path); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Load 加载单个文件或目录下的所有 yaml/yml/json 文件
+func (r *Registry) Load(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("读取运维方案路径失败: %w", err)
+	}
+	if !info.IsDir() {
+		return r.LoadFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("读取运维方案目录失败: %w", err)
+	}
+	// 按文件名排序，保证Id分配稳定
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		if entry.IsDir() || !isPlaybookFile(entry.Name()) {
+			continue
+		}
+		if err := r.LoadFile(filepath.Join(path, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadFile 加载单个运维方案文件，文件内任一方案非法时整个文件都不会被注册
+func (r *Registry) LoadFile(path string) error {
+	if !isPlaybookFile(path) {
+		return fmt.Errorf("不支持的运维方案文件格式: %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取运维方案文件失败: %w", err)
+	}
+
+	books, err := parsePlaybooks(path, data)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, b := range books {
+		if _, ok := r.books[Key(b.book.Middle, b.book.Name)]; ok {
+			return fmt.Errorf("%s:%d: 运维方案重复定义: %s", path, b.line, Key(b.book.Middle, b.book.Name))
+		}
+	}
+	for _, b := range books {
+		key := Key(b.book.Middle, b.book.Name)
+		b.book.Id = r.nextId
+		r.nextId++
+		r.books[key] = b.book
+		r.keys = append(r.keys, key)
+	}
+
+	return nil
+}
+
+// Get 根据中间件和方案名称获取运维方案
+func (r *Registry) Get(middle, name string) (*PlayBook, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	book, ok := r.books[Key(middle, name)]
+	return book, ok
+}
+
+// GetById 根据Id获取运维方案
+func (r *Registry) GetById(id int) (*PlayBook, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, book := range r.books {
+		if book.Id == id {
+			return book, true
+		}
+	}
+	return nil, false
+}
+
+// List 按加载顺序返回所有运维方案，middle为空时返回全部
+func (r *Registry) List(middle string) []*PlayBook {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	books := make([]*PlayBook, 0, len(r.keys))
+	for _, key := range r.keys {
+		book := r.books[key]
+		if middle != "" && book.Middle != middle {
+			continue
+		}
+		books = append(books, book)
+	}
+	return books
+}
+
+type parsedBook struct {
+	book *PlayBook
+	line int
+}
+
+func parsePlaybooks(path string, data []byte) ([]parsedBook, error) {
+	file := &playbookFile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: 解析运维方案失败: %w", path, err)
+	}
+
+	nodes := &playbookNodes{}
+	if err := yaml.Unmarshal(data, nodes); err != nil {
+		return nil, fmt.Errorf("%s: 解析运维方案失败: %w", path, err)
+	}
+
+	seen := make(map[string]int)
+	books := make([]parsedBook, 0, len(file.Playbooks))
+	for i := range file.Playbooks {
+		book := &file.Playbooks[i]
+		line := 0
+		if i < len(nodes.Playbooks) {
+			line = nodes.Playbooks[i].Line
+		}
+		if err := book.Validate(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		key := Key(book.Middle, book.Name)
+		if first, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%s:%d: 运维方案重复定义: %s (首次定义于第%d行)", path, line, key, first)
+		}
+		seen[key] = line
+		book.SetDetails()
+		books = append(books, parsedBook{book: book, line: line})
+	}
+
+	return books, nil
+}
+
+// Validate 校验运维方案的必填字段
+func (p *PlayBook) Validate() error {
+	if p.Name == "" {
+		return errors.New("运维方案缺少name")
+	}
+	if p.Middle == "" {
+		return fmt.Errorf("运维方案 %s 缺少middle", p.Name)
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("运维方案 %s 没有任何步骤", Key(p.Middle, p.Name))
+	}
+	var err error
+	p.Walk(func(path StepPath, step *Step) bool {
+		if step.MaxTurns < 0 || step.MaxToolFailures < 0 {
+			err = fmt.Errorf("运维方案 %s 的步骤 %s 的max_turns和max_tool_failures不能为负数", Key(p.Middle, p.Name), step.Name)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := p.validateTransitions(); err != nil {
+		return err
+	}
+	return p.validateDAG()
+}
+
+func isPlaybookFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package playbook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadRegistryFromConfigDir(t *testing.T) {
+	r, err := LoadRegistry("../../config/playbook")
+	require.NoError(t, err)
+
+	book, ok := r.Get("kubectl", "investigatePodFailures")
+	require.True(t, ok)
+	assert.NotZero(t, book.Id)
+	assert.NotEmpty(t, book.Details)
+	assert.Equal(t, []string{"get_pods"}, book.Steps[0].ToolList)
+
+	// 不同中间件下允许同名方案
+	_, ok = r.Get("postgres", "generalMonitoring")
+	assert.True(t, ok)
+	// 内置方案不覆盖模型，只配置本地模型时也能执行
+	for _, b := range r.List("") {
+		assert.Zero(t, b.Models, Key(b.Middle, b.Name))
+	}
+
+	ids := make(map[int]bool)
+	for _, b := range r.List("") {
+		assert.False(t, ids[b.Id], "重复的Id: %d", b.Id)
+		ids[b.Id] = true
+	}
+	assert.Len(t, r.List("postgres"), 2)
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := map[string]struct {
+		content string
+		errMsg  string
+	}{
+		"unknown.yaml": {
+			content: `playbooks:
+  - name: "a"
+    middle: "kubectl"
+    steps:
+      - name: "s1"
+        tools: ["get_pods"]
+`,
+			errMsg: "line 6: field tools not found",
+		},
+		"runtime.yaml": {
+			content: `playbooks:
+  - name: "a"
+    middle: "kubectl"
+    steps:
+      - name: "s1"
+        toolcalls: ["get_pods"]
+`,
+			errMsg: "line 6: field toolcalls not found",
+		},
+		"empty.yaml": {
+			content: `playbooks:
+  - name: "a"
+    middle: "kubectl"
+    steps: []
+`,
+			errMsg: "empty.yaml:2: 运维方案 kubectl/a 没有任何步骤",
+		},
+		"dup.yaml": {
+			content: `playbooks:
+  - name: "a"
+    middle: "kubectl"
+    steps:
+      - name: "s1"
+  - name: "a"
+    middle: "kubectl"
+    steps:
+      - name: "s1"
+`,
+			errMsg: "dup.yaml:6: 运维方案重复定义: kubectl/a",
+		},
+		"budget.yaml": {
+			content: `playbooks:
+  - name: "a"
+    middle: "kubectl"
+    steps:
+      - name: "s1"
+        max_turns: -1
+`,
+			errMsg: "步骤 s1 的max_turns和max_tool_failures不能为负数",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := writeFile(t, dir, name, c.content)
+			err := NewRegistry().LoadFile(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), c.errMsg)
+		})
+	}
+}
+
+func TestLoadModels(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "models.yaml", `playbooks:
+  - name: "a"
+    middle: "kubectl"
+    models:
+      report: "deepseek-v3"
+    steps:
+      - name: "s1"
+`)
+	r := NewRegistry()
+	require.NoError(t, r.LoadFile(path))
+	book, ok := r.Get("kubectl", "a")
+	require.True(t, ok)
+	assert.Equal(t, Models{Report: "deepseek-v3"}, book.Models)
+}
+
+func TestLoadDuplicateAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.yaml", `playbooks:
+  - name: "a"
+    middle: "kubectl"
+    steps:
+      - name: "s1"
+`)
+	writeFile(t, dir, "b.json", `{"playbooks": [{"name": "a", "middle": "kubectl", "steps": [{"name": "s1"}]}]}`)
+
+	_, err := LoadRegistry(dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b.json:1: 运维方案重复定义: kubectl/a")
+}
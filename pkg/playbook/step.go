@@ -0,0 +1,109 @@
+package playbook
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// StepPath 步骤在步骤树中的位置，每一层为该层步骤的下标，如 [2 0] 表示步骤3.1
+type StepPath []int
+
+// String 返回从1开始的步骤编号，如 3.1
+func (p StepPath) String() string {
+	parts := make([]string, 0, len(p))
+	for _, i := range p {
+		parts = append(parts, strconv.Itoa(i+1))
+	}
+	return strings.Join(parts, ".")
+}
+
+// Depth 步骤的层级，顶层步骤为0
+func (p StepPath) Depth() int {
+	return len(p) - 1
+}
+
+// Parent 父步骤的路径，顶层步骤返回nil
+func (p StepPath) Parent() StepPath {
+	if len(p) <= 1 {
+		return nil
+	}
+	return p[:len(p)-1]
+}
+
+// Equal 判断两个路径是否指向同一个步骤
+func (p StepPath) Equal(other StepPath) bool {
+	if len(p) != len(other) {
+		return false
+	}
+	for i := range p {
+		if p[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare 按步骤树的遍历顺序比较两个路径，p 在前返回-1，相同返回0，在后返回1
+// 父步骤在子步骤之前
+func (p StepPath) Compare(other StepPath) int {
+	return slices.Compare(p, other)
+}
+
+// StepAt 根据路径获取步骤，路径无效时返回nil
+func (p *PlayBook) StepAt(path StepPath) *Step {
+	steps := p.Steps
+	var step *Step
+	for _, i := range path {
+		if i < 0 || i >= len(steps) {
+			return nil
+		}
+		step = &steps[i]
+		steps = step.Steps
+	}
+	return step
+}
+
+// FindStep 在步骤树中按名称查找步骤，未找到时返回nil
+func (p *PlayBook) FindStep(name string) StepPath {
+	var found StepPath
+	p.Walk(func(path StepPath, step *Step) bool {
+		if step.Name == name {
+			found = append(StepPath{}, path...)
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// NextPath 顺序执行时的下一个步骤，没有后续步骤时返回nil
+// 子步骤只在被选中时执行，顺序执行不会进入子步骤；子步骤执行完后回到其顶层步骤之后
+func (p *PlayBook) NextPath(path StepPath) StepPath {
+	if len(path) == 0 {
+		return nil
+	}
+	next := StepPath{path[0] + 1}
+	if p.StepAt(next) == nil {
+		return nil
+	}
+	return next
+}
+
+// Walk 深度优先遍历步骤树，fn 返回false时停止遍历
+func (p *PlayBook) Walk(fn func(path StepPath, step *Step) bool) {
+	walkSteps(p.Steps, nil, fn)
+}
+
+func walkSteps(steps []Step, parent StepPath, fn func(path StepPath, step *Step) bool) bool {
+	for i := range steps {
+		path := append(append(StepPath{}, parent...), i)
+		if !fn(path, &steps[i]) {
+			return false
+		}
+		if !walkSteps(steps[i].Steps, path, fn) {
+			return false
+		}
+	}
+	return true
+}
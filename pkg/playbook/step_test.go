@@ -0,0 +1,52 @@
+package playbook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTreeBook() *PlayBook {
+	return &PlayBook{Name: "tree", Middle: "m", Steps: []Step{
+		{Name: "a"},
+		{Name: "b", Outcomes: []Outcome{{On: "x", Next: "b.1"}, {On: "y", Next: "b.2"}}, Steps: []Step{
+			{Name: "b.1", Next: "b.2"},
+			{Name: "b.2", Steps: []Step{{Name: "b.2.1"}}, Outcomes: []Outcome{{On: "z", Next: "b.2.1"}}},
+		}},
+		{Name: "c"},
+	}}
+}
+
+func TestStepTree(t *testing.T) {
+	book := newTreeBook()
+	require.NoError(t, book.Validate())
+
+	path := book.FindStep("b.2.1")
+	assert.Equal(t, StepPath{1, 1, 0}, path)
+	assert.Equal(t, "2.2.1", path.String())
+	assert.Equal(t, 2, path.Depth())
+	assert.Equal(t, "b.2", book.StepAt(path.Parent()).Name)
+	assert.Nil(t, book.FindStep("missing"))
+	assert.Nil(t, book.StepAt(StepPath{5}))
+
+	// 子步骤执行完后回到顶层步骤之后
+	assert.Equal(t, StepPath{2}, book.NextPath(StepPath{1, 1, 0}))
+	assert.Equal(t, StepPath{2}, book.NextPath(StepPath{1}))
+	assert.Nil(t, book.NextPath(StepPath{2}))
+
+	tr := book.NextStep(StepPath{1}, &Verdict{Outcome: 1})
+	assert.Equal(t, StepPath{1, 0}, tr.Next)
+	tr = book.NextStep(tr.Next, nil)
+	assert.Equal(t, StepPath{1, 1}, tr.Next)
+	tr = book.NextStep(tr.Next, nil)
+	assert.Equal(t, StepPath{2}, tr.Next)
+}
+
+func TestFormatRendersHierarchy(t *testing.T) {
+	out := newTreeBook().Format()
+	assert.Contains(t, out, "步骤2:b\n")
+	assert.Contains(t, out, "  步骤2.1:b.1\n")
+	assert.Contains(t, out, "    步骤2.2.1:b.2.1\n")
+	assert.Contains(t, out, " - x: 进入b.1\n")
+}
@@ -0,0 +1,129 @@
+package playbook
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Outcome 步骤的可选结论，分析模型从中选择一个决定后续执行的步骤
+type Outcome struct {
+	On   string `json:"on" yaml:"on"`                         // 结论成立的条件，提供给分析模型判断
+	Next string `json:"next,omitempty" yaml:"next,omitempty"` // 跳转到的步骤名称，为空时执行下一个步骤
+	Stop bool   `json:"stop,omitempty" yaml:"stop,omitempty"` // 结束排查，直接生成报告
+}
+
+// Verdict 分析模型给出的步骤结论
+type Verdict struct {
+	Outcome int    `json:"outcome"` // 选择的结论序号，从1开始，0表示未匹配任何结论
+	Reason  string `json:"reason"`
+}
+
+// Transition 步骤执行完成后的流转结果
+type Transition struct {
+	Next    StepPath // 下一个步骤的路径，Stop 为true时为nil
+	Stop    bool     // 是否结束排查
+	Outcome *Outcome // 命中的结论，未命中时为nil
+}
+
+// verdictPattern 匹配分析结果末尾的结论json
+var verdictPattern = regexp.MustCompile("(?s)(?:```(?:json)?\\s*)?(\\{[^{}]*\"outcome\"[^{}]*\\})\\s*(?:```)?\\s*$")
+
+// ParseVerdict 从分析结果中提取结论，返回去除结论后的分析内容
+func ParseVerdict(content string) (string, *Verdict) {
+	loc := verdictPattern.FindStringSubmatchIndex(content)
+	if loc == nil {
+		return content, nil
+	}
+	verdict := &Verdict{}
+	if err := json.Unmarshal([]byte(content[loc[2]:loc[3]]), verdict); err != nil {
+		return content, nil
+	}
+	return strings.TrimSpace(content[:loc[0]]), verdict
+}
+
+// NextStep 根据当前步骤和分析结论计算下一个步骤
+// 命中结论时按结论跳转或结束；否则使用步骤配置的next，未配置时顺序执行
+func (p *PlayBook) NextStep(current StepPath, verdict *Verdict) Transition {
+	step := p.StepAt(current)
+	next := step.Next
+	var outcome *Outcome
+	if verdict != nil && verdict.Outcome > 0 && verdict.Outcome <= len(step.Outcomes) {
+		outcome = &step.Outcomes[verdict.Outcome-1]
+		if outcome.Stop {
+			return Transition{Stop: true, Outcome: outcome}
+		}
+		if outcome.Next != "" {
+			next = outcome.Next
+		}
+	}
+
+	t := Transition{Next: p.NextPath(current), Outcome: outcome}
+	if next != "" {
+		t.Next = p.FindStep(next)
+	}
+	t.Stop = t.Next == nil
+	return t
+}
+
+// validateTransitions 校验步骤名称唯一、跳转目标存在，且每个子步骤都能被选中
+// 步骤配置的next只能跳转到之后的步骤，否则每次执行都会回到同一步骤；结论的next可以回退，由执行器限制步骤的执行次数
+func (p *PlayBook) validateTransitions() error {
+	key := Key(p.Middle, p.Name)
+	var err error
+	names := make(map[string]bool)
+	p.Walk(func(path StepPath, step *Step) bool {
+		switch {
+		case step.Name == "":
+			err = fmt.Errorf("运维方案 %s 的步骤%s缺少name", key, path)
+		case names[step.Name]:
+			err = fmt.Errorf("运维方案 %s 的步骤名称重复: %s", key, step.Name)
+		}
+		names[step.Name] = true
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	targets := make(map[string]bool)
+	p.Walk(func(path StepPath, step *Step) bool {
+		if step.Next != "" && !names[step.Next] {
+			err = fmt.Errorf("运维方案 %s 的步骤 %s 跳转到不存在的步骤: %s", key, step.Name, step.Next)
+			return false
+		}
+		if step.Next != "" && p.FindStep(step.Next).Compare(path) <= 0 {
+			err = fmt.Errorf("运维方案 %s 的步骤 %s 的next只能跳转到之后的步骤: %s", key, step.Name, step.Next)
+			return false
+		}
+		targets[step.Next] = true
+		for i, outcome := range step.Outcomes {
+			switch {
+			case outcome.On == "":
+				err = fmt.Errorf("运维方案 %s 的步骤 %s 的第%d个结论缺少on", key, step.Name, i+1)
+			case outcome.Stop && outcome.Next != "":
+				err = fmt.Errorf("运维方案 %s 的步骤 %s 的第%d个结论不能同时配置next和stop", key, step.Name, i+1)
+			case outcome.Next != "" && !names[outcome.Next]:
+				err = fmt.Errorf("运维方案 %s 的步骤 %s 跳转到不存在的步骤: %s", key, step.Name, outcome.Next)
+			}
+			if err != nil {
+				return false
+			}
+			targets[outcome.Next] = true
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	// 子步骤不会被顺序执行，没有任何结论指向时永远不会执行
+	p.Walk(func(path StepPath, step *Step) bool {
+		if path.Depth() > 0 && !targets[step.Name] {
+			err = fmt.Errorf("运维方案 %s 的子步骤 %s 没有被任何步骤选中", key, step.Name)
+		}
+		return err == nil
+	})
+	return err
+}
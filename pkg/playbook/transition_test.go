@@ -0,0 +1,102 @@
+package playbook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVerdict(t *testing.T) {
+	content, verdict := ParseVerdict("发现慢查询\n```json\n{\"outcome\": 2, \"reason\": \"存在Seq Scan\"}\n```\n")
+	require.NotNil(t, verdict)
+	assert.Equal(t, 2, verdict.Outcome)
+	assert.Equal(t, "存在Seq Scan", verdict.Reason)
+	assert.Equal(t, "发现慢查询", content)
+
+	content, verdict = ParseVerdict("所有Pod正常\n{\"outcome\": 1}")
+	require.NotNil(t, verdict)
+	assert.Equal(t, 1, verdict.Outcome)
+	assert.Equal(t, "所有Pod正常", content)
+
+	content, verdict = ParseVerdict("没有结论")
+	assert.Nil(t, verdict)
+	assert.Equal(t, "没有结论", content)
+}
+
+func TestNextStep(t *testing.T) {
+	r, err := LoadRegistry("../../config/playbook")
+	require.NoError(t, err)
+	book, ok := r.Get("postgres", "investigateSlowQueries")
+	require.True(t, ok)
+
+	// 未给出结论时顺序执行
+	tr := book.NextStep(StepPath{0}, nil)
+	assert.Equal(t, Transition{Next: StepPath{1}}, tr)
+
+	tr = book.NextStep(StepPath{0}, &Verdict{Outcome: 1})
+	assert.True(t, tr.Stop)
+	assert.Equal(t, "没有找到执行时间过长的查询", tr.Outcome.On)
+
+	// 步骤3根据结论选择子步骤
+	index := book.FindStep("步骤3：分析索引使用情况")
+	tr = book.NextStep(index, &Verdict{Outcome: 2})
+	assert.False(t, tr.Stop)
+	assert.Equal(t, "3.2", tr.Next.String())
+
+	tr = book.NextStep(index, &Verdict{Outcome: 3})
+	assert.Equal(t, "步骤4：检查数据库配置", book.StepAt(tr.Next).Name)
+
+	// 超出范围的结论视为未命中，顺序执行时跳过子步骤
+	tr = book.NextStep(index, &Verdict{Outcome: 9})
+	assert.Nil(t, tr.Outcome)
+	assert.Equal(t, StepPath{3}, tr.Next)
+
+	tr = book.NextStep(StepPath{len(book.Steps) - 1}, nil)
+	assert.True(t, tr.Stop)
+}
+
+func TestStepNextOverridesOrder(t *testing.T) {
+	book := &PlayBook{Name: "b", Middle: "m", Steps: []Step{
+		{Name: "a", Next: "c"},
+		{Name: "b"},
+		{Name: "c"},
+	}}
+	require.NoError(t, book.Validate())
+	assert.Equal(t, StepPath{2}, book.NextStep(StepPath{0}, nil).Next)
+}
+
+func TestValidateTransitions(t *testing.T) {
+	for _, steps := range [][]Step{
+		{{Name: "a", Next: "missing"}},
+		{{Name: "a", Outcomes: []Outcome{{On: "x", Next: "missing"}}}},
+		{{Name: "a", Outcomes: []Outcome{{On: "x", Next: "a", Stop: true}}}},
+		{{Name: "a", Outcomes: []Outcome{{Next: "a"}}}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Steps: []Step{{Name: "a"}}}},
+		{{Name: "a", Steps: []Step{{Name: "a.1"}}}},
+		{{Name: "a", Steps: []Step{{}}}},
+		{{Name: "a", Next: "a"}},
+		{{Name: "a"}, {Name: "b", Next: "a"}},
+		{{Name: "a", Outcomes: []Outcome{{On: "x", Next: "a.1"}}, Steps: []Step{{Name: "a.1", Next: "a"}}}},
+	} {
+		book := &PlayBook{Name: "b", Middle: "m", Steps: steps}
+		assert.Error(t, book.Validate(), "%+v", steps)
+	}
+}
+
+func TestOutcomeMayJumpBack(t *testing.T) {
+	// 结论可以回到之前的步骤重新检查，执行次数由执行器限制
+	book := &PlayBook{Name: "b", Middle: "m", Steps: []Step{
+		{Name: "a"},
+		{Name: "b", Outcomes: []Outcome{{On: "重启后复查", Next: "a"}}},
+	}}
+	require.NoError(t, book.Validate())
+	assert.Equal(t, StepPath{0}, book.NextStep(StepPath{1}, &Verdict{Outcome: 1}).Next)
+}
+
+func TestStepPathCompare(t *testing.T) {
+	assert.Equal(t, 0, StepPath{1, 0}.Compare(StepPath{1, 0}))
+	assert.Equal(t, -1, StepPath{1}.Compare(StepPath{1, 0}))
+	assert.Equal(t, 1, StepPath{2}.Compare(StepPath{1, 1}))
+}
@@ -9,13 +9,29 @@ import (
 
 	"github.com/bytedance/gopkg/util/logger"
 	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
 )
 
+func init() {
+	// 执行状态会保存在检查点中，需要注册后才能序列化
+	schema.RegisterName[*State]("agent_samples_playbook_state")
+	schema.RegisterName[*StepState]("agent_samples_playbook_step_state")
+}
+
 type Step struct {
-	Name      string   `json:"name" yaml:"name"`
-	Details   string   `json:"details" yaml:"details"`
-	ToolList  []string `json:"tool_list" yaml:"tool_list"`
-	ToolCalls []string
+	Id        string    `json:"id,omitempty" yaml:"id,omitempty"` // 步骤标识，用于depends_on引用，默认为步骤名称
+	Name      string    `json:"name" yaml:"name"`
+	Details   string    `json:"details" yaml:"details"`
+	ToolList  []string  `json:"tool_list" yaml:"tool_list"`
+	Next      string    `json:"next,omitempty" yaml:"next,omitempty"`             // 执行完成后跳转的步骤名称，默认顺序执行
+	Outcomes  []Outcome `json:"outcomes,omitempty" yaml:"outcomes,omitempty"`     // 可选结论，由分析模型选择后决定跳转
+	Steps     []Step    `json:"steps,omitempty" yaml:"steps,omitempty"`           // 子步骤，仅在被结论或next选中时执行
+	DependsOn []string  `json:"depends_on,omitempty" yaml:"depends_on,omitempty"` // 依赖的步骤，配置后方案按依赖关系并行执行
+	ToolCalls []string  `json:"-" yaml:"-"`                                       // 执行时记录的工具调用，不能在配置中指定
+
+	// 工具调用的预算，为0时使用执行器的默认值
+	MaxTurns        int `json:"max_turns,omitempty" yaml:"max_turns,omitempty"`                 // 模型调用工具的最大轮次
+	MaxToolFailures int `json:"max_tool_failures,omitempty" yaml:"max_tool_failures,omitempty"` // 单个工具的最大失败次数
 }
 
 func (s Step) GetToolNames() string {
@@ -23,17 +39,83 @@ func (s Step) GetToolNames() string {
 }
 
 type Record struct {
-	Details string
-	Result  string
+	Path       StepPath // 步骤在步骤树中的位置
+	Step       string   // 步骤名称
+	Details    string
+	Result     string            // 分析结果的文本形式，进入后续步骤和报告的提示词
+	Analysis   *Analysis         // 结构化的分析结果，跳过的步骤为nil
+	Decision   string            // 步骤结束后的流转说明，如命中的结论和跳转的步骤
+	Incomplete string            // 步骤未完成全部工具调用的原因，为空表示已完成
+	Redacted   map[string]int    // 工具输出中各脱敏规则的替换次数
+	Retries    map[string]int    // 工具调用因瞬时故障重试的次数
+	Models     map[string]string // 各模型节点实际使用的模型，多轮调用使用了不同模型时以逗号分隔
+	Dropped    []string          // 因超出上下文预算被截断或压缩的内容说明
 }
 
+// State 运维方案执行过程中的全局状态
 type State struct {
-	Current    int      // 当前执行步骤
-	History    []Record // 历史执行结果
-	PlayBook   *PlayBook
+	Current  StepPath // 当前执行步骤，仅用于顺序执行的方案
+	Finished bool     // 是否已结束排查
+	History  []Record // 历史执行结果
+	PlayBook *PlayBook
+	Halted   map[string]bool // 结束排查或被跳过的步骤，依赖它们的步骤不再执行
+	Dropped  []string        // 生成报告时因超出上下文预算被压缩的执行记录说明
+}
+
+// StepState 单个步骤的工具调用和分析过程中的状态，并行执行的步骤各自独立
+type StepState struct {
+	Path       StepPath
+	Step       *Step
+	Middle     string
+	Target     string            // 本次执行的诊断对象
+	Inputs     map[string]string // 本次执行的输入参数
+	History    []Record          // 开始执行该步骤时已有的执行记录
 	StepCall   map[string]bool   // 当前步骤调用的工具列表
 	CallResult map[string]string // 工具调用结果
 	ErrorInfo  map[string]string // 工具调用异常信息
+	Redacted   map[string]int    // 当前步骤的脱敏统计
+	Retries    map[string]int    // 当前步骤各工具调用的重试次数
+	Models     map[string]string // 当前步骤各模型节点实际使用的模型
+	Dropped    map[string]string // 当前步骤因超出上下文预算被截断或压缩的内容，key为被截断的对象
+
+	MaxTurns        int            // 模型调用工具的最大轮次
+	MaxToolFailures int            // 单个工具的最大失败次数
+	Turns           int            // 已进行的轮次
+	Stalled         int            // 连续未调用任何工具的轮次
+	Failures        map[string]int // 各工具的失败次数
+	Incomplete      []string       // 步骤未完成的原因
+
+	Analysis         *Analysis // 解析后的分析结果
+	AnalysisAttempts int       // 已请求分析模型的次数
+	AnalysisError    string    // 上一次分析结果无法解析的原因，重新请求时提供给模型
+}
+
+// NewStepState 创建步骤状态，并初始化待执行的工具
+func NewStepState(book *PlayBook, path StepPath, history []Record) *StepState {
+	step := book.StepAt(path)
+	stepCall := make(map[string]bool)
+	for _, tool := range step.ToolList {
+		stepCall[tool] = true
+	}
+	return &StepState{
+		Path:       path,
+		Step:       step,
+		Middle:     book.Middle,
+		Target:     book.Target,
+		Inputs:     book.Inputs,
+		History:    history,
+		StepCall:   stepCall,
+		CallResult: make(map[string]string),
+		ErrorInfo:  make(map[string]string),
+		Redacted:   make(map[string]int),
+		Retries:    make(map[string]int),
+		Models:     make(map[string]string),
+		Dropped:    make(map[string]string),
+
+		MaxTurns:        step.MaxTurns,
+		MaxToolFailures: step.MaxToolFailures,
+		Failures:        make(map[string]int),
+	}
 }
 
 // 运维诊断方案
@@ -43,7 +125,19 @@ type PlayBook struct {
 	TaskGoal string `json:"task_goal" yaml:"task_goal"`
 	Middle   string `json:"middle" yaml:"middle"`
 	Steps    []Step `json:"steps" yaml:"steps"`
-	Details  string `json:"details" ` // 存放steps的序列化内容
+	Details  string `json:"details" `                                 // 存放steps的序列化内容
+	Models   Models `json:"models,omitempty" yaml:"models,omitempty"` // 按角色覆盖全局配置的模型
+
+	// 单次执行的参数，由调用方在执行前设置，不从方案配置中加载
+	Target string            `json:"target,omitempty" yaml:"-"` // 诊断对象，如节点名称、Pod名称、实例地址
+	Inputs map[string]string `json:"inputs,omitempty" yaml:"-"` // 输入参数，如命名空间、时间范围
+}
+
+// Models 运维方案各角色使用的模型名称，为空时使用全局模型配置
+type Models struct {
+	Tool     string `json:"tool,omitempty" yaml:"tool,omitempty"`         // 调用工具的模型
+	Analysis string `json:"analysis,omitempty" yaml:"analysis,omitempty"` // 分析步骤结果的模型
+	Report   string `json:"report,omitempty" yaml:"report,omitempty"`     // 生成报告的模型
 }
 
 // GetCollection 返回集合名称
@@ -87,23 +181,35 @@ func (p *PlayBook) Format() string {
 	var detailsBuilder strings.Builder
 	detailsBuilder.WriteString(fmt.Sprintf("方案名称:%s\n", p.Name))
 	detailsBuilder.WriteString(fmt.Sprintf("方案目标:%s\n", p.TaskGoal))
-	for i, step := range p.Steps {
-		detailsBuilder.WriteString(fmt.Sprintf("步骤%d:%s\n %s\n\n", i+1, step.Name, step.Details))
-	}
+	p.Walk(func(path StepPath, step *Step) bool {
+		indent := strings.Repeat("  ", path.Depth())
+		detailsBuilder.WriteString(fmt.Sprintf("%s步骤%s:%s\n%s %s\n", indent, path, step.Name, indent, step.Details))
+		for _, outcome := range step.Outcomes {
+			switch {
+			case outcome.Stop:
+				detailsBuilder.WriteString(fmt.Sprintf("%s - %s: 结束排查\n", indent, outcome.On))
+			case outcome.Next != "":
+				detailsBuilder.WriteString(fmt.Sprintf("%s - %s: 进入%s\n", indent, outcome.On, outcome.Next))
+			}
+		}
+		detailsBuilder.WriteString("\n")
+		return true
+	})
 
 	return detailsBuilder.String()
 }
 
 func (p *PlayBook) GetTools() []tool.InvokableTool {
 	tools := make([]tool.InvokableTool, 0)
-	for _, step := range p.Steps {
+	p.Walk(func(path StepPath, step *Step) bool {
 		for _, toolName := range step.ToolList {
 			t := itool.GetTool(toolName)
 			if t != nil {
 				tools = append(tools, t)
 			}
 		}
-	}
+		return true
+	})
 
 	return tools
 }
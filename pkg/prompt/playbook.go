@@ -2,11 +2,18 @@ package prompt
 
 const (
 	Middleware       = "Middleware"
+	Target           = "Target"
+	Inputs           = "Inputs"
 	ExecutionHistory = "ExecutionHistory"
 	TaskGoal         = "TaskGoal"
 	Tools            = "Tools"
 	ExecutedTools    = "ExecutedTools"
 	ErrorInfo        = "ErrorInfo"
+	Outcomes         = "Outcomes"
+	SkippedSteps     = "SkippedSteps"
+	Incomplete       = "Incomplete"
+	Dropped          = "Dropped"
+	InvalidAnalysis  = "InvalidAnalysis"
 )
 
 const (
@@ -14,7 +21,14 @@ const (
 # 角色
 你是一个专业的运维专家，专门处理{{.Middleware}}的诊断任务。
 这是一个逐步迭代诊断的过程，你需要根据给定的待诊断组件列表，结合当前的任务目标，逐步完成每个步骤的诊断工作。
-
+{{if .Target}}
+# 诊断对象
+{{.Target}}
+{{end}}{{if .Inputs}}
+# 输入参数
+{{range $key, $val := .Inputs}}- {{$key}}: {{$val}}
+{{end}}调用工具时优先使用诊断对象和输入参数中给出的值。
+{{end}}
 
 {{if .ExecutionHistory }}
 # 执行记录:
@@ -63,28 +77,65 @@ const (
 {{end}}
 
 ## 分析要求
-请根据上述任务目标和工具执行结果，提取本次诊断任务的关键信息，包括：
-1. 发现的关键问题或异常
-2. 需要关注的核心指标或信息
-
-请用结构化的方式总结关键信息。
+请根据上述任务目标和工具执行结果进行分析，只输出一个json对象，不要输出其他内容，格式如下：
+{"status": "warn", "summary": "分析结论概述", "findings": [{"summary": "发现的问题或异常", "evidence": ["工具输出中支持该发现的原文摘录"]}], "entities": [{"kind": "pod", "name": "对象名称"}], "next_action": "建议的下一步操作", "outcome": 0, "reason": "选择结论的理由"}
+
+字段说明：
+- status：ok（未发现异常）、warn（存在需要关注的问题）、critical（存在严重问题）、inconclusive（信息不足，无法判断）
+- findings：发现的关键问题或异常，以及需要关注的核心指标，evidence 必须摘录工具输出的原文；status为warn或critical时不能为空
+- entities：分析中涉及的具体对象，kind 如 pod、node、namespace、table、index
+- next_action：建议的下一步排查或处理操作，没有时留空
+{{if .Incomplete}}
+## 未完成说明
+本步骤未能完成全部工具调用：{{.Incomplete}}。
+请基于已有的工具执行结果进行分析，并在summary中明确指出因缺少哪些信息而无法确认的内容。
+{{end}}{{if .Outcomes}}
+## 结论选择
+本步骤有以下可选结论：
+{{range .Outcomes}}{{.}}
+{{end}}
+请在outcome中填写选择的结论序号，并在reason中给出选择理由。
+如果工具执行结果不足以判断或不符合任何结论，outcome填0。
+{{else}}
+本步骤没有可选结论，outcome填0。
+{{end}}{{if .InvalidAnalysis}}
+## 格式错误
+上一次的输出无法解析：{{.InvalidAnalysis}}。请修正后重新输出完整的json对象。
+{{end}}
 `
 
 	ReportTemplate = `
 # 诊断报告
 
 ## 执行摘要
-本次诊断执行了以下步骤，详细记录如下：
+{{if .Target}}**诊断对象：** {{.Target}}
+{{end}}{{if .Inputs}}**输入参数：** {{range $key, $val := .Inputs}}{{$key}}={{$val}} {{end}}
+{{end}}本次诊断执行了以下步骤，详细记录如下：
 
 ## 执行记录
 
 {{if .ExecutionHistory}}
+**执行路径：** {{range $i, $r := .ExecutionHistory}}{{if $i}} → {{end}}{{$r.Path}}{{end}}
+{{if .SkippedSteps}}**未执行的步骤：** {{range $i, $s := .SkippedSteps}}{{if $i}}、{{end}}{{$s}}{{end}}
+{{end}}{{if .Dropped}}**记录压缩：** {{range $i, $d := .Dropped}}{{if $i}}；{{end}}{{$d}}{{end}}
+{{end}}
 {{range .ExecutionHistory}}
-### {{.Details}}
+{{if .Path.Depth}}####{{else}}###{{end}} {{.Path}} {{.Step}}
+{{.Details}}
 
 **执行结果：**
 {{.Result}}
-
+{{if .Incomplete}}
+**未完成：** {{.Incomplete}}
+{{end}}{{if .Decision}}
+**流转：** {{.Decision}}
+{{end}}{{if .Redacted}}
+**数据脱敏：** 该步骤的工具输出中部分敏感数据已被掩码处理（{{range $rule, $count := .Redacted}}{{$rule}}: {{$count}}处 {{end}}）
+{{end}}{{if .Retries}}
+**重试：** 部分工具调用遇到瞬时故障后进行了重试（{{range $call, $count := .Retries}}{{$call}}: {{$count}}次 {{end}}）
+{{end}}{{if .Dropped}}
+**上下文裁剪：** {{range $i, $d := .Dropped}}{{if $i}}；{{end}}{{$d}}{{end}}
+{{end}}
 ---
 
 {{end}}
@@ -97,5 +148,9 @@ const (
 1. 诊断结论：总结本次诊断的主要发现和结论。
 2. 详细分析：对每个执行步骤的结果进行详细分析，指出发现的问题、异常或需要关注的指标。
 3. 后续建议：基于诊断结果，给出后续的建议或行动方案。
+4. 如果根据步骤结论提前结束或跳过了部分步骤，请说明原因。
+5. 如果有步骤进行了数据脱敏，请在报告中注明相关数据已被掩码处理，不要尝试推测被掩码的内容。
+6. 如果有步骤未完成，请说明未完成的原因及其对诊断结论的影响。
+7. 如果有工具输出或执行记录因过长被截断，请基于保留的内容分析，不要推测被省略的部分。
 `
 )
@@ -0,0 +1,158 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// secretGroup 正则中名为secret的分组，存在时只替换该分组的内容
+const secretGroup = "secret"
+
+// Rule 脱敏规则，Pattern 和 Keywords 二选一
+type Rule struct {
+	Name        string   `json:"name" yaml:"name"`
+	Pattern     string   `json:"pattern" yaml:"pattern"`         // 正则规则，包含(?P<secret>...)分组时只替换分组内容
+	Keywords    []string `json:"keywords" yaml:"keywords"`       // 关键字规则，替换 key=value、key: value、--key value 中的value
+	Replacement string   `json:"replacement" yaml:"replacement"` // 替换内容，默认为 [REDACTED:规则名称]
+}
+
+// Config 脱敏配置
+type Config struct {
+	Rules   []Rule   `json:"rules" yaml:"rules"`     // 自定义规则，与内置规则同名时覆盖内置规则
+	Default []string `json:"default" yaml:"default"` // 未单独配置的工具默认启用的规则
+}
+
+// Stats 各规则的脱敏次数
+type Stats map[string]int
+
+// Add 合并脱敏统计
+func (s Stats) Add(other Stats) {
+	for name, count := range other {
+		s[name] += count
+	}
+}
+
+// BuiltinRules 内置的脱敏规则
+func BuiltinRules() []Rule {
+	return []Rule{
+		{Name: "password", Keywords: []string{"password", "passwd", "pwd", "secret"}},
+		{Name: "token", Pattern: `(?i)(?:bearer\s+[A-Za-z0-9\-._~+/]+=*|\bsk-[A-Za-z0-9]{16,}|\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+)`},
+		{Name: "api_key", Keywords: []string{"token", "api_key", "apikey", "access_key", "secret_key", "private_key"}},
+		{Name: "conn_string", Pattern: `(?i)\b[a-z][a-z0-9+.-]*://[^\s:/@]+:(?P<secret>[^\s@/]+)@`},
+		{Name: "email", Pattern: `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`},
+		{Name: "ipv4", Pattern: `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`},
+	}
+}
+
+// DefaultRuleNames 未配置时默认启用的规则，ip地址是诊断的重要信息，默认不脱敏
+func DefaultRuleNames() []string {
+	return []string{"password", "token", "api_key", "conn_string", "email"}
+}
+
+type compiledRule struct {
+	name        string
+	re          *regexp.Regexp
+	group       int // 需要替换的分组，0表示整个匹配
+	replacement string
+}
+
+// Redactor 按顺序应用脱敏规则
+type Redactor struct {
+	rules []compiledRule
+}
+
+// Compile 编译规则集合，返回规则名称到规则的映射
+func Compile(rules []Rule) (map[string]*Rule, error) {
+	ruleMap := make(map[string]*Rule, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("脱敏规则缺少name")
+		}
+		if (rule.Pattern == "") == (len(rule.Keywords) == 0) {
+			return nil, fmt.Errorf("脱敏规则 %s 需要且只能配置pattern或keywords其中之一", rule.Name)
+		}
+		ruleMap[rule.Name] = rule
+	}
+	return ruleMap, nil
+}
+
+// New 根据规则名称从规则集合中创建脱敏器
+func New(ruleMap map[string]*Rule, names []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, name := range names {
+		rule, ok := ruleMap[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的脱敏规则: %s", name)
+		}
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+func compileRule(rule *Rule) (compiledRule, error) {
+	pattern := rule.Pattern
+	if len(rule.Keywords) > 0 {
+		keywords := make([]string, 0, len(rule.Keywords))
+		for _, k := range rule.Keywords {
+			keywords = append(keywords, regexp.QuoteMeta(k))
+		}
+		// 匹配 key=value、key: value、"key": "value" 以及命令行参数 --key value 等形式
+		kw := strings.Join(keywords, "|")
+		pattern = fmt.Sprintf(`(?i)(?:--?(?:%s)\s+|\b(?:%s)\b["']?\s*[:=]\s*["']?)(?P<secret>[^\s"',;&]+)`, kw, kw)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return compiledRule{}, fmt.Errorf("脱敏规则 %s 的正则表达式非法: %w", rule.Name, err)
+	}
+
+	replacement := rule.Replacement
+	if replacement == "" {
+		replacement = fmt.Sprintf("[REDACTED:%s]", rule.Name)
+	}
+
+	group := re.SubexpIndex(secretGroup)
+	if group < 0 {
+		group = 0
+	}
+	return compiledRule{name: rule.Name, re: re, group: group, replacement: replacement}, nil
+}
+
+// Redact 对文本脱敏并返回各规则的替换次数
+func (r *Redactor) Redact(text string) (string, Stats) {
+	stats := make(Stats)
+	if r == nil {
+		return text, stats
+	}
+
+	for _, rule := range r.rules {
+		matches := rule.re.FindAllStringSubmatchIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			start, end := m[2*rule.group], m[2*rule.group+1]
+			// 跳过未匹配的分组和已经被其他规则替换过的内容
+			if start < 0 || strings.HasPrefix(text[start:end], "[REDACTED") {
+				continue
+			}
+			b.WriteString(text[last:start])
+			b.WriteString(rule.replacement)
+			last = end
+			stats[rule.name]++
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+	}
+
+	return text, stats
+}
@@ -7,7 +7,8 @@ import (
 	"strings"
 	"time"
 
-	"github.com/cloudwego/eino-ext/components/model/openai"
+	agentmodel "agent-samples/pkg/model"
+
 	"github.com/cloudwego/eino/adk"
 	"github.com/cloudwego/eino/adk/prebuilt/supervisor"
 	"github.com/cloudwego/eino/components/model"
@@ -17,11 +18,9 @@ import (
 	"github.com/cloudwego/eino/schema"
 )
 
+// NewChatModel 使用模型配置中default角色的模型
 func NewChatModel() model.ToolCallingChatModel {
-	cm, err := openai.NewChatModel(context.Background(), &openai.ChatModelConfig{
-		Model:   "qwen3",
-		BaseURL: "http://127.0.0.1:11434/v1",
-	})
+	cm, err := agentmodel.ForRole(context.Background(), agentmodel.RoleDefault, "")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -194,6 +193,10 @@ func buildSupervisor(ctx context.Context) (adk.Agent, error) {
 func main() {
 	ctx := context.Background()
 
+	if err := agentmodel.Init("config/model/models.yaml"); err != nil {
+		log.Fatalf("init model config failed: %v", err)
+	}
+
 	sv, err := buildSupervisor(ctx)
 	if err != nil {
 		log.Fatalf("build supervisor failed: %v", err)
@@ -0,0 +1,144 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"agent-samples/pkg/tool"
+	"agent-samples/pkg/tool/impl"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// 审批动作
+const (
+	ActionApprove = "approve" // 按原参数执行
+	ActionDeny    = "deny"    // 拒绝执行，作为工具调用错误反馈给模型
+	ActionEdit    = "edit"    // 使用审批人修改后的参数执行
+)
+
+func init() {
+	// 审批信息和已做出的审批结果会保存在检查点中
+	schema.RegisterName[*ApprovalRequest]("agent_samples_approval_request")
+	schema.RegisterName[*approvalState]("agent_samples_approval_state")
+	schema.RegisterName[Decisions]("agent_samples_approval_decisions")
+	schema.RegisterName[Decision]("agent_samples_approval_decision")
+	schema.RegisterName[PendingCall]("agent_samples_pending_call")
+}
+
+// PendingCall 等待审批的工具调用
+type PendingCall struct {
+	CallID    string         `json:"call_id"`
+	Tool      string         `json:"tool"`
+	Command   string         `json:"command"` // 渲染后的命令
+	Arguments map[string]any `json:"arguments"`
+}
+
+// ApprovalRequest 工具调用审批中断的信息，同一轮模型输出中需要审批的调用一起提交
+type ApprovalRequest struct {
+	InterruptID string        `json:"interrupt_id"` // 恢复执行时提交审批结果使用的中断id
+	Calls       []PendingCall `json:"calls"`
+}
+
+// Decision 单个工具调用的审批结果
+type Decision struct {
+	Action    string `json:"action"`
+	Arguments string `json:"arguments,omitempty"` // edit时修改后的参数json，仍需通过参数和命令策略校验
+	Reason    string `json:"reason,omitempty"`    // deny时的拒绝原因，会反馈给模型
+}
+
+// Decisions 审批结果，key为工具调用id
+type Decisions map[string]Decision
+
+// approvalState 审批中断时保存的状态
+// 恢复执行时被中断节点的输入不会保留，需要保存本轮模型输出的调用和之前提交的审批结果
+type approvalState struct {
+	Message   *schema.Message
+	Decisions Decisions
+}
+
+// ApprovalRequests 从执行返回的错误中取出待审批的请求，不是审批中断时返回nil
+func ApprovalRequests(err error) []*ApprovalRequest {
+	info, ok := compose.ExtractInterruptInfo(err)
+	if !ok {
+		return nil
+	}
+	var requests []*ApprovalRequest
+	for _, ic := range info.InterruptContexts {
+		if req, ok := ic.Info.(*ApprovalRequest); ok && ic.IsRootCause {
+			copied := *req
+			copied.InterruptID = ic.ID
+			requests = append(requests, &copied)
+		}
+	}
+	return requests
+}
+
+// restoreApproval 从审批中断中恢复本轮的模型输出，并合并之前和本次提交的审批结果
+// 节点在同一次执行中可能多次运行，只有输入为空时才是从审批中断恢复
+func restoreApproval(ctx context.Context, msg *schema.Message) (*schema.Message, Decisions) {
+	decisions := make(Decisions)
+	if msg != nil {
+		return msg, decisions
+	}
+	if _, hasState, state := compose.GetInterruptState[*approvalState](ctx); hasState {
+		msg = state.Message
+		for id, d := range state.Decisions {
+			decisions[id] = d
+		}
+	}
+	if _, hasData, data := compose.GetResumeContext[Decisions](ctx); hasData {
+		for id, d := range data {
+			decisions[id] = d
+		}
+	}
+	if msg == nil {
+		msg = &schema.Message{}
+	}
+	return msg, decisions
+}
+
+// reviewCalls 执行前检查需要审批的调用
+// 所有需要审批的调用都有审批结果后，返回按审批结果修改参数后的调用和被拒绝的调用；否则中断等待审批
+func reviewCalls(ctx context.Context, msg *schema.Message, calls []schema.ToolCall, decisions Decisions) ([]schema.ToolCall, map[string]error, error) {
+	reviewed := make([]schema.ToolCall, len(calls))
+	denied := make(map[string]error)
+	var pending []PendingCall
+	for i, call := range calls {
+		reviewed[i] = call
+		checker, ok := tool.GetTool(call.Function.Name).(impl.ApprovalChecker)
+		if !ok {
+			continue
+		}
+		// 校验失败的调用执行时会返回同样的错误，无需审批
+		approval, err := checker.CheckApproval(ctx, call.Function.Arguments)
+		if err != nil || approval == nil {
+			continue
+		}
+
+		d, ok := decisions[call.ID]
+		if !ok {
+			pending = append(pending, PendingCall{CallID: call.ID, Tool: approval.Tool, Command: approval.Command, Arguments: approval.Arguments})
+			continue
+		}
+		switch d.Action {
+		case ActionApprove:
+		case ActionEdit:
+			reviewed[i].Function.Arguments = d.Arguments
+		case ActionDeny:
+			reason := d.Reason
+			if reason == "" {
+				reason = "未说明原因"
+			}
+			denied[call.ID] = fmt.Errorf("调用被审批人拒绝: %s", reason)
+		default:
+			return nil, nil, fmt.Errorf("unknown approval action %q for call %s", d.Action, call.ID)
+		}
+	}
+
+	if len(pending) > 0 {
+		return nil, nil, compose.StatefulInterrupt(ctx, &ApprovalRequest{Calls: pending}, &approvalState{Message: msg, Decisions: decisions})
+	}
+	return reviewed, denied, nil
+}
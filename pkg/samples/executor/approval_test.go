@@ -0,0 +1,113 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"agent-samples/pkg/checkpoint"
+	"agent-samples/pkg/playbook"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newApprovalRunner 模型只在第一轮调用需要审批的restart_pod
+// 分析模型原样返回工具执行结果，返回的prompts记录工具模型收到的提示词
+func newApprovalRunner(t *testing.T) (*Runner, *[]string) {
+	t.Helper()
+	initTestTools(t)
+	store, err := checkpoint.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	prompts := make([]string, 0)
+	called := false
+	models := newFakeModels()
+	models.toolModel = &fakeChatModel{reply: func(input []*schema.Message) *schema.Message {
+		mu.Lock()
+		defer mu.Unlock()
+		prompt := input[len(input)-1].Content
+		prompts = append(prompts, prompt)
+		if called {
+			return schema.AssistantMessage("", nil)
+		}
+		called = true
+		return schema.AssistantMessage("", []schema.ToolCall{toolCall("call_1", "restart_pod", `{"pod": "web-1"}`)})
+	}}
+	models.analysisModel = &fakeChatModel{reply: func(input []*schema.Message) *schema.Message {
+		return schema.AssistantMessage(analysisJSON(input[0].Content, 0), nil)
+	}}
+
+	book := &playbook.PlayBook{Name: "restart", Middle: "kubectl", Steps: []playbook.Step{
+		{Name: "重启Pod", Details: "重启异常的Pod", ToolList: []string{"restart_pod"}},
+	}}
+	runner, err := newRunner(context.Background(), book, store, models, newOptions())
+	require.NoError(t, err)
+	return runner, &prompts
+}
+
+// startApproval 开始执行并返回等待审批的请求
+func startApproval(t *testing.T, runner *Runner, runID string) *ApprovalRequest {
+	t.Helper()
+	_, err := runner.Run(context.Background(), runID)
+	require.Error(t, err)
+	requests := ApprovalRequests(err)
+	require.Len(t, requests, 1)
+	require.Len(t, requests[0].Calls, 1)
+	return requests[0]
+}
+
+func TestApprovalApprove(t *testing.T) {
+	runner, _ := newApprovalRunner(t)
+	req := startApproval(t, runner, "approve")
+
+	call := req.Calls[0]
+	assert.Equal(t, "call_1", call.CallID)
+	assert.Equal(t, "restart_pod", call.Tool)
+	assert.Equal(t, "echo restarted web-1", call.Command)
+	assert.Equal(t, "web-1", call.Arguments["pod"])
+	assert.NotEmpty(t, req.InterruptID)
+
+	report, err := runner.ResumeWithDecisions(context.Background(), "approve", map[string]Decisions{
+		req.InterruptID: {"call_1": {Action: ActionApprove}},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, report.Content, "restarted web-1")
+}
+
+func TestApprovalEdit(t *testing.T) {
+	runner, _ := newApprovalRunner(t)
+	req := startApproval(t, runner, "edit")
+
+	report, err := runner.ResumeWithDecisions(context.Background(), "edit", map[string]Decisions{
+		req.InterruptID: {"call_1": {Action: ActionEdit, Arguments: `{"pod": "web-2"}`}},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, report.Content, "restarted web-2")
+	assert.NotContains(t, report.Content, "restarted web-1")
+}
+
+func TestApprovalDeny(t *testing.T) {
+	runner, prompts := newApprovalRunner(t)
+	req := startApproval(t, runner, "deny")
+
+	report, err := runner.ResumeWithDecisions(context.Background(), "deny", map[string]Decisions{
+		req.InterruptID: {"call_1": {Action: ActionDeny, Reason: "业务高峰期"}},
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, report.Content, "restarted")
+	// 拒绝的调用作为工具错误反馈给模型
+	require.Greater(t, len(*prompts), 1)
+	assert.Contains(t, (*prompts)[1], "调用被审批人拒绝: 业务高峰期")
+}
+
+func TestApprovalResumeWithoutDecision(t *testing.T) {
+	runner, _ := newApprovalRunner(t)
+	startApproval(t, runner, "pending")
+
+	// 没有提交审批结果时再次中断
+	_, err := runner.Resume(context.Background(), "pending")
+	require.Len(t, ApprovalRequests(err), 1)
+}
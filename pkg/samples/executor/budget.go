@@ -0,0 +1,221 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"agent-samples/pkg/playbook"
+	"agent-samples/pkg/tool"
+	"agent-samples/pkg/tool/impl"
+)
+
+const (
+	// summaryTokens 压缩后每条执行记录摘要的最大长度
+	summaryTokens = 200
+	// keepRecentRecords 压缩执行记录时完整保留的最近记录数
+	keepRecentRecords = 2
+	// minResultTokens 提示词超出预算时，每个工具结果至少保留的长度
+	minResultTokens = 200
+)
+
+// tokenCost 单个字符的token数估算：中日韩字符约1个token，其余字符约4个字符1个token
+func tokenCost(r rune) float64 {
+	if r >= 0x2E80 {
+		return 1
+	}
+	return 0.25
+}
+
+// estimateTokens 粗略估算文本的token数，用于控制提示词大小，不要求精确
+func estimateTokens(s string) int {
+	var n float64
+	for _, r := range s {
+		n += tokenCost(r)
+	}
+	return int(math.Ceil(n))
+}
+
+// truncateTokens 将文本截断到约maxTokens个token，keep 指定保留的部分，返回截断后的文本和省略的token数
+// 被省略的位置插入说明，模型可以据此判断输出不完整
+func truncateTokens(s string, maxTokens int, keep string) (string, int) {
+	total := estimateTokens(s)
+	if maxTokens <= 0 || total <= maxTokens {
+		return s, 0
+	}
+
+	runes := []rune(s)
+	var head, tail []rune
+	switch keep {
+	case impl.KeepHead:
+		head = headRunes(runes, maxTokens)
+	case impl.KeepTail:
+		tail = tailRunes(runes, maxTokens)
+	default:
+		head = headRunes(runes, maxTokens/2)
+		tail = tailRunes(runes, maxTokens-maxTokens/2)
+	}
+	dropped := total - estimateTokens(string(head)) - estimateTokens(string(tail))
+	return fmt.Sprintf("%s\n...[已省略约%d个token]...\n%s", string(head), dropped, string(tail)), dropped
+}
+
+// headRunes 保留开头约maxTokens个token，截断位置尽量落在行尾，避免表格等按行组织的输出出现半行
+func headRunes(runes []rune, maxTokens int) []rune {
+	var n float64
+	for i, r := range runes {
+		n += tokenCost(r)
+		if n <= float64(maxTokens) {
+			continue
+		}
+		for j := i - 1; j >= i/2; j-- {
+			if runes[j] == '\n' {
+				return runes[:j]
+			}
+		}
+		return runes[:i]
+	}
+	return runes
+}
+
+// tailRunes 保留结尾约maxTokens个token，截断位置尽量落在行首
+func tailRunes(runes []rune, maxTokens int) []rune {
+	var n float64
+	for i := len(runes) - 1; i >= 0; i-- {
+		n += tokenCost(runes[i])
+		if n <= float64(maxTokens) {
+			continue
+		}
+		for j := i + 1; j <= i+(len(runes)-i)/2; j++ {
+			if runes[j] == '\n' {
+				return runes[j+1:]
+			}
+		}
+		return runes[i+1:]
+	}
+	return runes
+}
+
+// outputLimit 工具的输出限制，工具未配置maxOutputTokens时使用执行器的默认限制
+func outputLimit(name string, o *options) impl.OutputLimit {
+	limit := impl.OutputLimit{MaxTokens: o.toolOutputTokens, Keep: impl.KeepHeadTail}
+	if limiter, ok := tool.GetTool(name).(impl.OutputLimiter); ok {
+		l := limiter.OutputLimit()
+		if l.MaxTokens > 0 {
+			limit.MaxTokens = l.MaxTokens
+		}
+		limit.Keep = l.Keep
+	}
+	return limit
+}
+
+// historyTokens 估算执行记录进入提示词后的token数
+func historyTokens(history []playbook.Record) int {
+	n := 0
+	for _, r := range history {
+		n += estimateTokens(r.Details) + estimateTokens(r.Result)
+	}
+	return n
+}
+
+// compactHistory 执行记录超出预算时，从最早的记录开始将执行结果替换为摘要，最近的记录保持完整
+// 返回压缩后的副本和每条被压缩记录的说明，原记录不变
+func compactHistory(history []playbook.Record, budget int) ([]playbook.Record, map[string]string) {
+	total := historyTokens(history)
+	if budget <= 0 || total <= budget {
+		return history, nil
+	}
+
+	compacted := append([]playbook.Record{}, history...)
+	notes := make(map[string]string)
+	for i := 0; i < len(compacted)-keepRecentRecords && total > budget; i++ {
+		r := &compacted[i]
+		summary := summarizeRecord(r)
+		dropped := estimateTokens(r.Result) - estimateTokens(summary)
+		if dropped <= 0 {
+			continue
+		}
+		r.Result = summary
+		total -= dropped
+		notes["history:"+r.Path.String()] = fmt.Sprintf("步骤 %s %s 的执行结果已压缩为摘要，省略约%d个token", r.Path, r.Step, dropped)
+	}
+	return compacted, notes
+}
+
+// summarizeRecord 生成执行记录的摘要：有结构化分析结果时保留状态、结论和发现，省略证据原文
+// 没有分析结果或摘要仍然过长时只保留开头
+func summarizeRecord(r *playbook.Record) string {
+	summary := r.Result
+	if r.Analysis != nil {
+		summary = r.Analysis.Brief()
+	}
+	summary, _ = truncateTokens(summary, summaryTokens, impl.KeepHead)
+	return summary
+}
+
+// fitResults 工具结果超出预算时平均分配预算并按各工具的保留方式截断，返回截断后的副本和说明
+// 提示词其他部分已占满预算时，每个结果仍保留minResultTokens
+func fitResults(results map[string]string, budget int, o *options) (map[string]string, map[string]string) {
+	if mapTokens(results) <= budget {
+		return results, nil
+	}
+
+	per := minResultTokens
+	if len(results) > 0 && budget/len(results) > per {
+		per = budget / len(results)
+	}
+	keys := make([]string, 0, len(results))
+	for k := range results {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fitted := make(map[string]string, len(results))
+	notes := make(map[string]string)
+	for _, k := range keys {
+		v, dropped := truncateTokens(results[k], per, outputLimit(toolNameOfKey(k), o).Keep)
+		fitted[k] = v
+		if dropped > 0 {
+			notes["prompt:"+k] = fmt.Sprintf("提示词超出预算，工具 %s 的结果进一步截断，省略约%d个token", k, dropped)
+		}
+	}
+	return fitted, notes
+}
+
+// mapTokens 估算工具结果或异常信息的token数
+func mapTokens(m map[string]string) int {
+	n := 0
+	for k, v := range m {
+		n += estimateTokens(k) + estimateTokens(v)
+	}
+	return n
+}
+
+// addDropped 记录步骤中被省略的内容，同一对象多次截断时保留最后一次的说明
+func addDropped(state *playbook.StepState, notes map[string]string) {
+	if len(notes) == 0 {
+		return
+	}
+	if state.Dropped == nil {
+		state.Dropped = make(map[string]string)
+	}
+	for k, v := range notes {
+		state.Dropped[k] = v
+	}
+}
+
+// droppedNotes 按key排序返回被省略内容的说明
+func droppedNotes(dropped map[string]string) []string {
+	if len(dropped) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(dropped))
+	for k := range dropped {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	notes := make([]string, 0, len(keys))
+	for _, k := range keys {
+		notes = append(notes, dropped[k])
+	}
+	return notes
+}
@@ -0,0 +1,161 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"agent-samples/pkg/playbook"
+	"agent-samples/pkg/prompt"
+	"agent-samples/pkg/tool/impl"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, estimateTokens(""))
+	assert.Equal(t, 2, estimateTokens("abcdefgh"))
+	assert.Equal(t, 4, estimateTokens("磁盘使用"))
+}
+
+func TestTruncateTokens(t *testing.T) {
+	lines := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		lines = append(lines, strings.Repeat(string(rune('a'+i%26)), 19))
+	}
+	text := strings.Join(lines, "\n") // 每行约5个token
+
+	out, dropped := truncateTokens(text, 0, impl.KeepHead)
+	assert.Equal(t, text, out)
+	assert.Zero(t, dropped)
+
+	out, dropped = truncateTokens(text, 50, impl.KeepHead)
+	assert.Positive(t, dropped)
+	assert.True(t, strings.HasPrefix(out, lines[0]+"\n"))
+	assert.Contains(t, out, "个token]...")
+	// 截断位置落在行尾，不保留半行
+	head, _, _ := strings.Cut(out, "\n...[")
+	for _, line := range strings.Split(head, "\n") {
+		assert.Len(t, line, 19)
+	}
+
+	out, _ = truncateTokens(text, 50, impl.KeepTail)
+	assert.True(t, strings.HasSuffix(out, "\n"+lines[99]))
+	assert.NotContains(t, out, lines[0]+"\n")
+
+	out, _ = truncateTokens(text, 50, impl.KeepHeadTail)
+	assert.True(t, strings.HasPrefix(out, lines[0]))
+	assert.True(t, strings.HasSuffix(out, lines[99]))
+	assert.Less(t, estimateTokens(out), 70)
+}
+
+func TestCompactHistory(t *testing.T) {
+	long := strings.Repeat("结果", 500)
+	history := []playbook.Record{
+		{Path: playbook.StepPath{0}, Step: "a", Result: long},
+		{Path: playbook.StepPath{1}, Step: "b", Result: long},
+		{Path: playbook.StepPath{2}, Step: "c", Result: long},
+		{Path: playbook.StepPath{3}, Step: "d", Result: long},
+	}
+
+	same, notes := compactHistory(history, 0)
+	assert.Equal(t, history, same)
+	assert.Empty(t, notes)
+
+	compacted, notes := compactHistory(history, 2500)
+	// 从最早的记录开始压缩，达到预算后停止
+	assert.Less(t, estimateTokens(compacted[0].Result), summaryTokens+20)
+	assert.Less(t, estimateTokens(compacted[1].Result), summaryTokens+20)
+	assert.Equal(t, long, compacted[2].Result)
+	assert.Equal(t, long, compacted[3].Result)
+	assert.Len(t, notes, 2)
+	assert.Contains(t, notes["history:1"], "步骤 1 a 的执行结果已压缩为摘要")
+	// 不修改原记录
+	assert.Equal(t, long, history[0].Result)
+
+	// 最近的记录始终保持完整
+	compacted, _ = compactHistory(history, 10)
+	assert.Equal(t, long, compacted[2].Result)
+	assert.Equal(t, long, compacted[3].Result)
+}
+
+func TestCompactHistoryUsesAnalysis(t *testing.T) {
+	analysis := &playbook.Analysis{
+		Status:   playbook.StatusCritical,
+		Summary:  "web-1 反复重启",
+		Findings: []playbook.Finding{{Summary: "容器OOM", Evidence: []string{strings.Repeat("日志", 500)}}},
+	}
+	history := []playbook.Record{
+		{Path: playbook.StepPath{0}, Step: "a", Result: analysis.Format(), Analysis: analysis},
+		{Path: playbook.StepPath{1}, Step: "b", Result: "正常"},
+		{Path: playbook.StepPath{2}, Step: "c", Result: "正常"},
+	}
+
+	// 摘要保留状态和发现，省略证据原文，而不是截取开头
+	compacted, notes := compactHistory(history, 100)
+	assert.Equal(t, "状态：critical\nweb-1 反复重启\n发现：\n1. 容器OOM", compacted[0].Result)
+	assert.Contains(t, notes["history:1"], "步骤 1 a 的执行结果已压缩为摘要")
+}
+
+func TestExecToolTruncatesOutput(t *testing.T) {
+	initTestTools(t)
+	msg := schema.AssistantMessage("", []schema.ToolCall{
+		toolCall("call_1", "long_log", `{}`),
+		toolCall("call_2", "slow_echo", `{"msg": "a"}`),
+	})
+
+	out, err := execTool(context.Background(), msg, newOptions())
+	require.NoError(t, err)
+	// 按工具配置保留结尾
+	assert.True(t, strings.HasSuffix(out["long_log"].(string), "1999\n2000\n"))
+	assert.NotContains(t, out["long_log"], "\n1\n2\n")
+	assert.Equal(t, "a\n", out["slow_echo"])
+	truncated := out[truncateKey].(map[string]int)
+	assert.Len(t, truncated, 1)
+	assert.Positive(t, truncated["long_log"])
+
+	state := playbook.NewStepState(&playbook.PlayBook{Steps: []playbook.Step{
+		{Name: "logs", ToolList: []string{"long_log", "slow_echo"}},
+	}}, playbook.StepPath{0}, nil)
+	_, err = toolStateHandle(context.Background(), out, state)
+	require.NoError(t, err)
+	assert.Contains(t, state.Dropped["tool:long_log"], "工具 long_log 的输出过长")
+	assert.NotContains(t, state.CallResult, truncateKey)
+}
+
+func TestExecPromptFitsBudget(t *testing.T) {
+	initTestTools(t)
+	book := &playbook.PlayBook{Middle: "k8s", Steps: []playbook.Step{
+		{Name: "a"}, {Name: "b"}, {Name: "c"},
+		{Name: "check", Details: "检查日志", ToolList: []string{"long_log", "slow_echo"}},
+	}}
+	history := []playbook.Record{
+		{Path: playbook.StepPath{0}, Step: "a", Result: strings.Repeat("结果", 1000)},
+		{Path: playbook.StepPath{1}, Step: "b", Result: "正常"},
+		{Path: playbook.StepPath{2}, Step: "c", Result: "正常"},
+	}
+	state := playbook.NewStepState(book, playbook.StepPath{3}, history)
+	state.CallResult["long_log"] = strings.Repeat("log line\n", 2000)
+	state.CallResult["slow_echo"] = "a\n"
+
+	o := newOptions(WithPromptTokens(3000), WithHistoryTokens(500))
+	out, err := newState2ExecPrompt(o)(context.Background(), nil, state)
+	require.NoError(t, err)
+
+	records := out[prompt.ExecutionHistory].([]playbook.Record)
+	assert.Less(t, estimateTokens(records[0].Result), summaryTokens+20)
+	results := out[prompt.ExecutedTools].(map[string]string)
+	assert.Less(t, estimateTokens(results["long_log"]), 3000)
+	assert.Equal(t, "a\n", results["slow_echo"])
+	// 状态中保留完整结果，被省略的内容记录在步骤中
+	assert.Len(t, state.CallResult["long_log"], 18000)
+	assert.Len(t, state.History[0].Result, 6000)
+	assert.Contains(t, state.Dropped, "history:1")
+	assert.Contains(t, state.Dropped, "prompt:long_log")
+
+	out, err = newState2ExecPrompt(newOptions(WithPromptTokens(0), WithHistoryTokens(0)))(context.Background(), nil, state)
+	require.NoError(t, err)
+	assert.Equal(t, state.CallResult, out[prompt.ExecutedTools])
+}
@@ -0,0 +1,173 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	agentmodel "agent-samples/pkg/model"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	ucb "github.com/cloudwego/eino/utils/callbacks"
+)
+
+// eventBuffer 事件通道的缓冲大小，调用方读取较慢时执行会等待
+const eventBuffer = 64
+
+// EventType 执行事件的类型
+type EventType string
+
+const (
+	EventStepStarted   EventType = "step_started"   // 步骤开始执行
+	EventStepFinished  EventType = "step_finished"  // 步骤执行完成或被跳过
+	EventToolRequested EventType = "tool_requested" // 模型请求调用工具
+	EventToolStarted   EventType = "tool_started"   // 工具开始执行
+	EventToolFinished  EventType = "tool_finished"  // 工具执行结束，包括被拒绝的调用
+	EventLLMDelta      EventType = "llm_delta"      // 模型输出的增量内容
+	EventInterrupted   EventType = "interrupted"    // 执行中断，等待审批
+	EventRunCompleted  EventType = "run_completed"  // 执行完成并生成报告
+	EventRunFailed     EventType = "run_failed"     // 执行失败
+)
+
+// Event 执行过程中的事件，按类型填充对应的字段
+type Event struct {
+	Type  EventType `json:"type"`
+	RunID string    `json:"run_id"`
+	Time  time.Time `json:"time"`
+
+	Step      *StepEvent         `json:"step,omitempty"`      // step_started、step_finished
+	Tool      *ToolEvent         `json:"tool,omitempty"`      // tool_*
+	LLM       *LLMEvent          `json:"llm,omitempty"`       // llm_delta
+	Approvals []*ApprovalRequest `json:"approvals,omitempty"` // interrupted
+	Report    string             `json:"report,omitempty"`    // run_completed
+	Model     string             `json:"model,omitempty"`     // run_completed，实际生成报告的模型，回退链可能使用了备用模型
+	Error     string             `json:"error,omitempty"`     // run_failed
+}
+
+// StepEvent 步骤事件
+type StepEvent struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Status   string `json:"status,omitempty"`   // 分析结果的状态，仅 step_finished
+	Decision string `json:"decision,omitempty"` // 步骤结束后的流转说明，仅 step_finished
+	Skipped  bool   `json:"skipped,omitempty"`
+}
+
+// ToolEvent 工具调用事件
+type ToolEvent struct {
+	CallID     string        `json:"call_id"`
+	Name       string        `json:"name"`
+	Arguments  string        `json:"arguments,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"` // 执行耗时，仅 tool_finished
+	ExitStatus int           `json:"exit_status"`        // 命令退出码，成功为0，无法获取时为-1，仅 tool_finished
+	Attempts   int           `json:"attempts,omitempty"` // 实际尝试次数，仅 tool_finished
+	Error      string        `json:"error,omitempty"`    // 仅 tool_finished
+}
+
+// LLMEvent 模型输出事件，Node 为模型节点名称，如 toolLLM、analysisLLM、reportLLM
+type LLMEvent struct {
+	Node  string `json:"node"`
+	Delta string `json:"delta"`
+}
+
+type emitterKey struct{}
+
+// emitter 将执行中产生的事件写入通道
+// 执行结束后关闭通道，ctx 结束后不再等待调用方读取，未写入的事件被丢弃
+type emitter struct {
+	ctx   context.Context
+	runID string
+	ch    chan Event
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newEmitter(ctx context.Context, runID string) *emitter {
+	return &emitter{ctx: ctx, runID: runID, ch: make(chan Event, eventBuffer)}
+}
+
+func (e *emitter) emit(ev Event) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	ev.RunID = e.runID
+	ev.Time = time.Now()
+	select {
+	case e.ch <- ev:
+	case <-e.ctx.Done():
+	}
+}
+
+func (e *emitter) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.closed {
+		e.closed = true
+		close(e.ch)
+	}
+}
+
+// finish 根据执行结果发送最后一个事件
+func (e *emitter) finish(report *schema.Message, err error) {
+	switch {
+	case err == nil:
+		e.emit(Event{Type: EventRunCompleted, Report: report.Content, Model: agentmodel.BackendOf(report)})
+	case len(ApprovalRequests(err)) > 0:
+		e.emit(Event{Type: EventInterrupted, Approvals: ApprovalRequests(err)})
+	default:
+		e.emit(Event{Type: EventRunFailed, Error: err.Error()})
+	}
+}
+
+// emit 发送执行事件，ctx 中没有事件订阅时忽略
+func emit(ctx context.Context, ev Event) {
+	if e, ok := ctx.Value(emitterKey{}).(*emitter); ok {
+		e.emit(ev)
+	}
+}
+
+// streamEvents 在后台执行run，返回执行事件通道
+// 通道的生命周期与 ctx 绑定：执行结束后关闭，ctx 结束时执行随之终止
+func streamEvents(ctx context.Context, runID string, run func(ctx context.Context) (*schema.Message, error)) <-chan Event {
+	e := newEmitter(ctx, runID)
+	go func() {
+		defer e.close()
+		report, err := run(context.WithValue(ctx, emitterKey{}, e))
+		if err == nil {
+			err = ctx.Err()
+		}
+		e.finish(report, err)
+	}()
+	return e.ch
+}
+
+// newLLMEventCallback 将模型节点的输出作为增量事件发送，非流式调用时整条回复作为一个增量
+func newLLMEventCallback() callbacks.Handler {
+	handler := &ucb.ModelCallbackHandler{
+		OnEnd: func(ctx context.Context, info *callbacks.RunInfo, output *model.CallbackOutput) context.Context {
+			if output.Message != nil && output.Message.Content != "" {
+				emit(ctx, Event{Type: EventLLMDelta, LLM: &LLMEvent{Node: info.Name, Delta: output.Message.Content}})
+			}
+			return ctx
+		},
+		OnEndWithStreamOutput: func(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[*model.CallbackOutput]) context.Context {
+			// 在回调中读完副本，保证增量事件先于后续节点的事件发送
+			defer output.Close()
+			for {
+				chunk, err := output.Recv()
+				if err != nil {
+					return ctx
+				}
+				if chunk.Message != nil && chunk.Message.Content != "" {
+					emit(ctx, Event{Type: EventLLMDelta, LLM: &LLMEvent{Node: info.Name, Delta: chunk.Message.Content}})
+				}
+			}
+		},
+	}
+	return ucb.NewHandlerHelper().ChatModel(handler).Handler()
+}
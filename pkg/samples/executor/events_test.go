@@ -0,0 +1,174 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"agent-samples/pkg/checkpoint"
+	agentmodel "agent-samples/pkg/model"
+	"agent-samples/pkg/playbook"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEventRunner 创建调用一次指定工具后结束的执行器
+func newEventRunner(t *testing.T, calls ...schema.ToolCall) *Runner {
+	t.Helper()
+	initTestTools(t)
+	store, err := checkpoint.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	called := false
+	models := newFakeModels()
+	models.toolModel = &fakeChatModel{reply: func(input []*schema.Message) *schema.Message {
+		mu.Lock()
+		defer mu.Unlock()
+		if called {
+			return schema.AssistantMessage("", nil)
+		}
+		called = true
+		return schema.AssistantMessage("", calls)
+	}}
+	// 报告模型通过回退链调用，执行结果中记录实际使用的模型
+	report, err := agentmodel.NewFallbackChatModel(agentmodel.Backend{Name: "qwen3", Model: models.reportModel})
+	require.NoError(t, err)
+	models.reportModel = report
+	book := &playbook.PlayBook{Name: "events", Middle: "kubectl", Steps: []playbook.Step{
+		{Name: "检查", Details: "检查Pod", ToolList: []string{"slow_echo", "fail", "restart_pod"}},
+	}}
+	runner, err := newRunner(context.Background(), book, store, models, newOptions())
+	require.NoError(t, err)
+	return runner
+}
+
+func collectEvents(ch <-chan Event) []Event {
+	var events []Event
+	for ev := range ch {
+		events = append(events, ev)
+	}
+	return events
+}
+
+func eventTypes(events []Event) []EventType {
+	types := make([]EventType, 0, len(events))
+	for _, ev := range events {
+		if ev.Type != EventLLMDelta {
+			types = append(types, ev.Type)
+		}
+	}
+	return types
+}
+
+func TestRunEvents(t *testing.T) {
+	runner := newEventRunner(t,
+		toolCall("call_1", "slow_echo", `{"msg": "a"}`),
+		toolCall("call_2", "fail", `{}`),
+	)
+	events := collectEvents(runner.RunEvents(context.Background(), "run-1"))
+
+	assert.Equal(t, []EventType{
+		EventStepStarted,
+		EventToolRequested, EventToolRequested,
+		EventToolStarted, EventToolStarted, EventToolFinished, EventToolFinished,
+		EventStepFinished,
+		EventRunCompleted,
+	}, sortToolEvents(eventTypes(events)))
+
+	finished := make(map[string]*ToolEvent)
+	nodes := make(map[string]bool)
+	for _, ev := range events {
+		assert.Equal(t, "run-1", ev.RunID)
+		switch ev.Type {
+		case EventToolFinished:
+			finished[ev.Tool.Name] = ev.Tool
+		case EventLLMDelta:
+			nodes[ev.LLM.Node] = true
+		case EventStepFinished:
+			assert.Equal(t, &StepEvent{Path: "1", Name: "检查", Status: playbook.StatusOK}, ev.Step)
+		}
+	}
+	assert.Equal(t, 0, finished["slow_echo"].ExitStatus)
+	assert.Equal(t, `{"msg": "a"}`, finished["slow_echo"].Arguments)
+	assert.GreaterOrEqual(t, finished["slow_echo"].Duration, 300*time.Millisecond)
+	assert.Equal(t, 1, finished["fail"].ExitStatus)
+	assert.Contains(t, finished["fail"].Error, "exit status 1")
+	assert.Equal(t, map[string]bool{analysisLLM: true, reportLLM: true}, nodes)
+	assert.Contains(t, events[len(events)-1].Report, "检查")
+	assert.Equal(t, "qwen3", events[len(events)-1].Model)
+}
+
+// sortToolEvents 并发执行的工具调用事件顺序不固定，只保证同一调用的开始在结束之前
+func sortToolEvents(types []EventType) []EventType {
+	started, finished := 0, 0
+	out := make([]EventType, 0, len(types))
+	for _, typ := range types {
+		switch typ {
+		case EventToolStarted:
+			started++
+		case EventToolFinished:
+			finished++
+		default:
+			for ; started > 0; started-- {
+				out = append(out, EventToolStarted)
+			}
+			for ; finished > 0; finished-- {
+				out = append(out, EventToolFinished)
+			}
+			out = append(out, typ)
+		}
+	}
+	return out
+}
+
+func TestRunEventsInterrupted(t *testing.T) {
+	runner := newEventRunner(t, toolCall("call_1", "restart_pod", `{"pod": "web-1"}`))
+	events := collectEvents(runner.RunEvents(context.Background(), "run-1"))
+
+	last := events[len(events)-1]
+	require.Equal(t, EventInterrupted, last.Type)
+	require.Len(t, last.Approvals, 1)
+	assert.Equal(t, "restart_pod", last.Approvals[0].Calls[0].Tool)
+
+	// 审批后继续执行被审批的调用，中断前已发送的请求事件不再重复发送
+	decisions := map[string]Decisions{last.Approvals[0].InterruptID: {"call_1": {Action: ActionApprove}}}
+	events = collectEvents(runner.ResumeEvents(context.Background(), "run-1", decisions))
+	assert.Equal(t, []EventType{
+		EventToolStarted, EventToolFinished,
+		EventStepFinished,
+		EventRunCompleted,
+	}, eventTypes(events))
+}
+
+func TestRunEventsClosedOnCancel(t *testing.T) {
+	runner := newEventRunner(t, toolCall("call_1", "slow_echo", `{"msg": "a"}`))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := runner.RunEvents(ctx, "run-1")
+	for ev := range ch {
+		if ev.Type == EventToolStarted {
+			// 调用方不再读取事件，取消后通道仍然会关闭
+			cancel()
+			break
+		}
+	}
+	select {
+	case <-drain(ch):
+	case <-time.After(5 * time.Second):
+		t.Fatal("event channel not closed after cancel")
+	}
+}
+
+func drain(ch <-chan Event) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range ch {
+		}
+	}()
+	return done
+}
@@ -2,11 +2,20 @@ package executor
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	agentmodel "agent-samples/pkg/model"
 	"agent-samples/pkg/playbook"
 	"agent-samples/pkg/prompt"
+	"agent-samples/pkg/redact"
+	"agent-samples/pkg/secret"
 	"agent-samples/pkg/tool"
+	"agent-samples/pkg/tool/impl"
 
 	"github.com/cloudwego/eino/schema"
 )
@@ -27,33 +36,169 @@ func collectMessages(ctx context.Context, input []*schema.Message) (output strin
 	return strBuilder.String(), nil
 }
 
-// 调用工具节点
-func execTool(ctx context.Context, msg *schema.Message) (map[string]any, error) {
+// callOutput 单个工具调用的执行结果
+type callOutput struct {
+	result   string
+	err      error
+	attempts int           // 实际尝试次数，瞬时故障重试时大于1
+	duration time.Duration // 执行耗时，包括重试的等待时间
+}
+
+// newExecTool 创建调用工具节点，同一轮模型输出中的工具调用并发执行
+func newExecTool(o *options) func(ctx context.Context, msg *schema.Message) (map[string]any, error) {
+	return func(ctx context.Context, msg *schema.Message) (map[string]any, error) {
+		return execTool(ctx, msg, o)
+	}
+}
+
+// 调用工具节点，结果按调用ID的顺序合并，保证每次合并的结果一致
+// 需要审批的调用在执行任何调用之前中断，恢复后整轮调用重新执行
+// 超出工具输出限制的结果和异常信息会被截断，省略的token数记录在 truncateKey 中
+func execTool(ctx context.Context, msg *schema.Message, o *options) (map[string]any, error) {
 	results := make(map[string]any)
 	results[errKey] = make(map[string]string)
-	if len(msg.ToolCalls) > 0 {
-		for _, call := range msg.ToolCalls {
-			t := tool.GetTool(call.Function.Name)
-			if t == nil {
-				results[errKey].(map[string]string)[call.Function.Name] = "tool not found"
-				continue
-			}
-			result, err := t.InvokableRun(ctx, call.Function.Arguments)
-			if err != nil {
-				results[errKey].(map[string]string)[call.Function.Name] = err.Error()
+	stats := make(redact.Stats)
+	results[redactKey] = stats
+	retries := make(map[string]int)
+	results[retryKey] = retries
+	truncated := make(map[string]int)
+	results[truncateKey] = truncated
+
+	// 从审批中断恢复时整轮调用重新执行，请求事件在中断前已经发送过
+	resumed := msg == nil
+	msg, decisions := restoreApproval(ctx, msg)
+	// 记录本轮调用工具的模型，回退链可能使用了备用模型
+	if backend := agentmodel.BackendOf(msg); backend != "" {
+		results[modelKey] = backend
+	}
+	calls := append([]schema.ToolCall{}, msg.ToolCalls...)
+	sort.SliceStable(calls, func(i, j int) bool { return calls[i].ID < calls[j].ID })
+	if !resumed {
+		for _, call := range calls {
+			emit(ctx, Event{Type: EventToolRequested, Tool: newToolEvent(call)})
+		}
+	}
+	calls, denied, err := reviewCalls(ctx, msg, calls, decisions)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]callOutput, len(calls))
+
+	concurrency := o.toolConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err, ok := denied[call.ID]; ok {
+				outputs[i] = callOutput{err: err}
 			} else {
-				results[call.Function.Name] = result
+				emit(ctx, Event{Type: EventToolStarted, Tool: newToolEvent(call)})
+				start := time.Now()
+				outputs[i] = invokeTool(ctx, call)
+				outputs[i].duration = time.Since(start)
 			}
+			emitToolFinished(ctx, call, outputs[i])
+		}()
+	}
+	wg.Wait()
+
+	keys := callKeys(calls)
+	for i, call := range calls {
+		out := outputs[i]
+		if impl.IsHostKeyMismatch(out.err) {
+			// 主机密钥不一致时可能存在中间人攻击，直接终止诊断且不再重试
+			return nil, fmt.Errorf("工具 %s 主机密钥校验失败: %w", call.Function.Name, out.err)
+		}
+		if out.attempts > 1 {
+			retries[keys[i]] = out.attempts - 1
+		}
+		// 工具输出会进入提示词，去除其中出现的凭据和敏感数据，并截断到工具的输出限制
+		limit := outputLimit(call.Function.Name, o)
+		if out.err != nil {
+			masked, s := tool.Redact(call.Function.Name, secret.Mask(out.err.Error()))
+			stats.Add(s)
+			masked, dropped := truncateTokens(masked, limit.MaxTokens, limit.Keep)
+			if dropped > 0 {
+				truncated[keys[i]] = dropped
+			}
+			if out.attempts > 1 {
+				masked = fmt.Sprintf("%s（共尝试%d次）", masked, out.attempts)
+			}
+			results[errKey].(map[string]string)[keys[i]] = masked
+		} else {
+			masked, s := tool.Redact(call.Function.Name, secret.Mask(out.result))
+			stats.Add(s)
+			masked, dropped := truncateTokens(masked, limit.MaxTokens, limit.Keep)
+			if dropped > 0 {
+				truncated[keys[i]] = dropped
+			}
+			results[keys[i]] = masked
 		}
 	}
 
 	return results, nil
 }
 
-func extractReportVar(ctx context.Context, input *schema.Message) (output map[string]any, err error) {
-	output = make(map[string]any)
-	if input.Content == finishLabel {
-		output[finishLabel] = true
+func invokeTool(ctx context.Context, call schema.ToolCall) callOutput {
+	t := tool.GetTool(call.Function.Name)
+	if t == nil {
+		return callOutput{err: errors.New("tool not found")}
+	}
+	attempts := 1
+	result, err := t.InvokableRun(ctx, call.Function.Arguments, impl.WithAttempts(&attempts))
+	return callOutput{result: result, err: err, attempts: attempts}
+}
+
+// newToolEvent 工具调用事件，参数中出现的凭据会被掩码
+func newToolEvent(call schema.ToolCall) *ToolEvent {
+	return &ToolEvent{CallID: call.ID, Name: call.Function.Name, Arguments: secret.Mask(call.Function.Arguments)}
+}
+
+// emitToolFinished 发送工具调用结束事件，错误信息与进入提示词的一样经过脱敏
+func emitToolFinished(ctx context.Context, call schema.ToolCall, out callOutput) {
+	ev := newToolEvent(call)
+	ev.Duration = out.duration
+	ev.ExitStatus = impl.ExitStatus(out.err)
+	ev.Attempts = out.attempts
+	if out.err != nil {
+		ev.Error, _ = tool.Redact(call.Function.Name, secret.Mask(out.err.Error()))
 	}
-	return output, nil
+	emit(ctx, Event{Type: EventToolFinished, Tool: ev})
+}
+
+// callKeys 生成每个调用结果的key，同一工具被多次调用时附带参数区分
+// 参数也相同的调用按出现顺序附带序号，避免结果、异常和重试次数互相覆盖
+func callKeys(calls []schema.ToolCall) []string {
+	count := make(map[string]int)
+	for _, call := range calls {
+		count[call.Function.Name]++
+	}
+	seen := make(map[string]int)
+	keys := make([]string, len(calls))
+	for i, call := range calls {
+		key := call.Function.Name
+		if count[call.Function.Name] > 1 {
+			key = fmt.Sprintf("%s(%s)", call.Function.Name, strings.TrimSpace(call.Function.Arguments))
+		}
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			key = fmt.Sprintf("%s#%d", key, n)
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+// toolNameOfKey 从调用结果的key中取出工具名称
+func toolNameOfKey(key string) string {
+	name, _, _ := strings.Cut(key, "(")
+	name, _, _ = strings.Cut(name, "#")
+	return name
 }
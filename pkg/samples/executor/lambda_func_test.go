@@ -0,0 +1,151 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-samples/pkg/playbook"
+	"agent-samples/pkg/tool"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func initTestTools(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(strings.ReplaceAll(`
+local_tools:
+  - toolName: "shell"
+    authConfig:
+      type: "none"
+    execTemplates:
+      - name: "slow_echo"
+        description: "延迟后回显"
+        exec: "sleep 0.3 && echo {{.msg}}"
+        parameters:
+          - name: "msg"
+            required: true
+      - name: "fail"
+        description: "执行失败"
+        exec: "echo failed >&2 && exit 1"
+      - name: "restart_pod"
+        description: "重启Pod"
+        exec: "echo restarted {{.pod}}"
+        requires_approval: true
+        parameters:
+          - name: "pod"
+            required: true
+      - name: "flaky"
+        description: "第一次执行时连接被重置"
+        exec: "if [ ! -f TESTDIR/flaky ]; then touch TESTDIR/flaky; echo 'read: connection reset by peer' >&2; exit 1; fi; echo recovered"
+        retry:
+          maxAttempts: 3
+          initialBackoff: 10
+      - name: "unreachable"
+        description: "连接始终被拒绝"
+        exec: "echo 'dial tcp 10.0.0.1:6443: connect: connection refused' >&2; exit 1"
+        retry:
+          maxAttempts: 3
+          initialBackoff: 10
+      - name: "long_log"
+        description: "输出较长的日志"
+        exec: "seq 1 2000"
+        maxOutputTokens: 100
+        keep: "tail"
+`, "TESTDIR", dir)), 0o644))
+	require.NoError(t, tool.InitTool(path))
+	t.Cleanup(func() { _ = tool.Close() })
+}
+
+func toolCall(id, name, args string) schema.ToolCall {
+	return schema.ToolCall{ID: id, Function: schema.FunctionCall{Name: name, Arguments: args}}
+}
+
+func TestExecToolRunsCallsConcurrently(t *testing.T) {
+	initTestTools(t)
+	msg := schema.AssistantMessage("", []schema.ToolCall{
+		toolCall("call_3", "slow_echo", `{"msg": "c"}`),
+		toolCall("call_1", "slow_echo", `{"msg": "a"}`),
+		toolCall("call_2", "fail", `{}`),
+		toolCall("call_4", "missing", `{}`),
+	})
+
+	start := time.Now()
+	out, err := execTool(context.Background(), msg, newOptions(WithToolConcurrency(4)))
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 550*time.Millisecond)
+
+	// 同一工具多次调用时按参数区分结果
+	assert.Equal(t, "a\n", out[`slow_echo({"msg": "a"})`])
+	assert.Equal(t, "c\n", out[`slow_echo({"msg": "c"})`])
+	errInfo := out[errKey].(map[string]string)
+	assert.Contains(t, errInfo["fail"], "exit status 1")
+	assert.Equal(t, "tool not found", errInfo["missing"])
+
+	// 状态中按工具名称移除待执行工具
+	state := playbook.NewStepState(&playbook.PlayBook{Steps: []playbook.Step{
+		{Name: "echo", ToolList: []string{"slow_echo", "fail"}},
+	}}, playbook.StepPath{0}, nil)
+	res, err := toolStateHandle(context.Background(), out, state)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"fail": true}, res[callKey])
+	assert.Len(t, state.CallResult, 2)
+}
+
+func TestCallKeysAreUnique(t *testing.T) {
+	keys := callKeys([]schema.ToolCall{
+		toolCall("call_1", "get_pods", `{}`),
+		toolCall("call_2", "get_pods", `{}`),
+		toolCall("call_3", "get_pods", `{"ns": "a"}`),
+		toolCall("call_4", "get_nodes", `{}`),
+	})
+	assert.Equal(t, []string{`get_pods({})`, `get_pods({})#2`, `get_pods({"ns": "a"})`, "get_nodes"}, keys)
+	for _, key := range keys[:3] {
+		assert.Equal(t, "get_pods", toolNameOfKey(key))
+	}
+}
+
+func TestExecToolConcurrencyLimit(t *testing.T) {
+	initTestTools(t)
+	msg := schema.AssistantMessage("", []schema.ToolCall{
+		toolCall("call_1", "slow_echo", `{"msg": "a"}`),
+		toolCall("call_2", "slow_echo", `{"msg": "b"}`),
+	})
+
+	start := time.Now()
+	_, err := execTool(context.Background(), msg, newOptions(WithToolConcurrency(1)))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 600*time.Millisecond)
+}
+
+func TestExecToolRecordsRetries(t *testing.T) {
+	initTestTools(t)
+	msg := schema.AssistantMessage("", []schema.ToolCall{
+		toolCall("call_1", "flaky", `{}`),
+		toolCall("call_2", "unreachable", `{}`),
+		toolCall("call_3", "fail", `{}`),
+	})
+
+	out, err := execTool(context.Background(), msg, newOptions(WithToolConcurrency(3)))
+	require.NoError(t, err)
+	assert.Equal(t, "recovered\n", out["flaky"])
+	errInfo := out[errKey].(map[string]string)
+	assert.Contains(t, errInfo["unreachable"], "（共尝试3次）")
+	assert.NotContains(t, errInfo["fail"], "共尝试")
+	assert.Equal(t, map[string]int{"flaky": 1, "unreachable": 2}, out[retryKey])
+
+	state := playbook.NewStepState(&playbook.PlayBook{Steps: []playbook.Step{
+		{Name: "retry", ToolList: []string{"flaky", "unreachable", "fail"}},
+	}}, playbook.StepPath{0}, nil)
+	_, err = toolStateHandle(context.Background(), out, state)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"flaky": 1, "unreachable": 2}, state.Retries)
+	assert.NotContains(t, state.CallResult, retryKey)
+}
@@ -0,0 +1,91 @@
+package executor
+
+import "github.com/cloudwego/eino/compose"
+
+const (
+	// defaultToolConcurrency 同一轮模型输出中工具调用的默认并发数
+	defaultToolConcurrency = 4
+	// defaultMaxStepTurns 步骤中模型调用工具的默认最大轮次
+	defaultMaxStepTurns = 5
+	// defaultMaxToolFailures 步骤中单个工具的默认最大失败次数
+	defaultMaxToolFailures = 2
+	// defaultPromptTokens 单个模型节点提示词的默认token预算，适配上下文较小的本地模型
+	defaultPromptTokens = 6000
+	// defaultToolOutputTokens 未配置输出限制的工具，单次输出的默认最大token数
+	defaultToolOutputTokens = 1500
+	// defaultHistoryTokens 调用工具时执行记录的默认token预算，超出后压缩较早的记录
+	defaultHistoryTokens = 2000
+)
+
+// Option Buildplaybook 的可选配置
+type Option func(*options)
+
+type options struct {
+	toolConcurrency int
+	maxStepTurns    int
+	maxToolFailures int
+
+	promptTokens     int
+	toolOutputTokens int
+	historyTokens    int
+
+	checkPointStore compose.CheckPointStore // 配置后每个步骤结束时保存检查点，由 Runner 设置
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		toolConcurrency: defaultToolConcurrency,
+		maxStepTurns:    defaultMaxStepTurns,
+		maxToolFailures: defaultMaxToolFailures,
+
+		promptTokens:     defaultPromptTokens,
+		toolOutputTokens: defaultToolOutputTokens,
+		historyTokens:    defaultHistoryTokens,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithToolConcurrency 设置同一轮模型输出中工具调用的最大并发数，小于1时串行执行
+func WithToolConcurrency(n int) Option {
+	return func(o *options) {
+		o.toolConcurrency = n
+	}
+}
+
+// WithMaxStepTurns 设置步骤中模型调用工具的默认最大轮次，步骤配置了max_turns时以步骤为准
+func WithMaxStepTurns(n int) Option {
+	return func(o *options) {
+		o.maxStepTurns = n
+	}
+}
+
+// WithMaxToolFailures 设置步骤中单个工具的默认最大失败次数，步骤配置了max_tool_failures时以步骤为准
+func WithMaxToolFailures(n int) Option {
+	return func(o *options) {
+		o.maxToolFailures = n
+	}
+}
+
+// WithPromptTokens 设置单个模型节点提示词的token预算，超出时进一步截断工具结果和执行记录，为0时不限制
+func WithPromptTokens(n int) Option {
+	return func(o *options) {
+		o.promptTokens = n
+	}
+}
+
+// WithToolOutputTokens 设置工具单次输出的默认最大token数，工具配置了maxOutputTokens时以工具为准，为0时不限制
+func WithToolOutputTokens(n int) Option {
+	return func(o *options) {
+		o.toolOutputTokens = n
+	}
+}
+
+// WithHistoryTokens 设置调用工具时执行记录的token预算，超出后压缩较早的记录，为0时不限制
+func WithHistoryTokens(n int) Option {
+	return func(o *options) {
+		o.historyTokens = n
+	}
+}
@@ -2,65 +2,269 @@ package executor
 
 import (
 	"context"
+	"fmt"
 	"log"
 
+	agentmodel "agent-samples/pkg/model"
 	"agent-samples/pkg/playbook"
 
-	"github.com/cloudwego/eino-ext/components/model/openai"
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
 )
 
 const (
-	errKey  = "errInfo"
-	callKey = "callInfo"
+	errKey       = "errInfo"
+	callKey      = "callInfo"
+	redactKey    = "redactInfo"
+	retryKey     = "retryInfo"
+	modelKey     = "modelInfo"
+	truncateKey  = "truncateInfo"
+	stepInputKey = "stepInput"
+	analysisKey  = "analysis"
+	reaskKey     = "reask"
 
 	finishLabel = "finish"
 
+	// maxStalledTurns 模型连续多少轮未调用任何工具时放弃剩余工具
+	maxStalledTurns = 2
+	// maxAnalysisAttempts 分析结果无法解析时最多请求分析模型的次数，超过后保留原始输出
+	maxAnalysisAttempts = 3
+	// maxStepVisits 顺序执行时同一步骤最多执行的次数，结论回退到之前的步骤时避免无限循环
+	maxStepVisits = 3
+
 	promptVarNode        = "PromptVarNode"
+	stepStartNode        = "stepStartNode"
+	skipStepNode         = "skipStepNode"
 	templateNode         = "templateNode"
 	toolLLM              = "toolLLM"
 	execToolNode         = "execToolNode"
-	analysisVarNode      = "analysisVarNode"
 	analysisTemplateNode = "analysisTemplateNode"
 	analysisLLM          = "analysisLLM"
-	reportVarNode        = "reportVarNode"
+	analysisParseNode    = "analysisParseNode"
+	stepEndNode          = "stepEndNode"
+	stepNode             = "stepNode"
 	reportTemplateNode   = "reportTemplateNode"
 	reportLLM            = "reportLLM"
 	Playbook             = "playbook"
 )
 
-func Buildplaybook(ctx context.Context, book *playbook.PlayBook) (r compose.Runnable[playbook.PlayBook, *schema.Message], err error) {
+// stepInput 步骤子图的输入
+type stepInput struct {
+	Book    *playbook.PlayBook
+	Path    playbook.StepPath
+	History []playbook.Record
+	Skip    string // 不为空时跳过该步骤，内容为跳过原因
+}
+
+// stepResult 步骤子图的输出
+type stepResult struct {
+	Record  playbook.Record
+	Verdict *playbook.Verdict
+	Skipped bool
+}
+
+// stepResultKey 步骤结果在输出中的key，并行的步骤汇合时不会冲突
+func stepResultKey(path playbook.StepPath) string {
+	return "stepResult_" + path.String()
+}
+
+// dagStepNode 并行执行时步骤节点的key
+func dagStepNode(index int) string {
+	return fmt.Sprintf("step_%d", index)
+}
+
+// Buildplaybook 构建运维方案的执行图
+// 未配置depends_on的方案逐个执行步骤，配置后按依赖关系并行执行，每个步骤都是一个独立状态的子图
+func Buildplaybook(ctx context.Context, book *playbook.PlayBook, opts ...Option) (r compose.Runnable[playbook.PlayBook, *schema.Message], err error) {
+	models, err := newStepModels(ctx, book)
+	if err != nil {
+		return nil, err
+	}
+	return buildPlaybook(ctx, book, models, newOptions(opts...))
+}
+
+func buildPlaybook(ctx context.Context, book *playbook.PlayBook, models *stepModels, o *options) (compose.Runnable[playbook.PlayBook, *schema.Message], error) {
 	g := compose.NewGraph[playbook.PlayBook, *schema.Message](compose.WithGenLocalState(func(ctx context.Context) (state *playbook.State) {
-		callmap := make(map[string]bool)
-		if len(book.Steps) > 0 {
-			for _, tool := range book.Steps[0].ToolList {
-				callmap[tool] = true
-			}
-		}
 		return &playbook.State{
-			Current:    0,
-			PlayBook:   book,
-			History:    make([]playbook.Record, 0),
-			StepCall:   callmap,
-			CallResult: make(map[string]string),
-			ErrorInfo:  make(map[string]string),
+			Current:  playbook.StepPath{0},
+			PlayBook: book,
+			History:  make([]playbook.Record, 0),
+			Halted:   make(map[string]bool),
 		}
 	}))
-	// 阶段1 工具诊断: 根据当前步骤、执行历史、工具调用信息调用工具
-	// 从playbook、state中提取上下文参数
+	// 从playbook中提取上下文参数
 	g.AddLambdaNode(promptVarNode, compose.InvokableLambda(extractTemplateVariables))
-	// 构建上下文节点
+
+	// 根据执行记录生成诊断报告
+	reportTemplate, err := newReportChatTemplate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	g.AddChatTemplateNode(reportTemplateNode, reportTemplate, compose.WithStatePreHandler(newState2ReportPrompt(o)))
+	g.AddChatModelNode(reportLLM, models.reportModel, compose.WithNodeName(reportLLM)) // 节点名称用于区分模型输出事件
+	_ = g.AddEdge(compose.START, promptVarNode)
+	_ = g.AddEdge(reportTemplateNode, reportLLM)
+	_ = g.AddEdge(reportLLM, compose.END)
+
+	if book.IsDAG() {
+		return buildDAG(ctx, g, book, models, o)
+	}
+	return buildSequential(ctx, g, book, models, o)
+}
+
+// buildSequential 逐个执行步骤，步骤结束后根据结论决定下一个步骤
+func buildSequential(ctx context.Context, g *compose.Graph[playbook.PlayBook, *schema.Message], book *playbook.PlayBook, models *stepModels, o *options) (compose.Runnable[playbook.PlayBook, *schema.Message], error) {
+	if len(book.Steps) == 0 {
+		_ = g.AddEdge(promptVarNode, reportTemplateNode)
+		return g.Compile(ctx, compileOptions(o, nil, compose.WithMaxRunSteps(100))...)
+	}
+
+	step, err := buildStepGraph(ctx, models, o)
+	if err != nil {
+		return nil, err
+	}
+	g.AddGraphNode(stepNode, step,
+		compose.WithGraphCompileOptions(compose.WithGraphName(stepNode), compose.WithMaxRunSteps(stepMaxRunSteps(book, o))),
+		compose.WithStatePreHandler(state2StepInput),
+		compose.WithStatePostHandler(sequentialStepHandle))
+	// 没有剩余步骤或结束排查时进入诊断报告生成阶段
+	br := compose.NewGraphBranch(func(ctx context.Context, in map[string]any) (endNode string, err error) {
+		if _, ok := in[finishLabel]; ok {
+			return reportTemplateNode, nil
+		}
+		return stepNode, nil
+	}, map[string]bool{stepNode: true, reportTemplateNode: true})
+
+	_ = g.AddEdge(promptVarNode, stepNode)
+	g.AddBranch(stepNode, br)
+	return g.Compile(ctx, compileOptions(o, []string{stepNode}, compose.WithMaxRunSteps(100))...)
+}
+
+// buildDAG 按depends_on连接步骤，没有依赖关系的步骤并行执行，所有步骤结束后生成报告
+func buildDAG(ctx context.Context, g *compose.Graph[playbook.PlayBook, *schema.Message], book *playbook.PlayBook, models *stepModels, o *options) (compose.Runnable[playbook.PlayBook, *schema.Message], error) {
+	for i := range book.Steps {
+		step, err := buildStepGraph(ctx, models, o)
+		if err != nil {
+			return nil, err
+		}
+		key := dagStepNode(i)
+		g.AddGraphNode(key, step,
+			compose.WithGraphCompileOptions(compose.WithGraphName(key), compose.WithMaxRunSteps(stepMaxRunSteps(book, o))),
+			compose.WithStatePreHandler(dagStepInput(i)),
+			compose.WithStatePostHandler(dagStepHandle))
+	}
+
+	index := make(map[string]int, len(book.Steps))
+	for i := range book.Steps {
+		index[book.Steps[i].StepID()] = i
+	}
+	for i := range book.Steps {
+		step := &book.Steps[i]
+		if len(step.DependsOn) == 0 {
+			_ = g.AddEdge(promptVarNode, dagStepNode(i))
+		}
+		for _, dep := range step.DependsOn {
+			_ = g.AddEdge(dagStepNode(index[dep]), dagStepNode(i))
+		}
+		if len(book.Dependents(step.StepID())) == 0 {
+			_ = g.AddEdge(dagStepNode(i), reportTemplateNode)
+		}
+	}
+
+	stepNodes := make([]string, 0, len(book.Steps))
+	for i := range book.Steps {
+		stepNodes = append(stepNodes, dagStepNode(i))
+	}
+	// 所有前驱节点结束后才执行，DAG模式不支持设置最大步数
+	return g.Compile(ctx, compileOptions(o, stepNodes, compose.WithNodeTriggerMode(compose.AllPredecessor))...)
+}
+
+// compileOptions 执行图的编译选项，配置了检查点存储时在每个步骤节点结束后中断以保存检查点
+func compileOptions(o *options, stepNodes []string, opts ...compose.GraphCompileOption) []compose.GraphCompileOption {
+	opts = append(opts, compose.WithGraphName(Playbook))
+	if o.checkPointStore != nil {
+		opts = append(opts, compose.WithCheckPointStore(o.checkPointStore))
+		if len(stepNodes) > 0 {
+			opts = append(opts, compose.WithInterruptAfterNodes(stepNodes))
+		}
+	}
+	return opts
+}
+
+// stepMaxRunSteps 步骤子图的最大步数，每轮工具调用经过模板、模型、工具三个节点
+// 轮次预算会在达到此上限之前结束工具调用，此上限仅作为兜底
+func stepMaxRunSteps(book *playbook.PlayBook, o *options) int {
+	turns := o.maxStepTurns
+	book.Walk(func(path playbook.StepPath, step *playbook.Step) bool {
+		if step.MaxTurns > turns {
+			turns = step.MaxTurns
+		}
+		return true
+	})
+	return 3*turns + 10
+}
+
+// newStepModels 按全局模型配置创建执行图使用的模型，运维方案配置了models时按角色覆盖
+func newStepModels(ctx context.Context, book *playbook.PlayBook) (*stepModels, error) {
+	toolModel, err := newToolModel(ctx, book)
+	if err != nil {
+		return nil, err
+	}
+	analysisModel, err := agentmodel.ForRole(ctx, agentmodel.RoleAnalysis, book.Models.Analysis)
+	if err != nil {
+		return nil, fmt.Errorf("创建分析模型失败: %w", err)
+	}
+	reportModel, err := agentmodel.ForRole(ctx, agentmodel.RoleReport, book.Models.Report)
+	if err != nil {
+		return nil, fmt.Errorf("创建报告模型失败: %w", err)
+	}
+	return &stepModels{
+		toolModel:     toolModel,
+		analysisModel: analysisModel,
+		reportModel:   reportModel,
+	}, nil
+}
+
+// stepModels 执行图使用的模型，各步骤子图共用
+type stepModels struct {
+	toolModel     model.ToolCallingChatModel
+	analysisModel model.ToolCallingChatModel
+	reportModel   model.ToolCallingChatModel
+}
+
+// buildStepGraph 构建单个步骤的子图：调用工具直到没有剩余工具，再分析当前步骤的执行结果
+func buildStepGraph(ctx context.Context, models *stepModels, o *options) (*compose.Graph[map[string]any, map[string]any], error) {
+	g := compose.NewGraph[map[string]any, map[string]any](compose.WithGenLocalState(func(ctx context.Context) *playbook.StepState {
+		return &playbook.StepState{}
+	}))
+	g.AddLambdaNode(stepStartNode, compose.InvokableLambda(func(ctx context.Context, in map[string]any) (map[string]any, error) {
+		return in, nil
+	}), compose.WithStatePreHandler(newInitStepState(o)))
+	// 依赖的步骤结束排查时直接跳过
+	g.AddLambdaNode(skipStepNode, compose.InvokableLambda(func(ctx context.Context, in map[string]any) (map[string]any, error) {
+		input := in[stepInputKey].(*stepInput)
+		step := input.Book.StepAt(input.Path)
+		return map[string]any{stepResultKey(input.Path): &stepResult{
+			Record:  playbook.Record{Path: input.Path, Step: step.Name, Details: step.Details, Result: input.Skip},
+			Skipped: true,
+		}}, nil
+	}))
+	br0 := compose.NewGraphBranch(func(ctx context.Context, in map[string]any) (endNode string, err error) {
+		if input, ok := in[stepInputKey].(*stepInput); ok && input.Skip != "" {
+			return skipStepNode, nil
+		}
+		return templateNode, nil
+	}, map[string]bool{skipStepNode: true, templateNode: true})
+
+	// 阶段1 工具诊断: 根据当前步骤、执行历史、工具调用信息调用工具
 	templateNodeKeyOfChatTemplate, err := newChatTemplate(ctx)
 	if err != nil {
 		return nil, err
 	}
-	g.AddChatTemplateNode(templateNode, templateNodeKeyOfChatTemplate, compose.WithStatePreHandler(state2ExecPrompt))
-	// 构建llm节点和执行工具节点
-	chatModel := NewChatModelByBook(book)
-	g.AddChatModelNode(toolLLM, chatModel)
-	g.AddLambdaNode(execToolNode, compose.InvokableLambda(execTool), compose.WithStatePostHandler(toolStateHandle)) //输出map[string]any,在post钩子更新state的异常信息、工具调用结果、涉及工具列表
+	g.AddChatTemplateNode(templateNode, templateNodeKeyOfChatTemplate, compose.WithStatePreHandler(newState2ExecPrompt(o)))
+	g.AddChatModelNode(toolLLM, models.toolModel, compose.WithNodeName(toolLLM))
+	g.AddLambdaNode(execToolNode, compose.InvokableLambda(newExecTool(o)), compose.WithStatePostHandler(toolStateHandle)) //输出map[string]any,在post钩子更新state的异常信息、工具调用结果、涉及工具列表
 	// 分叉节点，判断是否还存在剩余工具，不存在则分析当前步骤执行结果
 	br1 := compose.NewGraphBranch(func(ctx context.Context, in map[string]any) (endNode string, err error) {
 		if callInfo, ok := in[callKey]; ok {
@@ -76,85 +280,60 @@ func Buildplaybook(ctx context.Context, book *playbook.PlayBook) (r compose.Runn
 	}, map[string]bool{templateNode: true, analysisTemplateNode: true})
 
 	// 阶段2 调用结果分析：根据调用结果、历史记录提炼当前步骤的诊断结果
-	// 构建llm用于分析当前阶段的执行过程，提取出精练的执行结果
 	analysisTemplate, err := newAnalaysisChatTemplate(ctx)
-	g.AddChatTemplateNode(analysisTemplateNode, analysisTemplate, compose.WithStatePreHandler(state2AnalysisPrompt))
 	if err != nil {
 		return nil, err
 	}
-	analysisModel := NewChatModel()
-	// 更新state中的curindex和历史执行结果
-	g.AddChatModelNode(analysisLLM, analysisModel, compose.WithStatePostHandler(analysisResultHandle))
-
-	// 阶段三：根据执行记录生成诊断报告
-	g.AddLambdaNode(reportVarNode, compose.InvokableLambda(extractReportVar))
-	// 更新完后若没有剩余步骤则进入诊断报告生成阶段
+	g.AddChatTemplateNode(analysisTemplateNode, analysisTemplate, compose.WithStatePreHandler(newState2AnalysisPrompt(o)))
+	g.AddChatModelNode(analysisLLM, models.analysisModel, compose.WithNodeName(analysisLLM))
+	// 解析结构化的分析结果，无法解析时带上错误原因重新请求分析模型
+	g.AddLambdaNode(analysisParseNode, compose.InvokableLambda(func(ctx context.Context, msg *schema.Message) (map[string]any, error) {
+		return map[string]any{analysisKey: msg}, nil
+	}), compose.WithStatePostHandler(analysisStateHandle))
 	br2 := compose.NewGraphBranch(func(ctx context.Context, in map[string]any) (endNode string, err error) {
-		if _, ok := in[finishLabel]; ok {
-			return reportTemplateNode, nil
+		if reask, _ := in[reaskKey].(bool); reask {
+			return analysisTemplateNode, nil
 		}
-		return templateNode, nil
-	}, map[string]bool{templateNode: true, reportTemplateNode: true})
-	reportTemplate, err := newReportChatTemplate(ctx)
-	if err != nil {
-		return nil, err
-	}
-	g.AddChatTemplateNode(reportTemplateNode, reportTemplate, compose.WithStatePreHandler(state2ExecPrompt))
-	reportModel := NewChatModel()
-	g.AddChatModelNode(reportLLM, reportModel)
+		return stepEndNode, nil
+	}, map[string]bool{analysisTemplateNode: true, stepEndNode: true})
+	// 将分析结果整理为执行记录
+	g.AddLambdaNode(stepEndNode, compose.InvokableLambda(func(ctx context.Context, in map[string]any) (map[string]any, error) {
+		return in, nil
+	}), compose.WithStatePostHandler(stepResultHandle))
 
-	// 构建图、添加节点和边
-	_ = g.AddEdge(compose.START, promptVarNode)
-	_ = g.AddEdge(promptVarNode, templateNode)
+	_ = g.AddEdge(compose.START, stepStartNode)
+	g.AddBranch(stepStartNode, br0)
 	_ = g.AddEdge(templateNode, toolLLM)
 	_ = g.AddEdge(toolLLM, execToolNode)
 	g.AddBranch(execToolNode, br1)
 	_ = g.AddEdge(analysisTemplateNode, analysisLLM)
-	_ = g.AddEdge(analysisLLM, reportVarNode)
-	g.AddBranch(reportVarNode, br2)
-	_ = g.AddEdge(reportTemplateNode, reportLLM)
-	_ = g.AddEdge(reportLLM, compose.END)
-
-	r, err = g.Compile(ctx, compose.WithGraphName("playbook"), compose.WithMaxRunSteps(100))
-	if err != nil {
-		return nil, err
-	}
-
-	return r, err
+	_ = g.AddEdge(analysisLLM, analysisParseNode)
+	g.AddBranch(analysisParseNode, br2)
+	_ = g.AddEdge(stepEndNode, compose.END)
+	_ = g.AddEdge(skipStepNode, compose.END)
+	return g, nil
 }
 
-func NewChatModelByBook(book *playbook.PlayBook) model.ToolCallingChatModel {
-	cm, err := openai.NewChatModel(context.Background(), &openai.ChatModelConfig{
-		Model:   "qwen3",
-		BaseURL: "http://127.0.0.1:11434/v1",
-	})
+// newToolModel 创建调用工具的模型，并绑定运维方案涉及的工具
+func newToolModel(ctx context.Context, book *playbook.PlayBook) (model.ToolCallingChatModel, error) {
+	cm, err := agentmodel.ForRole(ctx, agentmodel.RoleTool, book.Models.Tool)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("创建工具模型失败: %w", err)
 	}
 
 	toolInfos := make([]*schema.ToolInfo, 0)
 	tools := book.GetTools()
 	for _, t := range tools {
-		toolInfo, err := t.Info(context.TODO())
+		toolInfo, err := t.Info(ctx)
 		if err != nil {
 			log.Printf("获取工具信息失败: %v", err)
 			continue
 		}
 		toolInfos = append(toolInfos, toolInfo)
 	}
-	cm.WithTools(toolInfos)
-
-	return cm
-}
-
-func NewChatModel() model.ToolCallingChatModel {
-	cm, err := openai.NewChatModel(context.Background(), &openai.ChatModelConfig{
-		Model:   "qwen3",
-		BaseURL: "http://127.0.0.1:11434/v1",
-	})
-	if err != nil {
-		log.Fatal(err)
+	// 没有可用的工具时不绑定，模型只能给出文本回复
+	if len(toolInfos) == 0 {
+		return cm, nil
 	}
-
-	return cm
+	return cm.WithTools(toolInfos)
 }
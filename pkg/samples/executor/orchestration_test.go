@@ -2,19 +2,31 @@ package executor
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
+	"agent-samples/pkg/checkpoint"
+	agentmodel "agent-samples/pkg/model"
 	"agent-samples/pkg/playbook"
 
-	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+func TestMain(m *testing.M) {
+	if err := agentmodel.Init("../../../config/model/models.yaml"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
 func TestBuildplaybook(t *testing.T) {
 	ctx := context.Background()
 
@@ -44,27 +56,22 @@ func TestBuildplaybook(t *testing.T) {
 	graph, err := Buildplaybook(ctx, mockPlaybook)
 	require.NoError(t, err)
 	assert.NotNil(t, graph)
-	// invoke调用
-	// result, err := graph.Invoke(ctx, *mockPlaybook)
-	// assert.NoError(t, err)
-	// assert.NotEmpty(t, result)
 
 	// 流式执行
-	msgChan := make(chan *schema.Message, 10)
-	callback := NewModelCallback(msgChan)
-
-	output, err := graph.Stream(ctx, *mockPlaybook, compose.WithCallbacks(callback).DesignateNode("toolLLM", "analysisLLM", "reportLLM"))
-	for msg := range msgChan {
-		fmt.Print(msg)
-	}
-	chunk, revErr := output.Recv()
-	if revErr != nil {
-		if !errors.Is(revErr, io.EOF) {
-			t.Error(revErr)
+	store, err := checkpoint.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	runner, err := NewRunner(ctx, mockPlaybook, store)
+	require.NoError(t, err)
+	for ev := range runner.RunEvents(ctx, checkpoint.NewRunID()) {
+		switch ev.Type {
+		case EventLLMDelta:
+			fmt.Print(ev.LLM.Delta)
+		case EventRunFailed:
+			t.Error(ev.Error)
+		case EventRunCompleted:
+			t.Log(ev.Report)
 		}
 	}
-	t.Log(chunk)
-
 }
 
 func TestBuildplaybookWithEmptySteps(t *testing.T) {
@@ -168,3 +175,185 @@ func TestBuildplaybookWithHistory(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, result)
 }
+
+func TestBuildplaybookDAG(t *testing.T) {
+	ctx := context.Background()
+
+	// 节点和Pod的检查并行执行，汇总依赖两者
+	mockPlaybook := &playbook.PlayBook{
+		Name:   "DAG Playbook",
+		Middle: "Test Middleware",
+		Steps: []playbook.Step{
+			{Id: "nodes", Name: "检查节点", ToolList: []string{"get_nodes"}},
+			{Id: "pods", Name: "检查Pod", ToolList: []string{"get_pods"}},
+			{Id: "summary", Name: "汇总", DependsOn: []string{"nodes", "pods"}},
+		},
+	}
+	require.True(t, mockPlaybook.IsDAG())
+
+	graph, err := Buildplaybook(ctx, mockPlaybook)
+	require.NoError(t, err)
+	assert.NotNil(t, graph)
+}
+
+func TestNewStepModelsUsesPlaybookModels(t *testing.T) {
+	initTestTools(t)
+	var req struct {
+		Model string `json:"model"`
+		Tools []struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tools"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req.Tools = nil
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"1","object":"chat.completion","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer srv.Close()
+
+	cfg := agentmodel.GetConfig()
+	t.Cleanup(func() { agentmodel.SetConfig(cfg) })
+	agentmodel.SetConfig(&agentmodel.Config{
+		Providers: []agentmodel.Provider{{Name: "test", BaseURL: srv.URL}},
+		Models: []agentmodel.ModelConfig{
+			{Name: "small", Provider: "test", Model: "small-model"},
+			{Name: "large", Provider: "test", Model: "large-model"},
+		},
+		Roles: map[string]string{agentmodel.RoleDefault: "small"},
+	})
+
+	book := &playbook.PlayBook{
+		Name:   "echo",
+		Middle: "shell",
+		Models: playbook.Models{Tool: "large"},
+		Steps:  []playbook.Step{{Name: "echo", ToolList: []string{"slow_echo", "fail"}}},
+	}
+	models, err := newStepModels(context.Background(), book)
+	require.NoError(t, err)
+
+	// 工具模型使用运维方案配置的模型，并绑定方案涉及的工具
+	_, err = models.toolModel.Generate(context.Background(), []*schema.Message{schema.UserMessage("ping")})
+	require.NoError(t, err)
+	assert.Equal(t, "large-model", req.Model)
+	names := make([]string, 0, len(req.Tools))
+	for _, tool := range req.Tools {
+		names = append(names, tool.Function.Name)
+	}
+	assert.ElementsMatch(t, []string{"slow_echo", "fail"}, names)
+
+	// 未覆盖的角色使用全局配置
+	_, err = models.reportModel.Generate(context.Background(), []*schema.Message{schema.UserMessage("ping")})
+	require.NoError(t, err)
+	assert.Equal(t, "small-model", req.Model)
+	assert.Empty(t, req.Tools)
+
+	book.Models.Analysis = "missing"
+	_, err = newStepModels(context.Background(), book)
+	assert.ErrorContains(t, err, "模型不存在: missing")
+}
+
+// fakeChatModel 按输入消息生成回复的模型，用于不依赖大模型地执行整个图
+type fakeChatModel struct {
+	reply func(input []*schema.Message) *schema.Message
+}
+
+func (m *fakeChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	return m.reply(input), nil
+}
+
+func (m *fakeChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return schema.StreamReaderFromArray([]*schema.Message{m.reply(input)}), nil
+}
+
+func (m *fakeChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+// newFakeModels 分析模型对包含 stop 的步骤给出结束排查的结论，报告模型返回执行历史
+func newFakeModels() *stepModels {
+	return &stepModels{
+		toolModel: &fakeChatModel{reply: func(input []*schema.Message) *schema.Message {
+			return schema.AssistantMessage("", nil)
+		}},
+		analysisModel: &fakeChatModel{reply: func(input []*schema.Message) *schema.Message {
+			if strings.Contains(input[0].Content, "stop") {
+				return schema.AssistantMessage(`{"status": "critical", "summary": "异常", "findings": [{"summary": "集群异常", "evidence": ["stop"]}], "outcome": 1}`, nil)
+			}
+			return schema.AssistantMessage(analysisJSON("正常", 0), nil)
+		}},
+		reportModel: &fakeChatModel{reply: func(input []*schema.Message) *schema.Message {
+			return schema.AssistantMessage(input[0].Content, nil)
+		}},
+	}
+}
+
+func TestRunDAGPlaybook(t *testing.T) {
+	ctx := context.Background()
+	book := &playbook.PlayBook{
+		Name:   "DAG Playbook",
+		Middle: "Test Middleware",
+		Steps: []playbook.Step{
+			{Id: "nodes", Name: "检查节点", Details: "nodes"},
+			{Id: "pods", Name: "检查Pod", Details: "pods stop", Outcomes: []playbook.Outcome{{On: "集群异常", Stop: true}}},
+			{Id: "logs", Name: "检查日志", Details: "logs", DependsOn: []string{"pods"}},
+			{Id: "summary", Name: "汇总", Details: "summary", DependsOn: []string{"nodes", "logs"}},
+		},
+	}
+	require.NoError(t, book.Validate())
+
+	graph, err := buildPlaybook(ctx, book, newFakeModels(), newOptions())
+	require.NoError(t, err)
+	report, err := graph.Invoke(ctx, *book)
+	require.NoError(t, err)
+
+	assert.Contains(t, report.Content, "检查节点")
+	assert.Contains(t, report.Content, "不再执行依赖该步骤的步骤")
+	// 依赖结束排查的步骤及其后续步骤都不会执行
+	assert.Contains(t, report.Content, "3 检查日志")
+	assert.Contains(t, report.Content, "4 汇总")
+}
+
+func TestRunSequentialPlaybook(t *testing.T) {
+	ctx := context.Background()
+	book := &playbook.PlayBook{
+		Name:   "Sequential Playbook",
+		Middle: "Test Middleware",
+		Steps: []playbook.Step{
+			{Name: "检查节点", Details: "nodes"},
+			{Name: "检查Pod", Details: "pods stop", Outcomes: []playbook.Outcome{{On: "集群异常", Stop: true}}},
+			{Name: "检查日志", Details: "logs"},
+		},
+	}
+
+	graph, err := buildPlaybook(ctx, book, newFakeModels(), newOptions())
+	require.NoError(t, err)
+	report, err := graph.Invoke(ctx, *book)
+	require.NoError(t, err)
+
+	assert.Contains(t, report.Content, "结论「集群异常」，结束排查")
+	assert.Contains(t, report.Content, "3 检查日志")
+}
+
+func TestRunPlaybookStepBudget(t *testing.T) {
+	ctx := context.Background()
+	// 模型从不调用步骤中的工具，步骤达到预算后标记为未完成并继续执行
+	book := &playbook.PlayBook{
+		Name:   "Budget Playbook",
+		Middle: "Test Middleware",
+		Steps: []playbook.Step{
+			{Name: "检查节点", Details: "nodes", ToolList: []string{"get_nodes"}},
+			{Name: "检查Pod", Details: "pods"},
+		},
+	}
+
+	graph, err := buildPlaybook(ctx, book, newFakeModels(), newOptions())
+	require.NoError(t, err)
+	report, err := graph.Invoke(ctx, *book)
+	require.NoError(t, err)
+
+	assert.Contains(t, report.Content, "**未完成：** 模型连续2轮未调用任何工具，未调用的工具: get_nodes")
+	assert.Contains(t, report.Content, "### 2 检查Pod")
+}
@@ -0,0 +1,150 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"agent-samples/pkg/playbook"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+func init() {
+	// 步骤子图的输入输出会保存在检查点中
+	schema.RegisterName[*stepInput]("agent_samples_step_input")
+	schema.RegisterName[*stepResult]("agent_samples_step_result")
+}
+
+// ErrRunNotFound 恢复执行时找不到对应的检查点
+var ErrRunNotFound = errors.New("run not found")
+
+// checkPointDeleter 支持删除检查点的存储，执行完成后清理检查点
+type checkPointDeleter interface {
+	Delete(ctx context.Context, id string) error
+}
+
+// Runner 带检查点的运维方案执行器
+// 每个步骤结束后以执行id保存检查点，进程崩溃或重启后可以从最后完成的步骤继续执行
+type Runner struct {
+	book  *playbook.PlayBook
+	graph compose.Runnable[playbook.PlayBook, *schema.Message]
+	store compose.CheckPointStore
+}
+
+// NewRunner 构建运维方案的执行图并启用检查点
+func NewRunner(ctx context.Context, book *playbook.PlayBook, store compose.CheckPointStore, opts ...Option) (*Runner, error) {
+	models, err := newStepModels(ctx, book)
+	if err != nil {
+		return nil, err
+	}
+	return newRunner(ctx, book, store, models, newOptions(opts...))
+}
+
+func newRunner(ctx context.Context, book *playbook.PlayBook, store compose.CheckPointStore, models *stepModels, o *options) (*Runner, error) {
+	o.checkPointStore = store
+	graph, err := buildPlaybook(ctx, book, models, o)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{book: book, graph: graph, store: store}, nil
+}
+
+// Run 以指定的执行id开始新的执行，忽略该id已有的检查点
+func (r *Runner) Run(ctx context.Context, runID string, opts ...compose.Option) (*schema.Message, error) {
+	return r.run(ctx, runID, true, nil, opts...)
+}
+
+// Resume 从执行id的检查点继续执行，已完成的步骤不会重复执行
+func (r *Runner) Resume(ctx context.Context, runID string, opts ...compose.Option) (*schema.Message, error) {
+	return r.resume(ctx, runID, nil, opts...)
+}
+
+// ResumeWithDecisions 提交审批结果并继续执行，decisions的key为审批请求的InterruptID
+func (r *Runner) ResumeWithDecisions(ctx context.Context, runID string, decisions map[string]Decisions, opts ...compose.Option) (*schema.Message, error) {
+	return r.resume(ctx, runID, resumeData(decisions), opts...)
+}
+
+// RunEvents 在后台开始新的执行，返回执行事件通道
+// 最后一个事件为 run_completed、run_failed 或 interrupted，之后通道关闭；调用方需要读到通道关闭或取消 ctx
+func (r *Runner) RunEvents(ctx context.Context, runID string, opts ...compose.Option) <-chan Event {
+	return streamEvents(ctx, runID, func(ctx context.Context) (*schema.Message, error) {
+		return r.run(ctx, runID, true, nil, append(opts, compose.WithCallbacks(newLLMEventCallback()))...)
+	})
+}
+
+// ResumeEvents 在后台继续执行，返回执行事件通道，decisions 为空时直接从检查点恢复
+func (r *Runner) ResumeEvents(ctx context.Context, runID string, decisions map[string]Decisions, opts ...compose.Option) <-chan Event {
+	return streamEvents(ctx, runID, func(ctx context.Context) (*schema.Message, error) {
+		return r.resume(ctx, runID, resumeData(decisions), append(opts, compose.WithCallbacks(newLLMEventCallback()))...)
+	})
+}
+
+func resumeData(decisions map[string]Decisions) map[string]any {
+	if len(decisions) == 0 {
+		return nil
+	}
+	data := make(map[string]any, len(decisions))
+	for id, d := range decisions {
+		data[id] = d
+	}
+	return data
+}
+
+func (r *Runner) resume(ctx context.Context, runID string, resumeData map[string]any, opts ...compose.Option) (*schema.Message, error) {
+	_, existed, err := r.store.Get(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	if !existed {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, runID)
+	}
+	return r.run(ctx, runID, false, resumeData, opts...)
+}
+
+// run 每个步骤结束时图会中断并写入检查点，随后立即从检查点继续，直到执行完成或出现其他中断
+// 只有第一次执行会忽略已有的检查点或携带审批结果，之后都只从检查点恢复，避免审批结果被后续的中断复用
+func (r *Runner) run(ctx context.Context, runID string, forceNew bool, resumeData map[string]any, opts ...compose.Option) (*schema.Message, error) {
+	opts = append(opts, compose.WithCheckPointID(runID))
+	for first := true; ; first = false {
+		runCtx, runOpts := ctx, opts
+		if first && forceNew {
+			runOpts = append(append([]compose.Option{}, opts...), compose.WithForceNewRun())
+		}
+		if first && resumeData != nil {
+			runCtx = compose.BatchResumeWithData(ctx, resumeData)
+		}
+		out, err := r.stream(runCtx, runOpts...)
+		if err == nil {
+			if deleter, ok := r.store.(checkPointDeleter); ok {
+				if err := deleter.Delete(ctx, runID); err != nil {
+					return nil, err
+				}
+			}
+			return out, nil
+		}
+		if !isStepCheckpoint(err) {
+			return nil, err
+		}
+	}
+}
+
+// stream 以流式方式执行，模型节点逐个输出增量，返回合并后的报告
+func (r *Runner) stream(ctx context.Context, opts ...compose.Option) (*schema.Message, error) {
+	sr, err := r.graph.Stream(ctx, *r.book, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer sr.Close()
+	return schema.ConcatMessageStream(sr)
+}
+
+// isStepCheckpoint 判断中断是否只是步骤结束后保存检查点，等待审批等其他中断返回给调用方
+func isStepCheckpoint(err error) bool {
+	info, ok := compose.ExtractInterruptInfo(err)
+	if !ok || len(ApprovalRequests(err)) > 0 {
+		return false
+	}
+	return len(info.AfterNodes) > 0 && len(info.BeforeNodes) == 0 && len(info.RerunNodes) == 0
+}
@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"agent-samples/pkg/checkpoint"
+	"agent-samples/pkg/playbook"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crashingChatModel 分析到指定步骤时返回错误，模拟执行中途崩溃，并记录分析过的步骤
+type crashingChatModel struct {
+	mu       sync.Mutex
+	crashOn  string
+	analyzed []string
+}
+
+func (m *crashingChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	content := input[0].Content
+	if m.crashOn != "" && strings.Contains(content, m.crashOn) {
+		m.crashOn = ""
+		return nil, errors.New("connection reset")
+	}
+	for _, step := range []string{"nodes", "pods", "logs"} {
+		if strings.Contains(content, step) {
+			m.analyzed = append(m.analyzed, step)
+		}
+	}
+	return schema.AssistantMessage(analysisJSON("正常", 0), nil), nil
+}
+
+func (m *crashingChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := m.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+}
+
+func (m *crashingChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func testResume(t *testing.T, book *playbook.PlayBook) {
+	ctx := context.Background()
+	store, err := checkpoint.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	analysis := &crashingChatModel{crashOn: "logs"}
+	models := newFakeModels()
+	models.analysisModel = analysis
+	runner, err := newRunner(ctx, book, store, models, newOptions())
+	require.NoError(t, err)
+
+	runID := checkpoint.NewRunID()
+	_, err = runner.Run(ctx, runID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection reset")
+	assert.ElementsMatch(t, []string{"nodes", "pods"}, analysis.analyzed)
+
+	// 模拟进程重启：使用新的执行器从检查点恢复，已完成的步骤不会再次分析
+	analysis.analyzed = nil
+	runner, err = newRunner(ctx, book, store, models, newOptions())
+	require.NoError(t, err)
+	report, err := runner.Resume(ctx, runID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"logs"}, analysis.analyzed)
+	for _, step := range []string{"检查节点", "检查Pod", "检查日志"} {
+		assert.Contains(t, report.Content, step)
+	}
+
+	// 执行完成后清理检查点
+	_, err = runner.Resume(ctx, runID)
+	assert.ErrorIs(t, err, ErrRunNotFound)
+}
+
+func TestRunnerResumeSequential(t *testing.T) {
+	testResume(t, &playbook.PlayBook{
+		Name:   "Sequential Playbook",
+		Middle: "Test Middleware",
+		Steps: []playbook.Step{
+			{Name: "检查节点", Details: "nodes"},
+			{Name: "检查Pod", Details: "pods"},
+			{Name: "检查日志", Details: "logs"},
+		},
+	})
+}
+
+func TestRunnerResumeDAG(t *testing.T) {
+	testResume(t, &playbook.PlayBook{
+		Name:   "DAG Playbook",
+		Middle: "Test Middleware",
+		Steps: []playbook.Step{
+			{Id: "nodes", Name: "检查节点", Details: "nodes"},
+			{Id: "pods", Name: "检查Pod", Details: "pods"},
+			{Id: "logs", Name: "检查日志", Details: "logs", DependsOn: []string{"nodes", "pods"}},
+		},
+	})
+}
@@ -1,29 +1,49 @@
 package executor
 
 import (
+	agentmodel "agent-samples/pkg/model"
 	"agent-samples/pkg/playbook"
 	"agent-samples/pkg/prompt"
+	"agent-samples/pkg/redact"
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/cloudwego/eino/schema"
 )
 
-func state2ExecPrompt(ctx context.Context, out map[string]any, state *playbook.State) (map[string]any, error) {
-	if out == nil {
-		out = make(map[string]any)
-	}
-	statebook := state.PlayBook
+// newState2ExecPrompt 生成调用工具的提示词变量，执行记录和工具结果超出预算时使用截断后的副本，并记录被省略的内容
+func newState2ExecPrompt(o *options) func(ctx context.Context, out map[string]any, state *playbook.StepState) (map[string]any, error) {
+	return func(ctx context.Context, out map[string]any, state *playbook.StepState) (map[string]any, error) {
+		if out == nil {
+			out = make(map[string]any)
+		}
 
-	out[prompt.Middleware] = statebook.Middle
-	out[prompt.TaskGoal] = statebook.Steps[state.Current].Details
-	out[prompt.ExecutionHistory] = state.History
-	out[prompt.Tools] = state.StepCall
-	out[prompt.ExecutedTools] = state.CallResult
-	out[prompt.ErrorInfo] = state.ErrorInfo
-	return out, nil
+		history, notes := compactHistory(state.History, o.historyTokens)
+		addDropped(state, notes)
+		results := state.CallResult
+		if o.promptTokens > 0 {
+			// 提示词中工具结果以外的部分
+			fixed := estimateTokens(prompt.SystemPlaybook+prompt.UserPlaybook+state.Middle+state.Target+state.Step.Details) +
+				historyTokens(history) + mapTokens(state.ErrorInfo) + mapTokens(state.Inputs)
+			results, notes = fitResults(state.CallResult, o.promptTokens-fixed, o)
+			addDropped(state, notes)
+		}
+
+		out[prompt.Middleware] = state.Middle
+		out[prompt.Target] = state.Target
+		out[prompt.Inputs] = state.Inputs
+		out[prompt.TaskGoal] = state.Step.Details
+		out[prompt.ExecutionHistory] = history
+		out[prompt.Tools] = state.StepCall
+		out[prompt.ExecutedTools] = results
+		out[prompt.ErrorInfo] = state.ErrorInfo
+		return out, nil
+	}
 }
 
-func toolStateHandle(ctx context.Context, out map[string]any, state *playbook.State) (map[string]any, error) {
+func toolStateHandle(ctx context.Context, out map[string]any, state *playbook.StepState) (map[string]any, error) {
 	result := make(map[string]any)
 	// 记录执行错误的工具到state中
 	if errInfo, ok := out["errInfo"]; ok {
@@ -32,50 +52,370 @@ func toolStateHandle(ctx context.Context, out map[string]any, state *playbook.St
 		}
 	}
 	delete(out, "errInfo")
+	// 累计当前步骤的脱敏统计
+	if stats, ok := out[redactKey].(redact.Stats); ok {
+		for name, count := range stats {
+			state.Redacted[name] += count
+		}
+	}
+	delete(out, redactKey)
+	// 累计当前步骤各工具调用的重试次数
+	if retries, ok := out[retryKey].(map[string]int); ok {
+		for key, count := range retries {
+			state.Retries[key] += count
+		}
+	}
+	delete(out, retryKey)
+	if backend, ok := out[modelKey].(string); ok {
+		recordModel(state.Models, toolLLM, backend)
+	}
+	delete(out, modelKey)
+	if truncated, ok := out[truncateKey].(map[string]int); ok {
+		notes := make(map[string]string, len(truncated))
+		for key, dropped := range truncated {
+			notes["tool:"+key] = fmt.Sprintf("工具 %s 的输出过长，省略约%d个token", key, dropped)
+		}
+		addDropped(state, notes)
+	}
+	delete(out, truncateKey)
 	for toolName, res := range out {
 		state.CallResult[toolName] = res.(string)
 	}
 
 	// 从待执行工具列表中删除已成功调用的工具
-	for name, _ := range out {
-		delete(state.StepCall, name)
+	for key := range out {
+		delete(state.StepCall, toolNameOfKey(key))
 	}
+	checkStepBudget(state, len(out)+len(state.ErrorInfo) == 0)
 	result[callKey] = state.StepCall
 
 	return result, nil
 }
 
-func state2AnalysisPrompt(ctx context.Context, out map[string]any, state *playbook.State) (map[string]any, error) {
-	if out == nil {
-		out = make(map[string]any)
+// recordModel 记录模型节点实际使用的模型，同一节点的多轮调用使用了不同模型时全部记录
+func recordModel(models map[string]string, node, backend string) {
+	if backend == "" || models == nil {
+		return
+	}
+	used := models[node]
+	for _, name := range strings.Split(used, ",") {
+		if name == backend {
+			return
+		}
 	}
-	statebook := state.PlayBook
+	if used != "" {
+		used += ","
+	}
+	models[node] = used + backend
+}
 
-	out[prompt.TaskGoal] = statebook.Steps[state.Current].Details
-	out[prompt.ExecutedTools] = state.CallResult
-	return out, nil
+// checkStepBudget 统计本轮的工具调用，超出预算时放弃剩余的工具并记录原因，避免步骤无限循环
+// 预算为0时不限制
+func checkStepBudget(state *playbook.StepState, stalled bool) {
+	state.Turns++
+	if stalled {
+		state.Stalled++
+	} else {
+		state.Stalled = 0
+	}
+
+	for key := range state.ErrorInfo {
+		name := toolNameOfKey(key)
+		state.Failures[name]++
+		if state.StepCall[name] && state.MaxToolFailures > 0 && state.Failures[name] >= state.MaxToolFailures {
+			delete(state.StepCall, name)
+			state.Incomplete = append(state.Incomplete, fmt.Sprintf("工具 %s 失败%d次", name, state.Failures[name]))
+		}
+	}
+	if len(state.StepCall) == 0 {
+		return
+	}
+
+	var reason string
+	switch {
+	case state.MaxTurns > 0 && state.Turns >= state.MaxTurns:
+		reason = fmt.Sprintf("已达到最大轮次%d", state.MaxTurns)
+	case state.Stalled >= maxStalledTurns:
+		reason = fmt.Sprintf("模型连续%d轮未调用任何工具", state.Stalled)
+	default:
+		return
+	}
+	pending := make([]string, 0, len(state.StepCall))
+	for name := range state.StepCall {
+		pending = append(pending, name)
+	}
+	sort.Strings(pending)
+	state.Incomplete = append(state.Incomplete, fmt.Sprintf("%s，未调用的工具: %s", reason, strings.Join(pending, ", ")))
+	state.StepCall = make(map[string]bool)
 }
 
-func analysisResultHandle(ctx context.Context, out *schema.Message, state *playbook.State) (*schema.Message, error) {
-	state.Current += 1
-	// 将分析结果作为当前步骤的诊断结论记录到state中
-	state.History = append(state.History, playbook.Record{
-		Details: state.PlayBook.Steps[state.Current-1].Details,
-		Result:  out.Content,
-	})
+// newState2AnalysisPrompt 生成步骤分析的提示词变量，工具结果超出预算时使用截断后的副本
+func newState2AnalysisPrompt(o *options) func(ctx context.Context, out map[string]any, state *playbook.StepState) (map[string]any, error) {
+	return func(ctx context.Context, out map[string]any, state *playbook.StepState) (map[string]any, error) {
+		if out == nil {
+			out = make(map[string]any)
+		}
 
-	if state.Current >= len(state.PlayBook.Steps) {
-		out.Content = finishLabel
-	} else {
-		// 初始化当前步骤待执行工具
-		for _, tool := range state.PlayBook.Steps[state.Current].ToolList {
-			state.StepCall[tool] = true
+		outcomes := make([]string, 0, len(state.Step.Outcomes))
+		for i, outcome := range state.Step.Outcomes {
+			outcomes = append(outcomes, fmt.Sprintf("%d. %s", i+1, outcome.On))
+		}
+		incomplete := strings.Join(state.Incomplete, "；")
+		results := state.CallResult
+		if o.promptTokens > 0 {
+			fixed := estimateTokens(prompt.StepAnalysisTemplate + state.Step.Details + incomplete + strings.Join(outcomes, ""))
+			var notes map[string]string
+			results, notes = fitResults(state.CallResult, o.promptTokens-fixed, o)
+			addDropped(state, notes)
+		}
+
+		out[prompt.TaskGoal] = state.Step.Details
+		out[prompt.ExecutedTools] = results
+		out[prompt.Outcomes] = outcomes
+		out[prompt.Incomplete] = incomplete
+		out[prompt.InvalidAnalysis] = state.AnalysisError
+		return out, nil
+	}
+}
+
+// newInitStepState 根据步骤子图的输入初始化步骤状态，步骤未配置预算时使用默认值
+func newInitStepState(o *options) func(ctx context.Context, in map[string]any, state *playbook.StepState) (map[string]any, error) {
+	return func(ctx context.Context, in map[string]any, state *playbook.StepState) (map[string]any, error) {
+		input, ok := in[stepInputKey].(*stepInput)
+		if !ok {
+			return nil, fmt.Errorf("missing step input")
+		}
+		*state = *playbook.NewStepState(input.Book, input.Path, input.History)
+		if input.Skip == "" {
+			emit(ctx, Event{Type: EventStepStarted, Step: &StepEvent{Path: input.Path.String(), Name: state.Step.Name}})
+		}
+		if state.MaxTurns == 0 {
+			state.MaxTurns = o.maxStepTurns
+		}
+		if state.MaxToolFailures == 0 {
+			state.MaxToolFailures = o.maxToolFailures
+		}
+		return in, nil
+	}
+}
+
+// analysisStateHandle 解析分析模型的输出，无法解析时记录原因并重新请求，达到次数上限后保留原始输出
+func analysisStateHandle(ctx context.Context, out map[string]any, state *playbook.StepState) (map[string]any, error) {
+	msg, ok := out[analysisKey].(*schema.Message)
+	if !ok {
+		return nil, fmt.Errorf("missing analysis result")
+	}
+	recordModel(state.Models, analysisLLM, agentmodel.BackendOf(msg))
+	state.AnalysisAttempts++
+
+	analysis, err := playbook.ParseAnalysis(msg.Content, len(state.Step.Outcomes))
+	switch {
+	case err == nil:
+		state.Analysis = analysis
+		state.AnalysisError = ""
+	case state.AnalysisAttempts < maxAnalysisAttempts:
+		state.AnalysisError = err.Error()
+		return map[string]any{reaskKey: true}, nil
+	default:
+		state.Analysis = playbook.FallbackAnalysis(msg.Content, err)
+	}
+	return map[string]any{}, nil
+}
+
+// stepResultHandle 将分析结果整理为步骤的执行记录，作为步骤子图的输出
+func stepResultHandle(ctx context.Context, out map[string]any, state *playbook.StepState) (map[string]any, error) {
+	analysis := state.Analysis
+	if analysis == nil {
+		return nil, fmt.Errorf("missing analysis result")
+	}
+	// 分析模型在结果中给出结论，据此决定跳转、跳过或提前结束
+	result := &stepResult{
+		Record: playbook.Record{
+			Path:       state.Path,
+			Step:       state.Step.Name,
+			Details:    state.Step.Details,
+			Result:     analysis.Format(),
+			Analysis:   analysis,
+			Incomplete: strings.Join(state.Incomplete, "；"),
+			Redacted:   state.Redacted,
+			Retries:    state.Retries,
+			Models:     state.Models,
+			Dropped:    droppedNotes(state.Dropped),
+		},
+		Verdict: analysis.Verdict(),
+	}
+	return map[string]any{stepResultKey(state.Path): result}, nil
+}
+
+// state2StepInput 顺序执行时，以当前步骤作为步骤子图的输入
+func state2StepInput(ctx context.Context, in map[string]any, state *playbook.State) (map[string]any, error) {
+	return map[string]any{stepInputKey: &stepInput{
+		Book:    state.PlayBook,
+		Path:    state.Current,
+		History: append([]playbook.Record{}, state.History...),
+	}}, nil
+}
+
+// sequentialStepHandle 记录步骤结果并计算下一个步骤，没有后续步骤时进入报告阶段
+func sequentialStepHandle(ctx context.Context, out map[string]any, state *playbook.State) (map[string]any, error) {
+	result, err := takeStepResult(out)
+	if err != nil {
+		return nil, err
+	}
+
+	transition := state.PlayBook.NextStep(state.Current, result.Verdict)
+	result.Record.Decision = describeTransition(state.PlayBook, state.Current, transition)
+	if !transition.Stop && stepVisits(state, transition.Next) >= maxStepVisits {
+		// 结论反复回到同一步骤时结束排查，使用已有结果生成报告
+		transition.Stop = true
+		result.Record.Decision = fmt.Sprintf("%s；步骤 %s 已执行%d次，结束排查",
+			result.Record.Decision, state.PlayBook.StepAt(transition.Next).Name, maxStepVisits)
+	}
+	state.History = append(state.History, result.Record)
+	emitStepFinished(ctx, result)
+
+	if transition.Stop {
+		state.Finished = true
+		return map[string]any{finishLabel: true}, nil
+	}
+	state.Current = transition.Next
+	return map[string]any{}, nil
+}
+
+// stepVisits 顺序执行时步骤已执行的次数，包括当前刚结束的步骤
+func stepVisits(state *playbook.State, path playbook.StepPath) int {
+	visits := 0
+	if path.Equal(state.Current) {
+		visits++
+	}
+	for _, r := range state.History {
+		if r.Path.Equal(path) {
+			visits++
+		}
+	}
+	return visits
+}
+
+// dagStepInput 并行执行时步骤的输入，依赖的步骤结束排查或被跳过时跳过该步骤
+func dagStepInput(index int) func(ctx context.Context, in map[string]any, state *playbook.State) (map[string]any, error) {
+	return func(ctx context.Context, in map[string]any, state *playbook.State) (map[string]any, error) {
+		input := &stepInput{
+			Book:    state.PlayBook,
+			Path:    playbook.StepPath{index},
+			History: append([]playbook.Record{}, state.History...),
+		}
+		for _, dep := range state.PlayBook.Steps[index].DependsOn {
+			if state.Halted[dep] {
+				input.Skip = fmt.Sprintf("依赖的步骤 %s 已结束排查或被跳过", dep)
+				break
+			}
 		}
+		return map[string]any{stepInputKey: input}, nil
+	}
+}
+
+// dagStepHandle 记录并行步骤的结果，结束排查或被跳过的步骤会阻止依赖它的步骤执行
+func dagStepHandle(ctx context.Context, out map[string]any, state *playbook.State) (map[string]any, error) {
+	result, err := takeStepResult(out)
+	if err != nil {
+		return nil, err
+	}
+
+	step := state.PlayBook.StepAt(result.Record.Path)
+	if result.Skipped {
+		state.Halted[step.StepID()] = true
+		emitStepFinished(ctx, result)
+		return out, nil
 	}
 
+	transition := state.PlayBook.NextStep(result.Record.Path, result.Verdict)
+	if transition.Outcome != nil && transition.Outcome.Stop {
+		state.Halted[step.StepID()] = true
+		result.Record.Decision = fmt.Sprintf("结论「%s」，不再执行依赖该步骤的步骤", transition.Outcome.On)
+	} else if transition.Outcome != nil {
+		result.Record.Decision = fmt.Sprintf("结论「%s」", transition.Outcome.On)
+	}
+	state.History = append(state.History, result.Record)
+	emitStepFinished(ctx, result)
 	return out, nil
 }
 
+// emitStepFinished 发送步骤结束事件
+func emitStepFinished(ctx context.Context, result *stepResult) {
+	ev := &StepEvent{
+		Path:     result.Record.Path.String(),
+		Name:     result.Record.Step,
+		Decision: result.Record.Decision,
+		Skipped:  result.Skipped,
+	}
+	if result.Record.Analysis != nil {
+		ev.Status = result.Record.Analysis.Status
+	}
+	emit(ctx, Event{Type: EventStepFinished, Step: ev})
+}
+
+func takeStepResult(out map[string]any) (*stepResult, error) {
+	for _, v := range out {
+		if result, ok := v.(*stepResult); ok {
+			return result, nil
+		}
+	}
+	return nil, fmt.Errorf("missing step result")
+}
+
+// newState2ReportPrompt 生成报告的提示词变量，执行记录超出预算时压缩较早的记录，压缩说明记录在状态中
+func newState2ReportPrompt(o *options) func(ctx context.Context, out map[string]any, state *playbook.State) (map[string]any, error) {
+	return func(ctx context.Context, out map[string]any, state *playbook.State) (map[string]any, error) {
+		if out == nil {
+			out = make(map[string]any)
+		}
+
+		executed := make(map[string]bool, len(state.History))
+		for _, record := range state.History {
+			executed[record.Step] = true
+		}
+		skipped := make([]string, 0)
+		state.PlayBook.Walk(func(path playbook.StepPath, step *playbook.Step) bool {
+			if !executed[step.Name] {
+				skipped = append(skipped, fmt.Sprintf("%s %s", path, step.Name))
+			}
+			return true
+		})
+
+		history := state.History
+		if o.promptTokens > 0 {
+			var notes map[string]string
+			history, notes = compactHistory(state.History, max(o.promptTokens-estimateTokens(prompt.ReportTemplate), 1))
+			state.Dropped = droppedNotes(notes)
+		}
+
+		out[prompt.Middleware] = state.PlayBook.Middle
+		out[prompt.Target] = state.PlayBook.Target
+		out[prompt.Inputs] = state.PlayBook.Inputs
+		out[prompt.ExecutionHistory] = history
+		out[prompt.SkippedSteps] = skipped
+		out[prompt.Dropped] = state.Dropped
+		return out, nil
+	}
+}
+
+// describeTransition 生成步骤流转说明，顺序执行时返回空
+func describeTransition(book *playbook.PlayBook, current playbook.StepPath, t playbook.Transition) string {
+	var reason string
+	if t.Outcome != nil {
+		reason = fmt.Sprintf("结论「%s」，", t.Outcome.On)
+	}
+	switch {
+	case t.Stop && book.NextPath(current) != nil:
+		return reason + "结束排查"
+	case t.Stop:
+		return strings.TrimSuffix(reason, "，")
+	case !t.Next.Equal(book.NextPath(current)) || t.Outcome != nil:
+		return reason + "进入" + book.StepAt(t.Next).Name
+	}
+	return ""
+}
+
 func deleteElement[T comparable](arr []T, element ...T) []T {
 	result := make([]T, 0)
 	for _, v := range arr {
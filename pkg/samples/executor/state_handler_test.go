@@ -0,0 +1,287 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	agentmodel "agent-samples/pkg/model"
+	"agent-samples/pkg/playbook"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestState() *playbook.State {
+	return &playbook.State{
+		PlayBook: &playbook.PlayBook{Name: "pods", Middle: "kubectl", Steps: []playbook.Step{
+			{Name: "检查Pod", ToolList: []string{"get_pods"}, Outcomes: []playbook.Outcome{
+				{On: "所有Pod正常", Stop: true},
+				{On: "存在异常Pod", Next: "检查日志"},
+			}},
+			{Name: "检查节点", ToolList: []string{"get_nodes"}},
+			{Name: "检查日志", ToolList: []string{"pod_logs"}},
+		}},
+		Current: playbook.StepPath{0},
+		Halted:  make(map[string]bool),
+	}
+}
+
+// analysisJSON 生成分析模型的结构化输出
+func analysisJSON(summary string, outcome int) string {
+	return fmt.Sprintf(`{"status": "ok", "summary": %q, "outcome": %d}`, summary, outcome)
+}
+
+// analyze 模拟分析阶段：解析分析模型的输出并生成步骤输出
+func analyze(t *testing.T, state *playbook.StepState, msg *schema.Message) map[string]any {
+	t.Helper()
+	out, err := analysisStateHandle(context.Background(), map[string]any{analysisKey: msg}, state)
+	require.NoError(t, err)
+	require.NotContains(t, out, reaskKey)
+	out, err = stepResultHandle(context.Background(), out, state)
+	require.NoError(t, err)
+	return out
+}
+
+// runStep 模拟步骤子图：由分析结果生成步骤输出
+func runStep(t *testing.T, book *playbook.PlayBook, path playbook.StepPath, analysis string) map[string]any {
+	t.Helper()
+	return analyze(t, playbook.NewStepState(book, path, nil), schema.AssistantMessage(analysis, nil))
+}
+
+func TestSequentialStepHandleStopsEarly(t *testing.T) {
+	state := newTestState()
+	out, err := sequentialStepHandle(context.Background(), runStep(t, state.PlayBook, state.Current, analysisJSON("全部Running", 1)), state)
+	require.NoError(t, err)
+
+	assert.Contains(t, out, finishLabel)
+	assert.True(t, state.Finished)
+	require.Len(t, state.History, 1)
+	assert.Equal(t, "状态：ok\n全部Running", state.History[0].Result)
+	assert.Equal(t, playbook.StatusOK, state.History[0].Analysis.Status)
+	assert.Equal(t, "结论「所有Pod正常」，结束排查", state.History[0].Decision)
+
+	prompt, err := newState2ReportPrompt(newOptions())(context.Background(), nil, state)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2 检查节点", "3 检查日志"}, prompt["SkippedSteps"])
+}
+
+func TestSequentialStepHandleJumps(t *testing.T) {
+	state := newTestState()
+	_, err := sequentialStepHandle(context.Background(), runStep(t, state.PlayBook, state.Current, analysisJSON("web异常", 2)), state)
+	require.NoError(t, err)
+
+	assert.Equal(t, playbook.StepPath{2}, state.Current)
+	assert.Equal(t, "结论「存在异常Pod」，进入检查日志", state.History[0].Decision)
+
+	// 下一个步骤的子图从新的步骤状态开始
+	in, err := state2StepInput(context.Background(), nil, state)
+	require.NoError(t, err)
+	input := in[stepInputKey].(*stepInput)
+	stepState := playbook.NewStepState(input.Book, input.Path, input.History)
+	assert.Equal(t, map[string]bool{"pod_logs": true}, stepState.StepCall)
+	assert.Len(t, stepState.History, 1)
+
+	// 最后一个步骤结束后生成报告
+	out, err := sequentialStepHandle(context.Background(), runStep(t, state.PlayBook, state.Current, analysisJSON("日志中有OOM", 0)), state)
+	require.NoError(t, err)
+	assert.Contains(t, out, finishLabel)
+	assert.Equal(t, []string{"检查Pod", "检查日志"}, []string{state.History[0].Step, state.History[1].Step})
+}
+
+func TestSequentialStepHandleLimitsVisits(t *testing.T) {
+	state := &playbook.State{
+		PlayBook: &playbook.PlayBook{Name: "loop", Middle: "kubectl", Steps: []playbook.Step{
+			{Name: "检查Pod", Outcomes: []playbook.Outcome{{On: "Pod仍在重启", Next: "检查Pod"}}},
+			{Name: "检查日志"},
+		}},
+		Current: playbook.StepPath{0},
+		Halted:  make(map[string]bool),
+	}
+
+	for i := 0; i < maxStepVisits-1; i++ {
+		out, err := sequentialStepHandle(context.Background(), runStep(t, state.PlayBook, state.Current, analysisJSON("web重启", 1)), state)
+		require.NoError(t, err)
+		assert.NotContains(t, out, finishLabel)
+		assert.Equal(t, playbook.StepPath{0}, state.Current)
+	}
+
+	// 达到执行次数上限后结束排查，而不是继续循环
+	out, err := sequentialStepHandle(context.Background(), runStep(t, state.PlayBook, state.Current, analysisJSON("web重启", 1)), state)
+	require.NoError(t, err)
+	assert.Contains(t, out, finishLabel)
+	assert.True(t, state.Finished)
+	require.Len(t, state.History, maxStepVisits)
+	assert.Equal(t, "结论「Pod仍在重启」，进入检查Pod；步骤 检查Pod 已执行3次，结束排查", state.History[maxStepVisits-1].Decision)
+}
+
+func TestDAGStepHandleSkipsDependents(t *testing.T) {
+	state := &playbook.State{
+		PlayBook: &playbook.PlayBook{Name: "dag", Middle: "kubectl", Steps: []playbook.Step{
+			{Id: "pods", Name: "检查Pod", Outcomes: []playbook.Outcome{{On: "集群不可用", Stop: true}}},
+			{Id: "nodes", Name: "检查节点"},
+			{Id: "logs", Name: "检查日志", DependsOn: []string{"pods"}},
+			{Id: "summary", Name: "汇总", DependsOn: []string{"logs", "nodes"}},
+		}},
+		Halted: make(map[string]bool),
+	}
+
+	_, err := dagStepHandle(context.Background(), runStep(t, state.PlayBook, playbook.StepPath{0}, analysisJSON("apiserver无响应", 1)), state)
+	require.NoError(t, err)
+	assert.True(t, state.Halted["pods"])
+	assert.Equal(t, "结论「集群不可用」，不再执行依赖该步骤的步骤", state.History[0].Decision)
+
+	_, err = dagStepHandle(context.Background(), runStep(t, state.PlayBook, playbook.StepPath{1}, analysisJSON("节点正常", 0)), state)
+	require.NoError(t, err)
+	assert.False(t, state.Halted["nodes"])
+
+	// 依赖结束排查的步骤被跳过，并继续向后传递
+	in, err := dagStepInput(2)(context.Background(), nil, state)
+	require.NoError(t, err)
+	input := in[stepInputKey].(*stepInput)
+	assert.Equal(t, "依赖的步骤 pods 已结束排查或被跳过", input.Skip)
+
+	skipped := map[string]any{stepResultKey(input.Path): &stepResult{Record: playbook.Record{Path: input.Path}, Skipped: true}}
+	_, err = dagStepHandle(context.Background(), skipped, state)
+	require.NoError(t, err)
+	assert.True(t, state.Halted["logs"])
+	assert.Len(t, state.History, 2)
+
+	in, err = dagStepInput(3)(context.Background(), nil, state)
+	require.NoError(t, err)
+	assert.NotEmpty(t, in[stepInputKey].(*stepInput).Skip)
+}
+
+func newBudgetState() *playbook.StepState {
+	state := playbook.NewStepState(&playbook.PlayBook{Steps: []playbook.Step{
+		{Name: "检查Pod", ToolList: []string{"get_pods", "pod_logs"}},
+	}}, playbook.StepPath{0}, nil)
+	state.MaxTurns = 3
+	state.MaxToolFailures = 2
+	return state
+}
+
+func TestToolStateHandleGivesUpFailingTool(t *testing.T) {
+	state := newBudgetState()
+	failed := func() map[string]any {
+		return map[string]any{errKey: map[string]string{"pod_logs": "exit status 1"}, "get_pods": "web Running"}
+	}
+
+	res, err := toolStateHandle(context.Background(), failed(), state)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"pod_logs": true}, res[callKey])
+	assert.Empty(t, state.Incomplete)
+
+	res, err = toolStateHandle(context.Background(), failed(), state)
+	require.NoError(t, err)
+	assert.Empty(t, res[callKey])
+	assert.Equal(t, []string{"工具 pod_logs 失败2次"}, state.Incomplete)
+}
+
+func TestToolStateHandleTurnBudget(t *testing.T) {
+	state := newBudgetState()
+	state.MaxTurns = 2
+	// 每轮只调用一个工具中的一部分，达到最大轮次后放弃剩余工具
+	_, err := toolStateHandle(context.Background(), map[string]any{errKey: map[string]string{}, "get_pods": "ok"}, state)
+	require.NoError(t, err)
+	res, err := toolStateHandle(context.Background(), map[string]any{errKey: map[string]string{}, "get_pods(x)": "ok"}, state)
+	require.NoError(t, err)
+
+	assert.Empty(t, res[callKey])
+	assert.Equal(t, []string{"已达到最大轮次2，未调用的工具: pod_logs"}, state.Incomplete)
+
+	out := analyze(t, state, schema.AssistantMessage(analysisJSON("信息不足", 0), nil))
+	assert.Equal(t, "已达到最大轮次2，未调用的工具: pod_logs", out[stepResultKey(state.Path)].(*stepResult).Record.Incomplete)
+}
+
+func TestToolStateHandleStalled(t *testing.T) {
+	state := newBudgetState()
+	for i := 0; i < maxStalledTurns; i++ {
+		_, err := toolStateHandle(context.Background(), map[string]any{errKey: map[string]string{}}, state)
+		require.NoError(t, err)
+	}
+	assert.Empty(t, state.StepCall)
+	assert.Equal(t, []string{"模型连续2轮未调用任何工具，未调用的工具: get_pods, pod_logs"}, state.Incomplete)
+}
+
+func TestStepRecordsModelBackends(t *testing.T) {
+	state := newBudgetState()
+	turn := func(backend, tool string) map[string]any {
+		return map[string]any{errKey: map[string]string{}, modelKey: backend, tool: "ok"}
+	}
+	_, err := toolStateHandle(context.Background(), turn("qwen3", "get_pods"), state)
+	require.NoError(t, err)
+	assert.NotContains(t, state.CallResult, modelKey)
+	// 第二轮主模型熔断，由回退模型调用工具
+	_, err = toolStateHandle(context.Background(), turn("deepseek-v3", "pod_logs"), state)
+	require.NoError(t, err)
+	_, err = toolStateHandle(context.Background(), turn("qwen3", "get_pods"), state)
+	require.NoError(t, err)
+
+	analysis := schema.AssistantMessage(analysisJSON("正常", 0), nil)
+	analysis.Extra = map[string]any{agentmodel.BackendKey: "qwen3"}
+	out := analyze(t, state, analysis)
+	record := out[stepResultKey(state.Path)].(*stepResult).Record
+	assert.Equal(t, map[string]string{toolLLM: "qwen3,deepseek-v3", analysisLLM: "qwen3"}, record.Models)
+}
+
+func TestAnalysisStateHandleReasks(t *testing.T) {
+	state := newBudgetState()
+	out, err := analysisStateHandle(context.Background(), map[string]any{analysisKey: schema.AssistantMessage(`{"status": "bad", "summary": "x"}`, nil)}, state)
+	require.NoError(t, err)
+	assert.Equal(t, true, out[reaskKey])
+	assert.Contains(t, state.AnalysisError, "status必须是")
+
+	// 重新请求时提示词中带上无法解析的原因
+	prompt, err := newState2AnalysisPrompt(newOptions())(context.Background(), nil, state)
+	require.NoError(t, err)
+	assert.Equal(t, state.AnalysisError, prompt["InvalidAnalysis"])
+
+	record := analyze(t, state, schema.AssistantMessage("```json\n"+analysisJSON("正常", 0)+"\n```", nil))[stepResultKey(state.Path)].(*stepResult).Record
+	assert.Equal(t, "正常", record.Analysis.Summary)
+	assert.Empty(t, state.AnalysisError)
+}
+
+func TestAnalysisStateHandleFallsBack(t *testing.T) {
+	state := newTestState()
+	stepState := playbook.NewStepState(state.PlayBook, state.Current, nil)
+	msg := schema.AssistantMessage("全部Running\n{\"outcome\": 1}", nil)
+	for i := 1; i < maxAnalysisAttempts; i++ {
+		out, err := analysisStateHandle(context.Background(), map[string]any{analysisKey: msg}, stepState)
+		require.NoError(t, err)
+		assert.Contains(t, out, reaskKey)
+	}
+
+	// 达到次数上限后保留原始输出，结论仍然生效
+	out := analyze(t, stepState, msg)
+	result := out[stepResultKey(state.Current)].(*stepResult)
+	assert.Equal(t, "全部Running", result.Record.Result)
+	assert.Equal(t, playbook.StatusInconclusive, result.Record.Analysis.Status)
+	assert.NotEmpty(t, result.Record.Analysis.Invalid)
+	assert.Equal(t, 1, result.Verdict.Outcome)
+}
+
+func TestExecPromptTarget(t *testing.T) {
+	book := &playbook.PlayBook{Middle: "kubectl", Target: "node-1", Inputs: map[string]string{"namespace": "prod"}, Steps: []playbook.Step{
+		{Name: "检查Pod", Details: "检查Pod状态", ToolList: []string{"get_pods"}},
+	}}
+	state := playbook.NewStepState(book, playbook.StepPath{0}, nil)
+	vars, err := newState2ExecPrompt(newOptions())(context.Background(), nil, state)
+	require.NoError(t, err)
+
+	tmpl, err := newChatTemplate(context.Background())
+	require.NoError(t, err)
+	msgs, err := tmpl.Format(context.Background(), vars)
+	require.NoError(t, err)
+	assert.Contains(t, msgs[0].Content, "# 诊断对象\nnode-1")
+	assert.Contains(t, msgs[0].Content, "- namespace: prod")
+
+	// 未指定诊断对象时不出现对应的段落
+	state = playbook.NewStepState(&playbook.PlayBook{Middle: "kubectl", Steps: book.Steps}, playbook.StepPath{0}, nil)
+	vars, err = newState2ExecPrompt(newOptions())(context.Background(), nil, state)
+	require.NoError(t, err)
+	msgs, err = tmpl.Format(context.Background(), vars)
+	require.NoError(t, err)
+	assert.NotContains(t, msgs[0].Content, "诊断对象")
+}
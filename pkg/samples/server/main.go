@@ -0,0 +1,82 @@
+package main
+
+import (
+	"agent-samples/pkg/checkpoint"
+	"agent-samples/pkg/model"
+	"agent-samples/pkg/playbook"
+	"agent-samples/pkg/server"
+	"agent-samples/pkg/tool"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "监听地址，默认只允许本机访问")
+	tokenFile := flag.String("token-file", "", "保存API bearer token的文件，未指定时读取环境变量 AGENT_SERVER_TOKEN")
+	toolConfig := flag.String("tools", "config/tool/tools.yaml", "工具配置文件")
+	modelConfig := flag.String("models", "config/model/models.yaml", "模型配置文件")
+	playbookDir := flag.String("playbooks", "config/playbook", "运维方案配置文件或目录")
+	checkpointDir := flag.String("checkpoints", "checkpoints", "检查点目录")
+	flag.Parse()
+
+	// API可以执行运维命令和审批危险操作，必须配置token
+	token := os.Getenv("AGENT_SERVER_TOKEN")
+	if *tokenFile != "" {
+		data, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		log.Fatal("未配置API token，使用 --token-file 或环境变量 AGENT_SERVER_TOKEN 指定")
+	}
+
+	// 初始化工具
+	if err := tool.InitTool(*toolConfig); err != nil {
+		log.Fatal(err)
+	}
+	defer tool.Close()
+
+	// 初始化模型配置
+	if err := model.Init(*modelConfig); err != nil {
+		log.Fatal(err)
+	}
+
+	// 从配置目录加载运维方案
+	registry, err := playbook.LoadRegistry(*playbookDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := checkpoint.NewFileStore(*checkpointDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := server.New(registry, store, token)
+	srv := &http.Server{Addr: *addr, Handler: s}
+	go func() {
+		<-ctx.Done()
+		// 先取消执行，事件流随执行结束而关闭
+		s.Close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
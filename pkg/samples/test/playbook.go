@@ -1,80 +1,67 @@
 package main
 
 import (
+	"agent-samples/pkg/checkpoint"
+	"agent-samples/pkg/model"
 	"agent-samples/pkg/playbook"
 	"agent-samples/pkg/samples/executor"
+	"agent-samples/pkg/tool"
 	"context"
-	"errors"
 	"fmt"
-	"io"
-
-	"github.com/cloudwego/eino/compose"
-	"github.com/cloudwego/eino/schema"
+	"os"
 )
 
 func main() {
 	ctx := context.Background()
 
-	// 创建 mock 的 playbook
-	mockPlaybook := &playbook.PlayBook{
-		Id:       1,
-		Name:     "Test Playbook",
-		TaskGoal: "测试执行目标",
-		Middle:   "Test Middleware",
-		Steps: []playbook.Step{
-			{
-				Name:      "Step 1",
-				Details:   "第一步详细信息",
-				ToolList:  []string{"tool1", "tool2"},
-				ToolCalls: []string{},
-			},
-			{
-				Name:      "Step 2",
-				Details:   "第二步详细信息",
-				ToolList:  []string{"tool3"},
-				ToolCalls: []string{},
-			},
-		},
+	// 初始化工具
+	if err := tool.InitTool("config/tool/tools.yaml"); err != nil {
+		panic(err)
 	}
+	defer tool.Close()
 
-	// 使用 Buildplaybook 构建图
-	graph, err := executor.Buildplaybook(ctx, mockPlaybook)
-	if err != nil {
+	// 初始化模型配置
+	if err := model.Init("config/model/models.yaml"); err != nil {
 		panic(err)
 	}
-	// invoke调用
-	// result, err := graph.Invoke(ctx, *mockPlaybook)
-	// assert.NoError(t, err)
-	// assert.NotEmpty(t, result)
-
-	// 流式执行
-	msgChan := make(chan *schema.Message, 100)
 
-	// 先启动消息消费 goroutine，避免 channel 阻塞
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		for msg := range msgChan {
-			fmt.Print(msg.Content)
-		}
-	}()
+	// 从配置目录加载运维方案
+	registry, err := playbook.LoadRegistry("config/playbook")
+	if err != nil {
+		panic(err)
+	}
+	mockPlaybook, ok := registry.Get("kubectl", "investigatePodFailures")
+	if !ok {
+		panic("playbook not found")
+	}
 
-	callback := executor.NewModelCallback(msgChan)
-	output, err := graph.Stream(ctx, *mockPlaybook,
-		compose.WithCallbacks(callback).DesignateNode("toolLLM", "analysisLLM", "reportLLM"))
+	dir, err := os.MkdirTemp("", "checkpoints")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := checkpoint.NewFileStore(dir)
+	if err != nil {
+		panic(err)
+	}
+	runner, err := executor.NewRunner(ctx, mockPlaybook, store)
 	if err != nil {
 		panic(err)
 	}
 
-	for {
-		chunk, revErr := output.Recv()
-		if revErr != nil {
-			if !errors.Is(revErr, io.EOF) {
-				panic(revErr)
-			}
-			return
+	// 流式执行，事件通道在执行结束后关闭
+	for ev := range runner.RunEvents(ctx, checkpoint.NewRunID()) {
+		switch ev.Type {
+		case executor.EventStepStarted:
+			fmt.Printf("\n== 步骤 %s %s ==\n", ev.Step.Path, ev.Step.Name)
+		case executor.EventToolFinished:
+			fmt.Printf("\n[工具 %s 耗时 %s 退出码 %d] %s\n", ev.Tool.Name, ev.Tool.Duration, ev.Tool.ExitStatus, ev.Tool.Error)
+		case executor.EventLLMDelta:
+			fmt.Print(ev.LLM.Delta)
+		case executor.EventInterrupted:
+			fmt.Printf("\n等待审批: %d 个请求\n", len(ev.Approvals))
+		case executor.EventRunFailed:
+			panic(ev.Error)
 		}
-		fmt.Print(chunk)
 	}
-
 }
@@ -0,0 +1,157 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keystoreVersion = 1
+	saltSize        = 16
+	keySize         = 32
+
+	// scrypt 参数，派生一次密钥约需几十毫秒
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrWrongMasterKey 主密钥错误或数据被篡改
+var ErrWrongMasterKey = errors.New("keystore: wrong master key or corrupted entry")
+
+// keystoreFile keystore文件格式，每个条目使用AES-GCM单独加密
+type keystoreFile struct {
+	Version int               `json:"version"`
+	Salt    string            `json:"salt"`
+	Entries map[string]string `json:"entries"` // base64(nonce + ciphertext)
+}
+
+// Keystore 本地加密的凭据存储，由主密钥派生出加密密钥
+type Keystore struct {
+	mu   sync.Mutex
+	path string
+	aead cipher.AEAD
+	file *keystoreFile
+}
+
+// OpenKeystore 打开keystore文件，文件不存在时创建一个空的keystore，调用Save后落盘
+func OpenKeystore(path, masterKey string) (*Keystore, error) {
+	if masterKey == "" {
+		return nil, errors.New("keystore: master key is empty")
+	}
+
+	file := &keystoreFile{Version: keystoreVersion, Entries: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, file); err != nil {
+			return nil, fmt.Errorf("keystore: parse %s: %w", path, err)
+		}
+		if file.Version != keystoreVersion {
+			return nil, fmt.Errorf("keystore: unsupported version %d", file.Version)
+		}
+		if file.Entries == nil {
+			file.Entries = make(map[string]string)
+		}
+	case os.IsNotExist(err):
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		file.Salt = base64.StdEncoding.EncodeToString(salt)
+	default:
+		return nil, fmt.Errorf("keystore: read %s: %w", path, err)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(file.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: invalid salt: %w", err)
+	}
+	key, err := scrypt.Key([]byte(masterKey), salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keystore{path: path, aead: aead, file: file}, nil
+}
+
+// Get 解密并返回凭据
+func (k *Keystore) Get(name string) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	encoded, ok := k.file.Entries[name]
+	if !ok {
+		return "", fmt.Errorf("keystore: entry %s not found", name)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < k.aead.NonceSize() {
+		return "", ErrWrongMasterKey
+	}
+
+	nonce, ciphertext := data[:k.aead.NonceSize()], data[k.aead.NonceSize():]
+	// 条目名称作为附加数据，防止密文在条目之间被替换
+	plain, err := k.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", ErrWrongMasterKey
+	}
+	return string(plain), nil
+}
+
+// Set 加密并保存凭据，需要调用Save写入文件
+func (k *Keystore) Set(name, value string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := k.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	k.file.Entries[name] = base64.StdEncoding.EncodeToString(sealed)
+	return nil
+}
+
+// Delete 删除凭据
+func (k *Keystore) Delete(name string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.file.Entries, name)
+}
+
+// Save 将keystore写入文件，先写临时文件再重命名，避免写入中断导致文件损坏
+func (k *Keystore) Save() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	data, err := json.MarshalIndent(k.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.path), 0o700); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
@@ -0,0 +1,174 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 凭据引用格式
+const (
+	envPrefix      = "${env:"
+	envSuffix      = "}"
+	filePrefix     = "file:"
+	keystorePrefix = "keystore:"
+
+	// 未调用 ConfigureKeystore 时使用的环境变量
+	EnvKeystorePath = "AGENT_KEYSTORE"
+	EnvMasterKey    = "AGENT_MASTER_KEY"
+
+	mask         = "******"
+	minMaskedLen = 4 // 过短的值替换后会误伤正常输出
+)
+
+var (
+	mu sync.RWMutex
+	// known 已解析过的凭据值，用于在输出中脱敏
+	known = make(map[string]struct{})
+
+	keystorePath   = ""
+	masterKeyRef   = ""
+	keystoreCached *Keystore
+)
+
+// IsRef 判断配置值是否为凭据引用
+func IsRef(value string) bool {
+	return (strings.HasPrefix(value, envPrefix) && strings.HasSuffix(value, envSuffix)) ||
+		strings.HasPrefix(value, filePrefix) ||
+		strings.HasPrefix(value, keystorePrefix)
+}
+
+// Resolve 解析凭据引用，支持 ${env:VAR}、file:/path 和 keystore:name，非引用的值原样返回
+// 解析出的值会被记录，之后可以通过 Mask 从输出中去除
+func Resolve(value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+
+	var (
+		resolved string
+		err      error
+	)
+	switch {
+	case strings.HasPrefix(value, envPrefix):
+		name := strings.TrimSuffix(strings.TrimPrefix(value, envPrefix), envSuffix)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret env %s is not set", name)
+		}
+		resolved = v
+	case strings.HasPrefix(value, filePrefix):
+		path := strings.TrimPrefix(value, filePrefix)
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			// 只返回路径，避免文件内容出现在错误信息中
+			return "", fmt.Errorf("read secret file %s failed", path)
+		}
+		resolved = strings.TrimRight(string(data), "\r\n")
+	case strings.HasPrefix(value, keystorePrefix):
+		resolved, err = resolveKeystore(strings.TrimPrefix(value, keystorePrefix))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	Register(resolved)
+	return resolved, nil
+}
+
+// ResolveAll 解析map中的所有值，任一值解析失败时返回错误
+func ResolveAll(values map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(values))
+	for k, v := range values {
+		r, err := Resolve(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		resolved[k] = r
+	}
+	return resolved, nil
+}
+
+// Register 记录需要脱敏的值，用于明文配置的密码等场景
+func Register(value string) {
+	if len(value) < minMaskedLen {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	known[value] = struct{}{}
+}
+
+// Mask 将文本中出现的已知凭据替换为掩码
+func Mask(text string) string {
+	mu.RLock()
+	values := make([]string, 0, len(known))
+	for v := range known {
+		values = append(values, v)
+	}
+	mu.RUnlock()
+
+	// 先替换较长的值，避免部分替换
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, v := range values {
+		text = strings.ReplaceAll(text, v, mask)
+	}
+	return text
+}
+
+// ConfigureKeystore 设置keystore文件路径和主密钥，主密钥同样支持 ${env:VAR} 和 file: 引用
+func ConfigureKeystore(path, masterKey string) {
+	mu.Lock()
+	defer mu.Unlock()
+	keystorePath = path
+	masterKeyRef = masterKey
+	keystoreCached = nil
+}
+
+func resolveKeystore(name string) (string, error) {
+	ks, err := defaultKeystore()
+	if err != nil {
+		return "", err
+	}
+	return ks.Get(name)
+}
+
+// defaultKeystore 首次使用时打开keystore
+func defaultKeystore() (*Keystore, error) {
+	mu.RLock()
+	ks, path, keyRef := keystoreCached, keystorePath, masterKeyRef
+	mu.RUnlock()
+	if ks != nil {
+		return ks, nil
+	}
+
+	if path == "" {
+		path = os.Getenv(EnvKeystorePath)
+	}
+	if keyRef == "" {
+		keyRef = envPrefix + EnvMasterKey + envSuffix
+	}
+	if path == "" {
+		return nil, errors.New("keystore is not configured")
+	}
+	if strings.HasPrefix(keyRef, keystorePrefix) {
+		return nil, errors.New("keystore master key can not reference keystore")
+	}
+	masterKey, err := Resolve(keyRef)
+	if err != nil {
+		return nil, fmt.Errorf("resolve keystore master key: %w", err)
+	}
+
+	ks, err = OpenKeystore(path, masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	keystoreCached = ks
+	mu.Unlock()
+	return ks, nil
+}
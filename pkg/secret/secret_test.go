@@ -0,0 +1,64 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveRefs(t *testing.T) {
+	t.Setenv("TEST_SECRET_PASSWORD", "env-password")
+	path := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(path, []byte("file-password\n"), 0o600))
+
+	v, err := Resolve("${env:TEST_SECRET_PASSWORD}")
+	require.NoError(t, err)
+	assert.Equal(t, "env-password", v)
+
+	v, err = Resolve("file:" + path)
+	require.NoError(t, err)
+	assert.Equal(t, "file-password", v)
+
+	// 非引用的值原样返回
+	v, err = Resolve("root")
+	require.NoError(t, err)
+	assert.Equal(t, "root", v)
+
+	_, err = Resolve("${env:TEST_SECRET_NOT_SET}")
+	assert.EqualError(t, err, "secret env TEST_SECRET_NOT_SET is not set")
+
+	assert.Equal(t, "login ****** and ******", Mask("login env-password and file-password"))
+}
+
+func TestKeystore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+
+	ks, err := OpenKeystore(path, "master")
+	require.NoError(t, err)
+	require.NoError(t, ks.Set("db", "keystore-password"))
+	require.NoError(t, ks.Save())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "keystore-password")
+
+	ks, err = OpenKeystore(path, "wrong")
+	require.NoError(t, err)
+	_, err = ks.Get("db")
+	assert.ErrorIs(t, err, ErrWrongMasterKey)
+
+	t.Setenv("TEST_MASTER_KEY", "master")
+	ConfigureKeystore(path, "${env:TEST_MASTER_KEY}")
+	defer ConfigureKeystore("", "")
+
+	v, err := Resolve("keystore:db")
+	require.NoError(t, err)
+	assert.Equal(t, "keystore-password", v)
+	assert.Equal(t, "pw=******", Mask("pw=keystore-password"))
+
+	_, err = Resolve("keystore:missing")
+	assert.EqualError(t, err, "keystore: entry missing not found")
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"agent-samples/pkg/playbook"
+	"agent-samples/pkg/samples/executor"
+
+	"github.com/cloudwego/eino/compose"
+)
+
+// 执行状态
+const (
+	StatusRunning     = "running"     // 执行中
+	StatusCompleted   = "completed"   // 执行完成并生成报告
+	StatusFailed      = "failed"      // 执行失败
+	StatusInterrupted = "interrupted" // 等待审批，提交审批结果后继续执行
+	StatusCanceled    = "canceled"    // 被调用方取消
+)
+
+// errNotInterrupted 执行不在等待审批时提交审批结果
+var errNotInterrupted = errors.New("执行不在等待审批")
+
+// runner 执行运维方案并推送执行事件，由 executor.Runner 实现
+type runner interface {
+	RunEvents(ctx context.Context, runID string, opts ...compose.Option) <-chan executor.Event
+	ResumeEvents(ctx context.Context, runID string, decisions map[string]executor.Decisions, opts ...compose.Option) <-chan executor.Event
+}
+
+// RunInfo 执行的概要信息
+type RunInfo struct {
+	ID         string                      `json:"id"`
+	Playbook   string                      `json:"playbook"` // 运维方案的标识，格式为 middle/name
+	Target     string                      `json:"target,omitempty"`
+	Inputs     map[string]string           `json:"inputs,omitempty"`
+	Status     string                      `json:"status"`
+	Error      string                      `json:"error,omitempty"`
+	Model      string                      `json:"model,omitempty"`     // 实际生成报告的模型
+	Approvals  []*executor.ApprovalRequest `json:"approvals,omitempty"` // 等待审批的工具调用，仅 interrupted 状态
+	CreatedAt  time.Time                   `json:"created_at"`
+	FinishedAt *time.Time                  `json:"finished_at,omitempty"`
+}
+
+// storedEvent 保存的事件，id 为事件的序号，不再保存的事件同样占用序号
+type storedEvent struct {
+	id int
+	ev executor.Event
+}
+
+// run 一次执行，保存事件以便订阅方从任意位置开始读取
+// 模型的增量输出只保存到下一个其他类型的事件之前，之后由步骤结果和报告代替，避免按token保存全部输出
+// 等待审批时执行结束，提交审批结果后继续执行，事件追加在之前的事件之后
+type run struct {
+	id      string
+	book    *playbook.PlayBook
+	runner  runner
+	discard func() // 删除执行的检查点，放弃等待审批的执行时调用
+	created time.Time
+
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	status    string
+	report    string
+	model     string
+	err       string
+	approvals []*executor.ApprovalRequest
+	canceled  bool
+	finished  time.Time
+	seq       int
+	events    []storedEvent
+	changed   chan struct{} // 有新事件或执行结束时关闭并替换，用于通知订阅方
+}
+
+func newRun(id string, book *playbook.PlayBook, runner runner, discard func()) *run {
+	return &run{
+		id:      id,
+		book:    book,
+		runner:  runner,
+		discard: discard,
+		created: time.Now(),
+		status:  StatusRunning,
+		changed: make(chan struct{}),
+	}
+}
+
+// start 在后台开始执行
+// 执行的生命周期与请求无关，只能通过取消接口或关闭服务结束
+func (r *run) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.cancel = cancel
+	r.mu.Unlock()
+	r.consume(r.runner.RunEvents(ctx, r.id), cancel)
+}
+
+// resume 提交审批结果并在后台继续执行，执行不在等待审批或中断id不存在时返回错误
+func (r *run) resume(decisions map[string]executor.Decisions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != StatusInterrupted || r.finished.IsZero() {
+		return fmt.Errorf("%w，当前状态为%s", errNotInterrupted, r.status)
+	}
+	for id := range decisions {
+		if !r.pending(id) {
+			return fmt.Errorf("中断不存在: %s", id)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.status, r.approvals, r.finished = StatusRunning, nil, time.Time{}
+	r.notify()
+	r.consume(r.runner.ResumeEvents(ctx, r.id, decisions), cancel)
+	return nil
+}
+
+func (r *run) pending(interruptID string) bool {
+	for _, req := range r.approvals {
+		if req.InterruptID == interruptID {
+			return true
+		}
+	}
+	return false
+}
+
+// consume 在后台读取执行事件直到通道关闭
+func (r *run) consume(events <-chan executor.Event, cancel context.CancelFunc) {
+	go func() {
+		defer cancel()
+		for ev := range events {
+			r.append(ev)
+		}
+		r.finish()
+	}()
+}
+
+func (r *run) append(ev executor.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ev.Type != executor.EventLLMDelta {
+		r.events = dropDeltas(r.events)
+	}
+	r.seq++
+	r.events = append(r.events, storedEvent{id: r.seq, ev: ev})
+	switch ev.Type {
+	case executor.EventRunCompleted:
+		r.status, r.report, r.model = StatusCompleted, ev.Report, ev.Model
+	case executor.EventRunFailed:
+		r.status, r.err = StatusFailed, ev.Error
+	case executor.EventInterrupted:
+		r.status, r.approvals = StatusInterrupted, ev.Approvals
+	}
+	r.notify()
+}
+
+// dropDeltas 去除末尾的增量输出事件，其他事件到达时增量事件只可能位于末尾
+func dropDeltas(events []storedEvent) []storedEvent {
+	n := len(events)
+	for n > 0 && events[n-1].ev.Type == executor.EventLLMDelta {
+		n--
+	}
+	clear(events[n:])
+	return events[:n]
+}
+
+// finish 标记执行结束，取消后执行返回的错误不作为失败原因
+func (r *run) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.canceled && r.status != StatusCompleted:
+		r.status, r.err = StatusCanceled, ""
+	case r.status == StatusRunning:
+		// 取消以外的原因导致ctx结束时，最后一个事件可能未能写入
+		r.status, r.err = StatusFailed, "执行意外结束"
+	}
+	r.finished = time.Now()
+	r.notify()
+}
+
+func (r *run) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// stop 取消执行，等待审批的执行直接结束并删除检查点，执行已结束时返回false
+func (r *run) stop() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.finished.IsZero():
+		r.canceled = true
+		r.cancel()
+		return true
+	case r.status == StatusInterrupted:
+		r.status, r.approvals, r.finished = StatusCanceled, nil, time.Now()
+		r.discard()
+		r.notify()
+		return true
+	}
+	return false
+}
+
+// expire 执行在 before 之前结束时返回true，等待审批的执行同时结束并删除检查点
+func (r *run) expire(before time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished.IsZero() || !r.finished.Before(before) {
+		return false
+	}
+	if r.status == StatusInterrupted {
+		r.status, r.approvals = StatusCanceled, nil
+		r.discard()
+		r.notify()
+	}
+	return true
+}
+
+// finishedAt 执行结束的时间，未结束时为零值
+func (r *run) finishedAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.finished
+}
+
+// next 返回序号大于from的事件、执行是否已结束，以及下一次变化的通知
+func (r *run) next(from int) ([]storedEvent, bool, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := sort.Search(len(r.events), func(i int) bool { return r.events[i].id > from })
+	events := append([]storedEvent{}, r.events[i:]...)
+	return events, !r.finished.IsZero(), r.changed
+}
+
+// result 返回执行状态和报告
+func (r *run) result() (string, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status, r.report
+}
+
+func (r *run) info() RunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := RunInfo{
+		ID:        r.id,
+		Playbook:  playbook.Key(r.book.Middle, r.book.Name),
+		Target:    r.book.Target,
+		Inputs:    r.book.Inputs,
+		Status:    r.status,
+		Error:     r.err,
+		Model:     r.model,
+		Approvals: r.approvals,
+		CreatedAt: r.created,
+	}
+	if !r.finished.IsZero() {
+		finished := r.finished
+		info.FinishedAt = &finished
+	}
+	return info
+}
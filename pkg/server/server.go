@@ -0,0 +1,441 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-samples/pkg/checkpoint"
+	"agent-samples/pkg/playbook"
+	"agent-samples/pkg/samples/executor"
+
+	"github.com/bytedance/gopkg/util/logger"
+	"github.com/cloudwego/eino/compose"
+)
+
+const (
+	// keepAlive 事件流空闲时发送注释行的间隔，避免代理断开长连接
+	keepAlive = 15 * time.Second
+	// runTTL 执行结束后保留的时间，超过后不能再查询，等待审批的执行同时删除检查点
+	runTTL = 24 * time.Hour
+	// maxFinishedRuns 最多保留的已结束执行，超出时移除最早结束的执行
+	maxFinishedRuns = 500
+)
+
+// runnerFunc 为一次执行创建执行器
+type runnerFunc func(ctx context.Context, book *playbook.PlayBook) (runner, error)
+
+// checkpointDeleter 支持删除检查点的存储，如 checkpoint.FileStore
+type checkpointDeleter interface {
+	Delete(ctx context.Context, id string) error
+}
+
+// checkpointLister 支持列出检查点的存储，如 checkpoint.FileStore
+type checkpointLister interface {
+	List(ctx context.Context) ([]string, error)
+}
+
+// Server 运维方案执行的HTTP服务
+//
+//	GET  /api/playbooks             列出运维方案，可用 middle 参数过滤
+//	POST /api/runs                  开始执行运维方案
+//	GET  /api/runs/{id}             查询执行状态
+//	GET  /api/runs/{id}/events      以 Server-Sent Events 推送执行事件，支持 Last-Event-ID 断点续传
+//	GET  /api/runs/{id}/report      获取诊断报告
+//	POST /api/runs/{id}/approvals   提交审批结果，继续等待审批的执行
+//	POST /api/runs/{id}/cancel      取消执行，等待审批的执行同时删除检查点
+//
+// 所有请求需要携带 Authorization: Bearer <token>
+// 执行只保存在内存中，服务重启后之前的执行，包括等待审批的执行都无法查询和继续
+type Server struct {
+	registry  *playbook.Registry
+	token     string
+	store     compose.CheckPointStore
+	newRunner runnerFunc
+	mux       *http.ServeMux
+	ttl       time.Duration
+	maxRuns   int
+
+	mu   sync.RWMutex
+	runs map[string]*run
+}
+
+// New 创建HTTP服务，每次执行使用独立的执行图，检查点写入store
+// token 为访问API需要的bearer token，为空时拒绝所有请求
+// store中已有的检查点属于之前的服务进程，无法再继续执行，创建时删除
+// 工具和模型需要在创建前通过 tool.InitTool 和 model.Init 初始化
+func New(registry *playbook.Registry, store compose.CheckPointStore, token string, opts ...executor.Option) *Server {
+	discardCheckpoints(store)
+	return newServer(registry, store, token, func(ctx context.Context, book *playbook.PlayBook) (runner, error) {
+		runner, err := executor.NewRunner(ctx, book, store, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return runner, nil
+	})
+}
+
+func newServer(registry *playbook.Registry, store compose.CheckPointStore, token string, newRunner runnerFunc) *Server {
+	s := &Server{
+		registry:  registry,
+		token:     token,
+		store:     store,
+		newRunner: newRunner,
+		mux:       http.NewServeMux(),
+		ttl:       runTTL,
+		maxRuns:   maxFinishedRuns,
+		runs:      make(map[string]*run),
+	}
+	s.mux.HandleFunc("GET /api/playbooks", s.listPlaybooks)
+	s.mux.HandleFunc("POST /api/runs", s.createRun)
+	s.mux.HandleFunc("GET /api/runs/{id}", s.getRun)
+	s.mux.HandleFunc("GET /api/runs/{id}/events", s.streamEvents)
+	s.mux.HandleFunc("GET /api/runs/{id}/report", s.getReport)
+	s.mux.HandleFunc("POST /api/runs/{id}/approvals", s.submitApprovals)
+	s.mux.HandleFunc("POST /api/runs/{id}/cancel", s.cancelRun)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "未授权")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized 校验请求的bearer token，执行运维方案和审批危险操作都需要授权
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// Close 取消所有未结束的执行，等待审批的执行无法在服务重启后继续，同样结束并删除检查点
+func (s *Server) Close() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, run := range s.runs {
+		run.stop()
+	}
+}
+
+// PlaybookInfo 运维方案的概要信息
+type PlaybookInfo struct {
+	Id       int        `json:"id"`
+	Name     string     `json:"name"`
+	Middle   string     `json:"middle"`
+	TaskGoal string     `json:"task_goal"`
+	Steps    []StepInfo `json:"steps"`
+}
+
+// StepInfo 步骤的概要信息，子步骤按路径展开
+type StepInfo struct {
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Details string `json:"details"`
+}
+
+// ApprovalsRequest 提交审批结果的请求
+type ApprovalsRequest struct {
+	Decisions map[string]executor.Decisions `json:"decisions"` // key为中断id，值为该中断中各工具调用的审批结果
+}
+
+// RunRequest 开始执行的请求
+type RunRequest struct {
+	Playbook string            `json:"playbook"`
+	Middle   string            `json:"middle"`
+	Target   string            `json:"target,omitempty"` // 诊断对象，如节点名称、Pod名称
+	Inputs   map[string]string `json:"inputs,omitempty"` // 输入参数，提供给模型选择工具参数
+}
+
+func (s *Server) listPlaybooks(w http.ResponseWriter, r *http.Request) {
+	books := s.registry.List(r.URL.Query().Get("middle"))
+	infos := make([]PlaybookInfo, 0, len(books))
+	for _, book := range books {
+		info := PlaybookInfo{Id: book.Id, Name: book.Name, Middle: book.Middle, TaskGoal: book.TaskGoal, Steps: make([]StepInfo, 0)}
+		book.Walk(func(path playbook.StepPath, step *playbook.Step) bool {
+			info.Steps = append(info.Steps, StepInfo{Path: path.String(), Name: step.Name, Details: step.Details})
+			return true
+		})
+		infos = append(infos, info)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) createRun(w http.ResponseWriter, r *http.Request) {
+	req := &RunRequest{}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("请求格式错误: %s", err))
+		return
+	}
+	if req.Playbook == "" || req.Middle == "" {
+		writeError(w, http.StatusBadRequest, "缺少playbook或middle")
+		return
+	}
+	book, ok := s.registry.Get(req.Middle, req.Playbook)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("运维方案不存在: %s", playbook.Key(req.Middle, req.Playbook)))
+		return
+	}
+
+	// 注册表中的方案被所有执行共享，执行参数设置在副本上
+	b := *book
+	b.Target, b.Inputs = req.Target, req.Inputs
+
+	runner, err := s.newRunner(r.Context(), &b)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("创建执行失败: %s", err))
+		return
+	}
+	id := checkpoint.NewRunID()
+	run := newRun(id, &b, runner, func() { s.deleteCheckpoint(id) })
+	s.mu.Lock()
+	s.prune(time.Now())
+	s.runs[id] = run
+	s.mu.Unlock()
+	run.start()
+
+	w.Header().Set("Location", "/api/runs/"+id)
+	writeJSON(w, http.StatusAccepted, run.info())
+}
+
+func (s *Server) getRun(w http.ResponseWriter, r *http.Request) {
+	if run, ok := s.lookup(w, r); ok {
+		writeJSON(w, http.StatusOK, run.info())
+	}
+}
+
+// streamEvents 先推送已保存的事件，再推送新事件直到执行结束，最后以 end 事件发送执行状态
+// 事件id为事件的序号，断线重连时从 Last-Event-ID 之后继续，已被代替的模型增量输出不再推送
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "不支持事件流")
+		return
+	}
+	from := 0
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		n, err := strconv.Atoi(last)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Last-Event-ID格式错误: %s", last))
+			return
+		}
+		from = n
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		events, done, changed := run.next(from)
+		for _, e := range events {
+			from = e.id
+			if err := writeEvent(w, strconv.Itoa(e.id), string(e.ev.Type), e.ev); err != nil {
+				return
+			}
+		}
+		if done {
+			_ = writeEvent(w, "", "end", run.info())
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// getReport 返回markdown格式的诊断报告，执行未完成时返回409
+func (s *Server) getReport(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	status, report := run.result()
+	if status != StatusCompleted {
+		writeError(w, http.StatusConflict, fmt.Sprintf("执行未完成，当前状态为%s", status))
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, report)
+}
+
+// submitApprovals 提交审批结果，执行在后台继续，事件追加到原有的事件流中
+func (s *Server) submitApprovals(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	req := &ApprovalsRequest{}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("请求格式错误: %s", err))
+		return
+	}
+	if len(req.Decisions) == 0 {
+		writeError(w, http.StatusBadRequest, "缺少decisions")
+		return
+	}
+	for _, decisions := range req.Decisions {
+		for callID, d := range decisions {
+			switch d.Action {
+			case executor.ActionApprove, executor.ActionDeny, executor.ActionEdit:
+			default:
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("调用 %s 的审批动作无效: %q", callID, d.Action))
+				return
+			}
+		}
+	}
+
+	if err := run.resume(req.Decisions); err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errNotInterrupted) {
+			code = http.StatusConflict
+		}
+		writeError(w, code, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run.info())
+}
+
+func (s *Server) cancelRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	if !run.stop() {
+		writeError(w, http.StatusConflict, fmt.Sprintf("执行已结束，状态为%s", run.info().Status))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run.info())
+}
+
+// prune 移除结束超过保留时间的执行，已结束的执行超过数量上限时移除最早结束的执行
+// 只在创建执行时调用，服务内存中的执行数量不会无限增长，调用方需持有 s.mu
+func (s *Server) prune(now time.Time) {
+	type finishedRun struct {
+		run *run
+		at  time.Time
+	}
+	var finished []finishedRun
+	for id, run := range s.runs {
+		if run.expire(now.Add(-s.ttl)) {
+			delete(s.runs, id)
+			continue
+		}
+		if at := run.finishedAt(); !at.IsZero() {
+			finished = append(finished, finishedRun{run: run, at: at})
+		}
+	}
+	if len(finished) <= s.maxRuns {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].at.Before(finished[j].at) })
+	for _, f := range finished[:len(finished)-s.maxRuns] {
+		// 提交审批结果后重新开始执行的不移除
+		if f.run.expire(now.Add(time.Nanosecond)) {
+			delete(s.runs, f.run.id)
+		}
+	}
+}
+
+// lookup 根据路径中的id查找执行，不存在时返回404
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*run, bool) {
+	id := r.PathValue("id")
+	s.mu.RLock()
+	run, ok := s.runs[id]
+	s.mu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("执行不存在: %s", id))
+	}
+	return run, ok
+}
+
+// discardCheckpoints 删除存储中已有的检查点，服务启动时没有可以继续的执行
+func discardCheckpoints(store compose.CheckPointStore) {
+	lister, ok := store.(checkpointLister)
+	if !ok {
+		return
+	}
+	deleter, ok := store.(checkpointDeleter)
+	if !ok {
+		return
+	}
+	ids, err := lister.List(context.Background())
+	if err != nil {
+		logger.Errorf("fail to list checkpoints: %s", err)
+		return
+	}
+	for _, id := range ids {
+		if err := deleter.Delete(context.Background(), id); err != nil {
+			logger.Errorf("fail to delete checkpoint of run %s: %s", id, err)
+		}
+	}
+}
+
+// deleteCheckpoint 删除执行的检查点，存储不支持删除时忽略
+func (s *Server) deleteCheckpoint(id string) {
+	deleter, ok := s.store.(checkpointDeleter)
+	if !ok {
+		return
+	}
+	if err := deleter.Delete(context.Background(), id); err != nil {
+		logger.Errorf("fail to delete checkpoint of run %s: %s", id, err)
+	}
+}
+
+// writeEvent 写入一条SSE事件，id为空时不设置事件id
+func writeEvent(w http.ResponseWriter, id, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,463 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-samples/pkg/checkpoint"
+	"agent-samples/pkg/playbook"
+	"agent-samples/pkg/samples/executor"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "test-token"
+
+// authTransport 为测试请求加上认证头
+type authTransport struct{}
+
+func (authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// client 携带认证头的客户端，测试请求都通过它发送
+var client = &http.Client{Transport: authTransport{}}
+
+// sseEvent 解析后的事件流中的一条事件
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// fakeRunner 按测试提供的函数推送执行事件
+type fakeRunner struct {
+	run    func(ctx context.Context, runID string) <-chan executor.Event
+	resume func(ctx context.Context, runID string, decisions map[string]executor.Decisions) <-chan executor.Event
+}
+
+func (f *fakeRunner) RunEvents(ctx context.Context, runID string, opts ...compose.Option) <-chan executor.Event {
+	return f.run(ctx, runID)
+}
+
+func (f *fakeRunner) ResumeEvents(ctx context.Context, runID string, decisions map[string]executor.Decisions, opts ...compose.Option) <-chan executor.Event {
+	return f.resume(ctx, runID, decisions)
+}
+
+func newTestServer(t *testing.T, store compose.CheckPointStore, newRunner runnerFunc) *httptest.Server {
+	t.Helper()
+	registry, err := playbook.LoadRegistry("../../config/playbook")
+	require.NoError(t, err)
+	s := newServer(registry, store, testToken, newRunner)
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		s.Close()
+		ts.Close()
+	})
+	return ts
+}
+
+func postRun(t *testing.T, ts *httptest.Server, body string) (*http.Response, RunInfo) {
+	t.Helper()
+	resp, err := client.Post(ts.URL+"/api/runs", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	info := RunInfo{}
+	if resp.StatusCode == http.StatusAccepted {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	}
+	return resp, info
+}
+
+// readEvents 读取事件流直到服务端关闭连接
+func readEvents(t *testing.T, ts *httptest.Server, id, lastEventID string) []sseEvent {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/runs/"+id+"/events", nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var events []sseEvent
+	current := sseEvent{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if current.event != "" {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			current.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			current.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return events
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func post(t *testing.T, url, body string) (int, string) {
+	t.Helper()
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(data)
+}
+
+// finalInfo 读取事件流直到执行结束，返回 end 事件中的执行状态
+func finalInfo(t *testing.T, ts *httptest.Server, id, lastEventID string) ([]sseEvent, RunInfo) {
+	t.Helper()
+	events := readEvents(t, ts, id, lastEventID)
+	require.NotEmpty(t, events)
+	last := events[len(events)-1]
+	require.Equal(t, "end", last.event)
+	info := RunInfo{}
+	require.NoError(t, json.Unmarshal([]byte(last.data), &info))
+	return events, info
+}
+
+func TestListPlaybooks(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+
+	code, body := get(t, ts.URL+"/api/playbooks?middle=postgres")
+	require.Equal(t, http.StatusOK, code)
+	var books []PlaybookInfo
+	require.NoError(t, json.Unmarshal([]byte(body), &books))
+	require.NotEmpty(t, books)
+	for _, b := range books {
+		assert.Equal(t, "postgres", b.Middle)
+		assert.NotEmpty(t, b.Steps)
+	}
+
+	code, body = get(t, ts.URL+"/api/playbooks")
+	require.Equal(t, http.StatusOK, code)
+	var all []PlaybookInfo
+	require.NoError(t, json.Unmarshal([]byte(body), &all))
+	assert.Greater(t, len(all), len(books))
+}
+
+func TestRequiresToken(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+
+	for _, auth := range []string{"", "Bearer wrong-token", testToken} {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/runs/run-1/approvals", strings.NewReader(`{}`))
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, auth)
+		assert.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+	}
+
+	// 未配置token时拒绝所有请求
+	registry, err := playbook.LoadRegistry("../../config/playbook")
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/playbooks", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	newServer(registry, nil, "", nil).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestNewDiscardsCheckpoints(t *testing.T) {
+	store, err := checkpoint.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, store.Set(context.Background(), "run-1", []byte("checkpoint")))
+	registry, err := playbook.LoadRegistry("../../config/playbook")
+	require.NoError(t, err)
+
+	// 之前的服务进程中等待审批的执行无法继续，检查点不再保留
+	New(registry, store, testToken)
+	ids, err := store.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestRunLifecycle(t *testing.T) {
+	var started *playbook.PlayBook
+	ts := newTestServer(t, nil, func(ctx context.Context, book *playbook.PlayBook) (runner, error) {
+		started = book
+		return &fakeRunner{run: func(ctx context.Context, runID string) <-chan executor.Event {
+			ch := make(chan executor.Event, 4)
+			ch <- executor.Event{Type: executor.EventStepStarted, RunID: runID, Step: &executor.StepEvent{Path: "1", Name: book.Steps[0].Name}}
+			ch <- executor.Event{Type: executor.EventLLMDelta, RunID: runID, LLM: &executor.LLMEvent{Node: "reportLLM", Delta: "报告"}}
+			ch <- executor.Event{Type: executor.EventRunCompleted, RunID: runID, Report: "# 诊断报告", Model: "qwen3"}
+			close(ch)
+			return ch
+		}}, nil
+	})
+
+	resp, info := postRun(t, ts, `{"playbook": "investigatePodFailures", "middle": "kubectl", "target": "node-1", "inputs": {"namespace": "prod"}}`)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "/api/runs/"+info.ID, resp.Header.Get("Location"))
+	assert.Equal(t, "kubectl/investigatePodFailures", info.Playbook)
+
+	// 执行参数只设置在副本上
+	require.NotNil(t, started)
+	assert.Equal(t, "node-1", started.Target)
+	assert.Equal(t, map[string]string{"namespace": "prod"}, started.Inputs)
+	registered, _ := playbook.LoadRegistry("../../config/playbook")
+	original, _ := registered.Get("kubectl", "investigatePodFailures")
+	assert.Empty(t, original.Target)
+
+	_, final := finalInfo(t, ts, info.ID, "")
+	assert.Equal(t, StatusCompleted, final.Status)
+	assert.Equal(t, "qwen3", final.Model)
+	assert.NotNil(t, final.FinishedAt)
+
+	// 模型的增量输出已被报告代替，不再保存，其他事件的序号不变
+	events := readEvents(t, ts, info.ID, "")
+	require.Len(t, events, 3)
+	assert.Equal(t, []string{"1", "3", ""}, []string{events[0].id, events[1].id, events[2].id})
+	assert.Equal(t, string(executor.EventStepStarted), events[0].event)
+	assert.Equal(t, string(executor.EventRunCompleted), events[1].event)
+	assert.Equal(t, "end", events[2].event)
+
+	// 断线重连时只推送之后的事件
+	events = readEvents(t, ts, info.ID, "2")
+	require.Len(t, events, 2)
+	assert.Equal(t, string(executor.EventRunCompleted), events[0].event)
+
+	code, body := get(t, ts.URL+"/api/runs/"+info.ID+"/report")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "# 诊断报告", body)
+
+	code, body = get(t, ts.URL+"/api/runs/"+info.ID)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"status":"completed"`)
+}
+
+func TestCreateRunErrors(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+
+	resp, _ := postRun(t, ts, `{"playbook": "investigatePodFailures"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = postRun(t, ts, `{"playbook": "investigatePodFailures", "middle": "kubectl", "unknown": 1}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = postRun(t, ts, `{"playbook": "notExist", "middle": "kubectl"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	code, _ := get(t, ts.URL+"/api/runs/notExist/report")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestCancelRun(t *testing.T) {
+	ts := newTestServer(t, nil, func(ctx context.Context, book *playbook.PlayBook) (runner, error) {
+		return &fakeRunner{run: func(ctx context.Context, runID string) <-chan executor.Event {
+			ch := make(chan executor.Event, 1)
+			ch <- executor.Event{Type: executor.EventStepStarted, RunID: runID, Step: &executor.StepEvent{Path: "1", Name: book.Steps[0].Name}}
+			go func() {
+				defer close(ch)
+				// 与执行器一致，取消后返回的错误可能写入通道
+				<-ctx.Done()
+				ch <- executor.Event{Type: executor.EventRunFailed, RunID: runID, Error: ctx.Err().Error()}
+			}()
+			return ch
+		}}, nil
+	})
+
+	resp, info := postRun(t, ts, `{"playbook": "investigatePodFailures", "middle": "kubectl"}`)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	code, body := get(t, ts.URL+"/api/runs/"+info.ID+"/report")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Contains(t, body, StatusRunning)
+
+	resp, err := client.Post(ts.URL+"/api/runs/"+info.ID+"/cancel", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	events := readEvents(t, ts, info.ID, "")
+	last := events[len(events)-1]
+	require.Equal(t, "end", last.event)
+	final := RunInfo{}
+	require.NoError(t, json.Unmarshal([]byte(last.data), &final))
+	assert.Equal(t, StatusCanceled, final.Status)
+	assert.Empty(t, final.Error)
+
+	resp, err = client.Post(ts.URL+"/api/runs/"+info.ID+"/cancel", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+// newApprovalServer 创建第一次执行等待审批、提交审批结果后完成的服务，执行时写入检查点
+func newApprovalServer(t *testing.T, store *checkpoint.FileStore, submitted *map[string]executor.Decisions) *httptest.Server {
+	return newTestServer(t, store, func(ctx context.Context, book *playbook.PlayBook) (runner, error) {
+		return &fakeRunner{
+			run: func(ctx context.Context, runID string) <-chan executor.Event {
+				require.NoError(t, store.Set(ctx, runID, []byte("checkpoint")))
+				ch := make(chan executor.Event, 2)
+				ch <- executor.Event{Type: executor.EventToolRequested, RunID: runID, Tool: &executor.ToolEvent{CallID: "call_1", Name: "pod_logs"}}
+				ch <- executor.Event{Type: executor.EventInterrupted, RunID: runID, Approvals: []*executor.ApprovalRequest{{
+					InterruptID: "interrupt-1",
+					Calls:       []executor.PendingCall{{CallID: "call_1", Tool: "pod_logs", Command: "kubectl logs web -n prod"}},
+				}}}
+				close(ch)
+				return ch
+			},
+			resume: func(ctx context.Context, runID string, decisions map[string]executor.Decisions) <-chan executor.Event {
+				*submitted = decisions
+				ch := make(chan executor.Event, 2)
+				ch <- executor.Event{Type: executor.EventToolFinished, RunID: runID, Tool: &executor.ToolEvent{CallID: "call_1", Name: "pod_logs"}}
+				ch <- executor.Event{Type: executor.EventRunCompleted, RunID: runID, Report: "# 诊断报告"}
+				close(ch)
+				return ch
+			},
+		}, nil
+	})
+}
+
+func TestSubmitApprovals(t *testing.T) {
+	store, err := checkpoint.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	var submitted map[string]executor.Decisions
+	ts := newApprovalServer(t, store, &submitted)
+
+	_, info := postRun(t, ts, `{"playbook": "investigatePodFailures", "middle": "kubectl"}`)
+	events, final := finalInfo(t, ts, info.ID, "")
+	assert.Len(t, events, 3)
+	assert.Equal(t, StatusInterrupted, final.Status)
+	require.Len(t, final.Approvals, 1)
+	assert.Equal(t, "interrupt-1", final.Approvals[0].InterruptID)
+
+	url := ts.URL + "/api/runs/" + info.ID + "/approvals"
+	for body, want := range map[string]int{
+		`{}`: http.StatusBadRequest,
+		`{"decisions": {"interrupt-2": {"call_1": {"action": "approve"}}}}`: http.StatusBadRequest,
+		`{"decisions": {"interrupt-1": {"call_1": {"action": "run"}}}}`:     http.StatusBadRequest,
+	} {
+		code, _ := post(t, url, body)
+		assert.Equal(t, want, code, body)
+	}
+
+	code, _ := post(t, url, `{"decisions": {"interrupt-1": {"call_1": {"action": "approve"}}}}`)
+	require.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, map[string]executor.Decisions{"interrupt-1": {"call_1": {Action: executor.ActionApprove}}}, submitted)
+
+	// 继续执行的事件追加在原有事件之后
+	events, final = finalInfo(t, ts, info.ID, "2")
+	require.Len(t, events, 3)
+	assert.Equal(t, "3", events[0].id)
+	assert.Equal(t, string(executor.EventToolFinished), events[0].event)
+	assert.Equal(t, StatusCompleted, final.Status)
+	assert.Empty(t, final.Approvals)
+
+	code, _ = post(t, url, `{"decisions": {"interrupt-1": {"call_1": {"action": "approve"}}}}`)
+	assert.Equal(t, http.StatusConflict, code)
+}
+
+func TestCancelInterruptedRun(t *testing.T) {
+	store, err := checkpoint.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	var submitted map[string]executor.Decisions
+	ts := newApprovalServer(t, store, &submitted)
+
+	_, info := postRun(t, ts, `{"playbook": "investigatePodFailures", "middle": "kubectl"}`)
+	_, final := finalInfo(t, ts, info.ID, "")
+	require.Equal(t, StatusInterrupted, final.Status)
+
+	// 放弃等待审批的执行时删除检查点
+	code, _ := post(t, ts.URL+"/api/runs/"+info.ID+"/cancel", "")
+	assert.Equal(t, http.StatusAccepted, code)
+	_, final = finalInfo(t, ts, info.ID, "")
+	assert.Equal(t, StatusCanceled, final.Status)
+	_, ok, err := store.Get(context.Background(), info.ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, submitted)
+}
+
+func TestRunKeepsLatestDeltas(t *testing.T) {
+	r := newRun("run-1", &playbook.PlayBook{}, nil, nil)
+	r.append(executor.Event{Type: executor.EventStepStarted})
+	for _, delta := range []string{"检", "查"} {
+		r.append(executor.Event{Type: executor.EventLLMDelta, LLM: &executor.LLMEvent{Delta: delta}})
+	}
+	events, _, _ := r.next(0)
+	require.Len(t, events, 3)
+
+	r.append(executor.Event{Type: executor.EventStepFinished})
+	events, _, _ = r.next(0)
+	require.Len(t, events, 2)
+	assert.Equal(t, []int{1, 4}, []int{events[0].id, events[1].id})
+	events, _, _ = r.next(2)
+	require.Len(t, events, 1)
+	assert.Equal(t, executor.EventStepFinished, events[0].ev.Type)
+}
+
+func TestPruneRuns(t *testing.T) {
+	store, err := checkpoint.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	registry, err := playbook.LoadRegistry("../../config/playbook")
+	require.NoError(t, err)
+	s := newServer(registry, store, testToken, nil)
+	s.ttl, s.maxRuns = time.Hour, 2
+
+	now := time.Now()
+	add := func(id, status string, finished time.Time) *run {
+		r := newRun(id, &playbook.PlayBook{}, nil, func() { s.deleteCheckpoint(id) })
+		r.status, r.finished = status, finished
+		s.runs[id] = r
+		return r
+	}
+	add("running", StatusRunning, time.Time{})
+	add("expired", StatusCompleted, now.Add(-2*time.Hour))
+	interrupted := add("interrupted", StatusInterrupted, now.Add(-2*time.Hour))
+	require.NoError(t, store.Set(context.Background(), "interrupted", []byte("checkpoint")))
+	add("oldest", StatusFailed, now.Add(-30*time.Minute))
+	add("older", StatusCompleted, now.Add(-20*time.Minute))
+	add("newest", StatusCompleted, now.Add(-10*time.Minute))
+
+	// 超过保留时间的执行和超出数量上限的最早结束的执行被移除，执行中的不受影响
+	s.prune(now)
+	assert.ElementsMatch(t, []string{"running", "older", "newest"}, sortedIDs(s.runs))
+	assert.Equal(t, StatusCanceled, interrupted.info().Status)
+	_, ok, err := store.Get(context.Background(), "interrupted")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func sortedIDs(runs map[string]*run) []string {
+	ids := make([]string, 0, len(runs))
+	for id := range runs {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -2,23 +2,32 @@ package tool
 
 import (
 	"agent-samples/pkg/tool/impl"
+	"errors"
 
 	"github.com/cloudwego/eino/components/tool"
 )
 
-type Builder func(toolConfig ToolConfigYaml) []tool.InvokableTool
+// Builder 根据配置构建工具，返回构建成功的工具和所有构建失败的模板的错误
+type Builder func(toolConfig ToolConfigYaml) ([]tool.InvokableTool, error)
 
-func BuildBashTool(toolConfig ToolConfigYaml) []tool.InvokableTool {
+// builders 按顺序执行的工具构建函数
+var builders = []Builder{BuildBashTool, BuildLocalTool}
+
+func BuildBashTool(toolConfig ToolConfigYaml) ([]tool.InvokableTool, error) {
 	var bashTools []tool.InvokableTool
+	var errs []error
 
 	// 遍历所有工具配置，查找名为"bash"的工具
 	for _, config := range toolConfig.ToolConfigs {
-		if config.ToolName == "bash" {
+		if config.ToolName == "bash" && config.IsEnabled() {
+			// 同一个bash工具的所有模板共用一个连接池
+			pool := impl.NewSSHPool(config.Pool)
+			pools = append(pools, pool)
 			// 对于bash工具中的每个执行模板，创建一个TemplateBashTool实例
 			for _, execTemplate := range config.ExecTemplates {
-				bashTool, err := impl.NewTemplateBashTool(&config, execTemplate.Name)
+				bashTool, err := impl.NewTemplateBashTool(&config, execTemplate.Name, pool)
 				if err != nil {
-					// 如果创建失败，跳过这个模板
+					errs = append(errs, err)
 					continue
 				}
 				bashTools = append(bashTools, bashTool)
@@ -26,5 +35,29 @@ func BuildBashTool(toolConfig ToolConfigYaml) []tool.InvokableTool {
 		}
 	}
 
-	return bashTools
+	return bashTools, errors.Join(errs...)
+}
+
+func BuildLocalTool(toolConfig ToolConfigYaml) ([]tool.InvokableTool, error) {
+	var localTools []tool.InvokableTool
+	var errs []error
+
+	// local_tools 中的工具均在 agent 所在主机上执行
+	for i := range toolConfig.LocalConfigs {
+		config := &toolConfig.LocalConfigs[i]
+		if !config.IsEnabled() {
+			continue
+		}
+		// 对于每个执行模板，创建一个TemplateLocalTool实例
+		for _, execTemplate := range config.ExecTemplates {
+			localTool, err := impl.NewTemplateLocalTool(config, execTemplate.Name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			localTools = append(localTools, localTool)
+		}
+	}
+
+	return localTools, errors.Join(errs...)
 }
@@ -0,0 +1,55 @@
+package impl
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Approval 需要人工审批的工具调用，包含渲染后的命令供审批人确认
+type Approval struct {
+	Tool      string         `json:"tool"`
+	Command   string         `json:"command"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// ApprovalChecker 执行前判断工具调用是否需要审批，由配置了requires_approval的模板工具实现
+type ApprovalChecker interface {
+	// CheckApproval 渲染命令并判断是否需要审批，无需审批时返回nil
+	// 参数或命令未通过策略校验时返回错误，此时调用不会被执行，也无需审批
+	CheckApproval(ctx context.Context, argumentsInJSON string) (*Approval, error)
+}
+
+// compileApprovalMatch 编译模板的审批匹配规则
+func compileApprovalMatch(tmpl ExecTemplate) (*regexp.Regexp, error) {
+	if tmpl.ApprovalMatch == "" {
+		return nil, nil
+	}
+	if !tmpl.RequiresApproval {
+		return nil, fmt.Errorf("approval_match requires requires_approval")
+	}
+	re, err := regexp.Compile(tmpl.ApprovalMatch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid approval_match %q: %w", tmpl.ApprovalMatch, err)
+	}
+	return re, nil
+}
+
+// checkApproval 模板配置了requires_approval时渲染命令，配置了approval_match时仅匹配的命令需要审批
+func checkApproval(tool string, tmpl ExecTemplate, policy *commandPolicy, match *regexp.Regexp, argumentsInJSON string) (*Approval, error) {
+	if !tmpl.RequiresApproval {
+		return nil, nil
+	}
+	args, err := parseArgs(argumentsInJSON)
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := prepareCommand(tool, tmpl, policy, args)
+	if err != nil {
+		return nil, err
+	}
+	if match != nil && !match.MatchString(cmd) {
+		return nil, nil
+	}
+	return &Approval{Tool: tool, Command: cmd, Arguments: args}, nil
+}
@@ -0,0 +1,49 @@
+package impl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckApproval(t *testing.T) {
+	logs := ExecTemplate{
+		Name:             "pod_logs",
+		Exec:             "echo logs -n {{.namespace}} {{.pod}}",
+		Parameters:       []Parameter{{Name: "namespace", Default: "default"}, {Name: "pod", Required: true}},
+		RequiresApproval: true,
+		ApprovalMatch:    `-n (kube-system|prod)\b`,
+	}
+	lt := newPolicyTool(t, nil, logs)
+
+	approval, err := lt.CheckApproval(context.Background(), `{"pod": "web-1"}`)
+	require.NoError(t, err)
+	assert.Nil(t, approval)
+
+	approval, err = lt.CheckApproval(context.Background(), `{"namespace": "kube-system", "pod": "coredns"}`)
+	require.NoError(t, err)
+	require.NotNil(t, approval)
+	assert.Equal(t, "pod_logs", approval.Tool)
+	assert.Equal(t, "echo logs -n kube-system coredns", approval.Command)
+	assert.Equal(t, "coredns", approval.Arguments["pod"])
+
+	// 未通过校验的调用直接返回错误，不进入审批
+	_, err = lt.CheckApproval(context.Background(), `{"namespace": "prod"}`)
+	assert.True(t, IsPolicyError(err))
+
+	// 未配置requires_approval时无需审批
+	plain := newPolicyTool(t, nil, ExecTemplate{Name: "echo", Exec: "echo hi"})
+	approval, err = plain.CheckApproval(context.Background(), `{}`)
+	require.NoError(t, err)
+	assert.Nil(t, approval)
+}
+
+func TestApprovalMatchRequiresApproval(t *testing.T) {
+	_, err := NewTemplateLocalTool(&ToolConfig{
+		ToolName:      "shell",
+		ExecTemplates: []ExecTemplate{{Name: "echo", Exec: "echo hi", ApprovalMatch: "hi"}},
+	}, "echo")
+	assert.ErrorContains(t, err, "approval_match requires requires_approval")
+}
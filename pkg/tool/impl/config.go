@@ -3,10 +3,15 @@ package impl
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 	"text/template"
+	"time"
 )
 
+const defaultTimeout = 30 * time.Second
+
 type AuthType string
 
 const (
@@ -18,8 +23,8 @@ const (
 // AuthTypeDescriptions 认证类型描述映射
 var AuthTypeDescriptions = map[AuthType]string{
 	AuthTypeNone:    "该工具无需认证和节点信息，直接执行即可",
-	AuthTypeGlobal:  "该工具无需节点信息，但是需要传入认证信息",
-	AuthTypePerNode: "该工具涉及到多节点操作，并且区分每个节点的认证信息",
+	AuthTypeGlobal:  "所有节点共用同一套认证信息，传入目标节点的IP或主机名即可",
+	AuthTypePerNode: "该工具涉及到多节点操作，并且区分每个节点的认证信息，需传入已配置的节点名称",
 }
 
 // GetAuthTypeDescription 获取认证类型的描述
@@ -32,25 +37,75 @@ func GetAuthTypeDescription(authType AuthType) (string, error) {
 
 // AuthConfig 认证配置
 type AuthConfig struct {
-	Type       AuthType                     `json:"type"`       // 认证类型
-	GlobalAuth map[string]string            `json:"globalAuth"` // 全局认证信息，所有节点通用
-	NodeAuths  map[string]map[string]string `json:"nodeAuths"`  // 节点级别认证信息，key为节点名称
+	Type       AuthType                     `json:"type" yaml:"type"`             // 认证类型
+	GlobalAuth map[string]string            `json:"globalAuth" yaml:"globalAuth"` // 全局认证信息，所有节点通用
+	NodeAuths  map[string]map[string]string `json:"nodeAuths" yaml:"nodeAuths"`   // 节点级别认证信息，key为节点名称
+
+	KnownHostsFile string        `json:"knownHostsFile" yaml:"knownHostsFile"` // known_hosts文件路径，默认~/.ssh/known_hosts
+	HostKeyPolicy  HostKeyPolicy `json:"hostKeyPolicy" yaml:"hostKeyPolicy"`   // 主机密钥校验策略: strict(默认), tofu(首次连接时记录)
+}
+
+// GetType 获取认证类型，未配置类型时根据已有的认证信息推断
+func (a *AuthConfig) GetType() AuthType {
+	switch {
+	case a == nil:
+		return AuthTypeNone
+	case a.Type != "":
+		return a.Type
+	case len(a.NodeAuths) > 0:
+		return AuthTypePerNode
+	case len(a.GlobalAuth) > 0:
+		return AuthTypeGlobal
+	}
+	return AuthTypeNone
+}
+
+// NodeNames 返回已配置认证信息的节点名称
+func (a *AuthConfig) NodeNames() []string {
+	if a == nil {
+		return nil
+	}
+	names := make([]string, 0, len(a.NodeAuths))
+	for name := range a.NodeAuths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // ExecTemplate 执行模板配置
 type ExecTemplate struct {
-	Name        string      `json:"name"`                         // 标识符
-	Description string      `json:"description"`                  // 描述，用于解释该命令的作用和使用方法
-	Exec        string      `json:"exec"`                         // 执行模板，可以使用模板参数
-	Parameters  []Parameter `json:"parameters" yaml:"parameters"` // 参数列表
+	Name        string       `json:"name"`                         // 标识符
+	Description string       `json:"description"`                  // 描述，用于解释该命令的作用和使用方法
+	Exec        string       `json:"exec"`                         // 执行模板，可以使用模板参数
+	Parameters  []Parameter  `json:"parameters" yaml:"parameters"` // 参数列表
+	Timeout     int          `json:"timeout" yaml:"timeout"`       // 超时时间（秒），未设置时使用工具的超时时间
+	Redact      []string     `json:"redact" yaml:"redact"`         // 输出脱敏规则，未设置时使用工具的脱敏规则
+	Retry       *RetryPolicy `json:"retry" yaml:"retry"`           // 重试策略，未设置时使用工具的重试策略
+
+	MaxOutputTokens int    `json:"maxOutputTokens" yaml:"maxOutputTokens"` // 输出进入提示词前的最大token数，未设置时使用工具的配置
+	Keep            string `json:"keep" yaml:"keep"`                       // 输出超出限制时保留的部分: head, tail, head_tail
+
+	RequiresApproval bool   `json:"requires_approval" yaml:"requires_approval"` // 执行前需要人工审批
+	ApprovalMatch    string `json:"approval_match" yaml:"approval_match"`       // 仅渲染后的命令匹配该正则时需要审批，为空时每次调用都需要审批
 }
 
 // Parameter 参数定义
 type Parameter struct {
-	Name        string   `json:"name" yaml:"name"`
-	Description string   `json:"description" yaml:"description"`
-	Required    bool     `json:"required" yaml:"required"`
-	Enum        []string `json:"enum,omitempty" yaml:"enum,omitempty"` // 可选值列表
+	Name        string     `json:"name" yaml:"name"`
+	Description string     `json:"description" yaml:"description"`
+	Required    bool       `json:"required" yaml:"required"`
+	Enum        []string   `json:"enum,omitempty" yaml:"enum,omitempty"`           // 可选值列表
+	Type        string     `json:"type,omitempty" yaml:"type,omitempty"`           // 参数类型: string(默认), integer, number, boolean, array
+	Default     any        `json:"default,omitempty" yaml:"default,omitempty"`     // 默认值，未传入可选参数时使用
+	Pattern     string     `json:"pattern,omitempty" yaml:"pattern,omitempty"`     // 参数需要完整匹配的正则表达式
+	Min         *float64   `json:"min,omitempty" yaml:"min,omitempty"`             // 数值参数的最小值
+	Max         *float64   `json:"max,omitempty" yaml:"max,omitempty"`             // 数值参数的最大值
+	MaxLength   int        `json:"maxLength,omitempty" yaml:"maxLength,omitempty"` // 最大长度，默认256
+	Items       *Parameter `json:"items,omitempty" yaml:"items,omitempty"`         // 数组元素的定义，默认为string
+	Raw         bool       `json:"raw,omitempty" yaml:"raw,omitempty"`             // 不进行shell转义，仅用于有pattern或enum约束的参数
+
+	pattern *regexp.Regexp // 构建工具时编译的Pattern
 }
 
 // 自定义工具配置结构体
@@ -66,12 +121,45 @@ type CustomTool struct {
 type ToolConfig struct {
 	ToolName      string         `json:"toolName" yaml:"toolName"` // 工具名称
 	ToolDesc      string         `json:"description" yaml:"description"`
+	Enabled       *bool          `json:"enabled" yaml:"enabled"`             // 是否启用，未设置时默认启用
+	Timeout       int            `json:"timeout" yaml:"timeout"`             // 超时时间（秒），默认30秒
 	AuthConfig    *AuthConfig    `json:"authConfig" yaml:"authConfig"`       // 认证配置
 	ExecTemplates []ExecTemplate `json:"execTemplates" yaml:"execTemplates"` // 执行模板表
+	Pool          *SSHPoolConfig `json:"pool" yaml:"pool"`                   // ssh连接池配置，仅对bash工具生效
+	Redact        []string       `json:"redact" yaml:"redact"`               // 输出脱敏规则，未设置时使用全局默认规则
+	Policy        *CommandPolicy `json:"policy" yaml:"policy"`               // 命令执行策略，内置的危险命令规则始终生效
+	Retry         *RetryPolicy   `json:"retry" yaml:"retry"`                 // 瞬时故障的重试策略，未设置时不重试
+
+	MaxOutputTokens int    `json:"maxOutputTokens" yaml:"maxOutputTokens"` // 输出进入提示词前的最大token数，未设置时使用执行器的默认限制
+	Keep            string `json:"keep" yaml:"keep"`                       // 输出超出限制时保留的部分: head, tail, head_tail(默认)
 
 	Extra map[string]string `json:"extra" yaml:"extra"` // 额外信息
 }
 
+// IsEnabled 工具是否启用
+func (c *ToolConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// GetTimeout 获取执行模板的超时时间，优先使用模板配置，其次使用工具配置
+func (c *ToolConfig) GetTimeout(tmpl ExecTemplate) time.Duration {
+	if tmpl.Timeout > 0 {
+		return time.Duration(tmpl.Timeout) * time.Second
+	}
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout) * time.Second
+	}
+	return defaultTimeout
+}
+
+// GetRetry 获取执行模板的重试策略，优先使用模板配置，其次使用工具配置
+func (c *ToolConfig) GetRetry(tmpl ExecTemplate) *RetryPolicy {
+	if tmpl.Retry != nil {
+		return tmpl.Retry
+	}
+	return c.Retry
+}
+
 func parseArgs(raw string) (map[string]any, error) {
 	var m map[string]any
 	if err := json.Unmarshal([]byte(raw), &m); err != nil {
@@ -99,7 +187,7 @@ func findExecTemplate(templates []ExecTemplate, name string) (ExecTemplate, erro
 }
 
 func renderCommandTemplate(name, tpl string, args map[string]any) (string, error) {
-	tmpl, err := template.New(name).Parse(tpl)
+	tmpl, err := template.New(name).Funcs(template.FuncMap{"join": strings.Join}).Parse(tpl)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,110 @@
+package impl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 命令被取消后等待输出管道关闭的最长时间
+const waitDelay = time.Second
+
+// TimeoutError 命令执行超时，Output 为超时前已经产生的输出
+type TimeoutError struct {
+	Tool    string
+	Timeout time.Duration
+	Output  string
+}
+
+func (e *TimeoutError) Error() string {
+	msg := fmt.Sprintf("%s timed out after %d s", e.Tool, int(e.Timeout.Seconds()))
+	if e.Output != "" {
+		msg += ", partial output:\n" + e.Output
+	}
+	return msg
+}
+
+// syncBuffer 并发安全的输出缓冲区，超时后读取部分输出时仍可能有写入
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+// partialOutput 拼接超时前产生的标准输出和标准错误
+func partialOutput(stdout, stderr *syncBuffer) string {
+	out := stdout.String()
+	if stderr.Len() > 0 {
+		out += stderr.String()
+	}
+	return out
+}
+
+// runLocalCommand 在当前环境执行命令，ctx 超时后返回 TimeoutError，被取消时返回包装的 ctx 错误
+func runLocalCommand(ctx context.Context, toolName string, timeout time.Duration, cmd string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// 使用 os/exec 包在当前环境执行命令
+	cmdObj := exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
+	cmdObj.WaitDelay = waitDelay
+
+	var stdout, stderr syncBuffer
+	cmdObj.Stdout = &stdout
+	cmdObj.Stderr = &stderr
+
+	if err := cmdObj.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", &TimeoutError{Tool: toolName, Timeout: timeout, Output: partialOutput(&stdout, &stderr)}
+		}
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s canceled: %w", toolName, ctx.Err())
+		}
+		return "", fmt.Errorf("error executing command: %w, stderr: %s", err, stderr.String())
+	}
+
+	if stderr.Len() > 0 {
+		return "", errors.New(stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// ExitStatus 返回命令的退出码，err 为nil时返回0，命令未执行或无法获取退出码时返回-1
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	var sshErr *ssh.ExitError
+	if errors.As(err, &sshErr) {
+		return sshErr.ExitStatus()
+	}
+	return -1
+}
@@ -0,0 +1,56 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalToolTimeout(t *testing.T) {
+	cfg := &ToolConfig{
+		ToolName: "shell",
+		Timeout:  10,
+		ExecTemplates: []ExecTemplate{
+			{Name: "slow", Exec: "echo started; sleep 5; echo finished", Timeout: 1},
+		},
+	}
+	lt, err := NewTemplateLocalTool(cfg, "slow")
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = lt.InvokableRun(context.Background(), `{}`)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 4*time.Second)
+
+	var te *TimeoutError
+	require.True(t, errors.As(err, &te))
+	assert.Equal(t, time.Second, te.Timeout)
+	assert.Equal(t, "started\n", te.Output)
+	assert.Contains(t, err.Error(), "slow timed out after 1 s")
+}
+
+func TestLocalToolCanceled(t *testing.T) {
+	lt, err := NewTemplateLocalTool(&ToolConfig{
+		ToolName:      "shell",
+		ExecTemplates: []ExecTemplate{{Name: "slow", Exec: "sleep 5"}},
+	}, "slow")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = lt.InvokableRun(ctx, `{}`)
+	require.ErrorIs(t, err, context.Canceled)
+	var te *TimeoutError
+	assert.False(t, errors.As(err, &te))
+}
+
+func TestGetTimeout(t *testing.T) {
+	cfg := &ToolConfig{Timeout: 60}
+	assert.Equal(t, 60*time.Second, cfg.GetTimeout(ExecTemplate{}))
+	assert.Equal(t, 5*time.Second, cfg.GetTimeout(ExecTemplate{Timeout: 5}))
+	assert.Equal(t, defaultTimeout, (&ToolConfig{}).GetTimeout(ExecTemplate{}))
+}
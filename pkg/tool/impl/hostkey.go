@@ -0,0 +1,146 @@
+package impl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type HostKeyPolicy string
+
+const (
+	HostKeyPolicyStrict HostKeyPolicy = "strict" // 仅信任known_hosts或指纹中已记录的主机密钥
+	HostKeyPolicyTOFU   HostKeyPolicy = "tofu"   // 首次连接时信任并记录主机密钥
+
+	authHostKeyFingerprint = "hostKeyFingerprint"
+
+	defaultKnownHostsFile = "~/.ssh/known_hosts"
+)
+
+// HostKeyMismatchError 主机密钥与已记录的密钥不一致，可能存在中间人攻击，不允许重试
+type HostKeyMismatchError struct {
+	Host string
+	Got  string   // 实际收到的主机密钥指纹
+	Want []string // 已记录的主机密钥指纹
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key mismatch for %s: got %s, want %s", e.Host, e.Got, strings.Join(e.Want, ","))
+}
+
+// IsHostKeyMismatch 判断错误是否由主机密钥不一致导致
+func IsHostKeyMismatch(err error) bool {
+	var mismatch *HostKeyMismatchError
+	return errors.As(err, &mismatch)
+}
+
+// knownHostsMu 串行化known_hosts文件的读写
+var knownHostsMu sync.Mutex
+
+// hostKeyCallback 构建主机密钥校验函数，优先使用节点配置的指纹，其次使用known_hosts文件
+func hostKeyCallback(a *sshAuth) (ssh.HostKeyCallback, error) {
+	if a.HostKeyFingerprint != "" {
+		return fingerprintCallback(a.HostKeyFingerprint), nil
+	}
+
+	path, err := expandHome(a.KnownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return checkKnownHosts(path, a.HostKeyPolicy, hostname, remote, key)
+	}, nil
+}
+
+func fingerprintCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if fingerprint == ssh.FingerprintSHA256(key) || fingerprint == ssh.FingerprintLegacyMD5(key) {
+			return nil
+		}
+		return &HostKeyMismatchError{
+			Host: hostname,
+			Got:  ssh.FingerprintSHA256(key),
+			Want: []string{fingerprint},
+		}
+	}
+}
+
+func checkKnownHosts(path string, policy HostKeyPolicy, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if policy != HostKeyPolicyTOFU {
+			return fmt.Errorf("known_hosts file not found: %s, configure knownHostsFile or %s", path, authHostKeyFingerprint)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			return err
+		}
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return fmt.Errorf("load known_hosts %s: %w", path, err)
+	}
+
+	err = callback(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+		want := make([]string, 0, len(keyErr.Want))
+		for _, k := range keyErr.Want {
+			want = append(want, ssh.FingerprintSHA256(k.Key))
+		}
+		return &HostKeyMismatchError{Host: hostname, Got: ssh.FingerprintSHA256(key), Want: want}
+	case errors.As(err, &keyErr) && policy == HostKeyPolicyTOFU:
+		return appendKnownHost(path, hostname, remote, key)
+	case errors.As(err, &keyErr):
+		return fmt.Errorf("unknown host key for %s (%s), add it to %s or set %s", hostname, ssh.FingerprintSHA256(key), path, authHostKeyFingerprint)
+	}
+
+	return err
+}
+
+// appendKnownHost 首次信任模式下记录新的主机密钥
+func appendKnownHost(path string, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	addrs := []string{knownhosts.Normalize(hostname)}
+	if remote != nil && knownhosts.Normalize(remote.String()) != addrs[0] {
+		addrs = append(addrs, knownhosts.Normalize(remote.String()))
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(knownhosts.Line(addrs, key) + "\n")
+	return err
+}
+
+func expandHome(path string) (string, error) {
+	if path == "" {
+		path = defaultKnownHostsFile
+	}
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[2:]), nil
+}
@@ -0,0 +1,76 @@
+package impl
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return signer
+}
+
+var remoteAddr = &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+
+func TestHostKeyFingerprint(t *testing.T) {
+	key := newHostKey(t).PublicKey()
+	other := newHostKey(t).PublicKey()
+
+	callback, err := hostKeyCallback(&sshAuth{HostKeyFingerprint: ssh.FingerprintSHA256(key)})
+	require.NoError(t, err)
+	assert.NoError(t, callback("10.0.0.1:22", remoteAddr, key))
+
+	err = callback("10.0.0.1:22", remoteAddr, other)
+	require.Error(t, err)
+	assert.True(t, IsHostKeyMismatch(err))
+}
+
+func TestHostKeyKnownHostsStrict(t *testing.T) {
+	key := newHostKey(t).PublicKey()
+	path := filepath.Join(t.TempDir(), "known_hosts")
+
+	// 文件不存在时拒绝连接
+	callback, err := hostKeyCallback(&sshAuth{KnownHostsFile: path})
+	require.NoError(t, err)
+	assert.ErrorContains(t, callback("10.0.0.1:22", remoteAddr, key), "known_hosts file not found")
+
+	// 未记录的主机拒绝连接
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	err = callback("10.0.0.1:22", remoteAddr, key)
+	assert.ErrorContains(t, err, "unknown host key")
+	assert.False(t, IsHostKeyMismatch(err))
+
+	require.NoError(t, appendKnownHost(path, "10.0.0.1:22", remoteAddr, key))
+	assert.NoError(t, callback("10.0.0.1:22", remoteAddr, key))
+	assert.True(t, IsHostKeyMismatch(callback("10.0.0.1:22", remoteAddr, newHostKey(t).PublicKey())))
+}
+
+func TestHostKeyKnownHostsTOFU(t *testing.T) {
+	key := newHostKey(t).PublicKey()
+	path := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+
+	callback, err := hostKeyCallback(&sshAuth{KnownHostsFile: path, HostKeyPolicy: HostKeyPolicyTOFU})
+	require.NoError(t, err)
+
+	// 首次连接记录主机密钥
+	require.NoError(t, callback("10.0.0.1:22", remoteAddr, key))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "10.0.0.1")
+
+	assert.NoError(t, callback("10.0.0.1:22", remoteAddr, key))
+	err = callback("10.0.0.1:22", remoteAddr, newHostKey(t).PublicKey())
+	assert.True(t, IsHostKeyMismatch(err))
+}
@@ -0,0 +1,48 @@
+package impl
+
+import "fmt"
+
+// 工具输出超出长度限制时保留的部分
+const (
+	KeepHead     = "head"      // 保留开头，适用于按重要程度排序的输出，如 ps aux --sort
+	KeepTail     = "tail"      // 保留结尾，适用于日志等最新内容在末尾的输出
+	KeepHeadTail = "head_tail" // 保留开头和结尾，省略中间部分，默认方式
+)
+
+// OutputLimit 工具输出进入提示词前的长度限制
+type OutputLimit struct {
+	MaxTokens int    // 输出的最大token数，为0时使用执行器的默认限制
+	Keep      string // 超出限制时保留的部分
+}
+
+// OutputLimiter 提供工具输出的长度限制，由模板工具实现
+type OutputLimiter interface {
+	OutputLimit() OutputLimit
+}
+
+// GetOutputLimit 获取执行模板的输出限制，优先使用模板配置，其次使用工具配置
+func (c *ToolConfig) GetOutputLimit(tmpl ExecTemplate) OutputLimit {
+	limit := OutputLimit{MaxTokens: c.MaxOutputTokens, Keep: c.Keep}
+	if tmpl.MaxOutputTokens != 0 {
+		limit.MaxTokens = tmpl.MaxOutputTokens
+	}
+	if tmpl.Keep != "" {
+		limit.Keep = tmpl.Keep
+	}
+	if limit.Keep == "" {
+		limit.Keep = KeepHeadTail
+	}
+	return limit
+}
+
+// validateOutputLimit 校验输出限制配置
+func validateOutputLimit(limit OutputLimit) error {
+	if limit.MaxTokens < 0 {
+		return fmt.Errorf("maxOutputTokens must not be negative")
+	}
+	switch limit.Keep {
+	case KeepHead, KeepTail, KeepHeadTail:
+		return nil
+	}
+	return fmt.Errorf("unknown keep %q, must be one of %s, %s, %s", limit.Keep, KeepHead, KeepTail, KeepHeadTail)
+}
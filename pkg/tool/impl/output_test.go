@@ -0,0 +1,22 @@
+package impl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOutputLimit(t *testing.T) {
+	cfg := &ToolConfig{MaxOutputTokens: 1000}
+	assert.Equal(t, OutputLimit{MaxTokens: 1000, Keep: KeepHeadTail}, cfg.GetOutputLimit(ExecTemplate{}))
+	assert.Equal(t, OutputLimit{MaxTokens: 200, Keep: KeepTail}, cfg.GetOutputLimit(ExecTemplate{MaxOutputTokens: 200, Keep: KeepTail}))
+
+	cfg = &ToolConfig{Keep: KeepHead}
+	assert.Equal(t, OutputLimit{Keep: KeepHead}, cfg.GetOutputLimit(ExecTemplate{}))
+}
+
+func TestValidateOutputLimit(t *testing.T) {
+	assert.NoError(t, validateOutputLimit(OutputLimit{MaxTokens: 100, Keep: KeepHead}))
+	assert.Error(t, validateOutputLimit(OutputLimit{MaxTokens: -1, Keep: KeepHead}))
+	assert.ErrorContains(t, validateOutputLimit(OutputLimit{Keep: "middle"}), `unknown keep "middle"`)
+}
@@ -0,0 +1,275 @@
+package impl
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// 参数类型
+const (
+	ParamTypeString  = "string"
+	ParamTypeInteger = "integer"
+	ParamTypeNumber  = "number"
+	ParamTypeBoolean = "boolean"
+	ParamTypeArray   = "array"
+)
+
+// paramType 参数类型，未配置时为string
+func (p Parameter) paramType() string {
+	if p.Type == "" {
+		return ParamTypeString
+	}
+	return p.Type
+}
+
+// zeroValue 未传入且没有默认值的参数在模板中的取值
+func (p Parameter) zeroValue() any {
+	switch p.paramType() {
+	case ParamTypeArray:
+		return []string{}
+	case ParamTypeBoolean:
+		return false
+	}
+	return ""
+}
+
+// itemParameter 数组元素的参数定义，未配置items时元素为string
+func (p Parameter) itemParameter() Parameter {
+	item := Parameter{Name: p.Name + "[]"}
+	if p.Items != nil {
+		item = *p.Items
+		item.Name = p.Name + "[]"
+	}
+	return item
+}
+
+// constrained 参数的取值是否受类型、pattern或enum约束，数组参数看元素的定义
+// 只有受约束的参数可以配置raw，否则任意文本会原样进入shell命令
+func (p Parameter) constrained() bool {
+	switch p.paramType() {
+	case ParamTypeInteger, ParamTypeNumber, ParamTypeBoolean:
+		return true
+	case ParamTypeArray:
+		return p.itemParameter().constrained()
+	}
+	return p.Pattern != "" || len(p.Enum) > 0
+}
+
+// validateParameters 校验参数定义并编译pattern，构建工具时调用
+// 返回的参数定义缓存了编译后的pattern，不修改传入的配置
+func validateParameters(params []Parameter) ([]Parameter, error) {
+	compiled := make([]Parameter, 0, len(params))
+	for _, p := range params {
+		switch p.paramType() {
+		case ParamTypeString, ParamTypeInteger, ParamTypeNumber, ParamTypeBoolean:
+		case ParamTypeArray:
+			if p.Items != nil && p.Items.paramType() == ParamTypeArray {
+				return nil, fmt.Errorf("parameter %s: nested array is not supported", p.Name)
+			}
+		default:
+			return nil, fmt.Errorf("parameter %s has unknown type %s", p.Name, p.Type)
+		}
+		if p.Raw && !p.constrained() {
+			return nil, fmt.Errorf("parameter %s: raw requires pattern or enum", p.Name)
+		}
+		if err := p.compilePattern(); err != nil {
+			return nil, err
+		}
+		if p.Items != nil {
+			item := *p.Items
+			if err := item.compilePattern(); err != nil {
+				return nil, fmt.Errorf("parameter %s items: %w", p.Name, err)
+			}
+			p.Items = &item
+		}
+		if p.Default != nil {
+			if _, err := coerceValue(p, p.Default); err != nil {
+				return nil, fmt.Errorf("invalid default value: %w", err)
+			}
+		}
+		compiled = append(compiled, p)
+	}
+	return compiled, nil
+}
+
+func (p *Parameter) compilePattern() error {
+	if p.Pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(`^(?:` + p.Pattern + `)$`)
+	if err != nil {
+		return fmt.Errorf("parameter %s has invalid pattern %q: %w", p.Name, p.Pattern, err)
+	}
+	p.pattern = re
+	return nil
+}
+
+// parameterInfos 将参数定义转换为模型可见的参数描述
+func parameterInfos(params []Parameter) map[string]*schema.ParameterInfo {
+	infos := make(map[string]*schema.ParameterInfo, len(params))
+	for _, p := range params {
+		infos[p.Name] = parameterInfo(p)
+	}
+	return infos
+}
+
+func parameterInfo(p Parameter) *schema.ParameterInfo {
+	info := &schema.ParameterInfo{
+		Type:     schema.DataType(p.paramType()),
+		Desc:     p.Description + constraintDesc(p),
+		Required: p.Required,
+		Enum:     p.Enum,
+	}
+	if p.paramType() == ParamTypeArray {
+		info.ElemInfo = parameterInfo(p.itemParameter())
+	}
+	return info
+}
+
+// constraintDesc ParameterInfo 不支持默认值和取值范围，追加到描述中告知模型
+func constraintDesc(p Parameter) string {
+	var parts []string
+	if p.Default != nil {
+		parts = append(parts, fmt.Sprintf("默认值: %v", p.Default))
+	}
+	if p.Min != nil {
+		parts = append(parts, fmt.Sprintf("最小值: %v", *p.Min))
+	}
+	if p.Max != nil {
+		parts = append(parts, fmt.Sprintf("最大值: %v", *p.Max))
+	}
+	if p.Pattern != "" {
+		parts = append(parts, fmt.Sprintf("格式: %s", p.Pattern))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "（" + strings.Join(parts, "，") + "）"
+}
+
+// coerceArgs 按参数类型转换模型传入的参数，并为缺失的可选参数填充默认值
+func coerceArgs(tool string, params []Parameter, args map[string]any) (map[string]any, error) {
+	coerced := make(map[string]any, len(args))
+	for k, v := range args {
+		coerced[k] = v
+	}
+
+	for _, p := range params {
+		v, ok := args[p.Name]
+		if !ok || v == nil {
+			if p.Required {
+				return nil, &PolicyError{Tool: tool, Reason: fmt.Sprintf("parameter %s is required", p.Name)}
+			}
+			if p.Default == nil {
+				delete(coerced, p.Name)
+				continue
+			}
+			v = p.Default
+		}
+
+		c, err := coerceValue(p, v)
+		if err != nil {
+			return nil, &PolicyError{Tool: tool, Reason: err.Error()}
+		}
+		coerced[p.Name] = c
+	}
+	return coerced, nil
+}
+
+// coerceValue 转换单个参数，模型常把数字和布尔值以字符串传入
+func coerceValue(p Parameter, v any) (any, error) {
+	switch p.paramType() {
+	case ParamTypeString:
+		switch s := v.(type) {
+		case string:
+			return s, nil
+		case float64, int, int64, bool:
+			return fmt.Sprint(s), nil
+		}
+		return nil, fmt.Errorf("parameter %s must be a string", p.Name)
+	case ParamTypeInteger:
+		if s, ok := v.(string); ok {
+			if n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+				return n, nil
+			}
+		}
+		n, err := toFloat(v)
+		// float64(math.MaxInt64) 为 2^63，超出int64范围的值转换后会溢出
+		if err != nil || n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+			return nil, fmt.Errorf("parameter %s must be an integer", p.Name)
+		}
+		return int64(n), nil
+	case ParamTypeNumber:
+		n, err := toFloat(v)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s must be a number", p.Name)
+		}
+		return n, nil
+	case ParamTypeBoolean:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			if parsed, err := strconv.ParseBool(b); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("parameter %s must be a boolean", p.Name)
+	case ParamTypeArray:
+		var items []any
+		switch a := v.(type) {
+		case []any:
+			items = a
+		case []string:
+			for _, s := range a {
+				items = append(items, s)
+			}
+		case string:
+			// 单个值视为只有一个元素的数组
+			items = []any{a}
+		default:
+			return nil, fmt.Errorf("parameter %s must be an array", p.Name)
+		}
+		item := p.itemParameter()
+		coerced := make([]any, 0, len(items))
+		for _, it := range items {
+			c, err := coerceValue(item, it)
+			if err != nil {
+				return nil, err
+			}
+			coerced = append(coerced, c)
+		}
+		return coerced, nil
+	}
+	return nil, fmt.Errorf("parameter %s has unknown type %s", p.Name, p.Type)
+}
+
+// toFloat 转换为有限的浮点数，NaN与任何值比较都为false，会绕过min和max的检查
+func toFloat(v any) (float64, error) {
+	var f float64
+	switch n := v.(type) {
+	case float64:
+		f = n
+	case int:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, err
+		}
+		f = parsed
+	default:
+		return 0, fmt.Errorf("not a number: %v", v)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("not a finite number: %v", v)
+	}
+	return f, nil
+}
@@ -0,0 +1,122 @@
+package impl
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func float(v float64) *float64 { return &v }
+
+var logsTemplate = ExecTemplate{
+	Name: "pod_logs",
+	Exec: "echo logs {{.pod_name}} -n {{.namespace}} --tail={{.tail}}{{if .previous}} --previous{{end}}{{range .labels}} -l {{.}}{{end}}",
+	Parameters: []Parameter{
+		{Name: "pod_name", Required: true},
+		{Name: "namespace", Default: "default"},
+		{Name: "tail", Type: ParamTypeInteger, Default: 100, Min: float(1), Max: float(5000)},
+		{Name: "previous", Type: ParamTypeBoolean, Default: false},
+		{Name: "labels", Type: ParamTypeArray, Items: &Parameter{Pattern: `[a-z=]+`}},
+	},
+}
+
+func TestTypedParameterInfo(t *testing.T) {
+	lt := newPolicyTool(t, nil, logsTemplate)
+	info, err := lt.Info(context.Background())
+	require.NoError(t, err)
+	js, err := info.ParamsOneOf.ToJSONSchema()
+	require.NoError(t, err)
+
+	tail, ok := js.Properties.Get("tail")
+	require.True(t, ok)
+	assert.Equal(t, string(schema.Integer), tail.Type)
+	assert.Contains(t, tail.Description, "默认值: 100")
+	assert.Contains(t, tail.Description, "最大值: 5000")
+
+	previous, _ := js.Properties.Get("previous")
+	assert.Equal(t, string(schema.Boolean), previous.Type)
+
+	labels, _ := js.Properties.Get("labels")
+	assert.Equal(t, string(schema.Array), labels.Type)
+	require.NotNil(t, labels.Items)
+	assert.Equal(t, string(schema.String), labels.Items.Type)
+	assert.Equal(t, []string{"pod_name"}, js.Required)
+}
+
+func TestParametersAreCoerced(t *testing.T) {
+	lt := newPolicyTool(t, nil, logsTemplate)
+
+	// 缺失的可选参数使用默认值
+	out, err := lt.InvokableRun(context.Background(), `{"pod_name": "web"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "logs web -n default --tail=100\n", out)
+
+	// 模型以字符串传入的数字和布尔值会被转换
+	out, err = lt.InvokableRun(context.Background(), `{"pod_name": "web", "namespace": "prod", "tail": "20", "previous": "true", "labels": ["app=web", "tier=fe"]}`)
+	require.NoError(t, err)
+	assert.Equal(t, "logs web -n prod --tail=20 --previous -l app=web -l tier=fe\n", out)
+
+	for _, args := range []string{
+		`{"pod_name": "web", "tail": 0}`,
+		`{"pod_name": "web", "tail": 1.5}`,
+		`{"pod_name": "web", "tail": "many"}`,
+		`{"pod_name": "web", "tail": "Inf"}`,
+		`{"pod_name": "web", "tail": 1e300}`,
+		`{"pod_name": "web", "tail": "-1e300"}`,
+		`{"pod_name": "web", "previous": "maybe"}`,
+		`{"pod_name": "web", "labels": ["APP"]}`,
+		`{"pod_name": "web", "labels": {"app": "web"}}`,
+	} {
+		_, err := lt.InvokableRun(context.Background(), args)
+		assert.True(t, IsPolicyError(err), args)
+	}
+}
+
+func TestCoerceNumbers(t *testing.T) {
+	integer := Parameter{Name: "n", Type: ParamTypeInteger}
+	v, err := coerceValue(integer, "9223372036854775807")
+	require.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), v)
+	for _, in := range []any{math.Inf(1), 1e19, -1e19, "NaN", "1e300"} {
+		_, err := coerceValue(integer, in)
+		assert.Error(t, err, in)
+	}
+
+	number := Parameter{Name: "ratio", Type: ParamTypeNumber, Min: float(0), Max: float(1)}
+	for _, in := range []any{"NaN", "nan", "Inf", "-Inf", math.NaN()} {
+		_, err := coerceValue(number, in)
+		assert.Error(t, err, in)
+	}
+	v, err = coerceValue(number, "0.5")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, v)
+}
+
+func TestOptionalParameterWithoutDefaultRendersEmpty(t *testing.T) {
+	lt := newPolicyTool(t, nil, ExecTemplate{
+		Name:       "echo",
+		Exec:       "echo [{{.msg}}]",
+		Parameters: []Parameter{{Name: "msg"}},
+	})
+	out, err := lt.InvokableRun(context.Background(), `{}`)
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", out)
+}
+
+func TestInvalidParameterDefinition(t *testing.T) {
+	for _, p := range []Parameter{
+		{Name: "n", Type: "map"},
+		{Name: "n", Type: ParamTypeInteger, Default: "ten"},
+		{Name: "n", Type: ParamTypeArray, Items: &Parameter{Type: ParamTypeArray}},
+	} {
+		_, err := NewTemplateLocalTool(&ToolConfig{
+			ToolName:      "shell",
+			ExecTemplates: []ExecTemplate{{Name: "run", Exec: "echo", Parameters: []Parameter{p}}},
+		}, "run")
+		assert.Error(t, err, p.Type)
+	}
+}
@@ -0,0 +1,310 @@
+package impl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxLength 未配置maxLength时单个参数的最大长度
+const defaultMaxLength = 256
+
+// defaultDenyPatterns 内置的危险命令规则，任何工具都不允许执行
+var defaultDenyPatterns = []string{
+	`\brm\s+(-[A-Za-z]*\s+)*-[A-Za-z]*[rR][A-Za-z]*\b`, // rm -rf / rm -r
+	`\bmkfs(\.\w+)?\b`,
+	`\bdd\b.*\bof=/dev/`,
+	`>\s*/dev/(sd|nvme|vd|xvd|hd)`,
+	`\b(shutdown|reboot|halt|poweroff)\b`,
+	`\binit\s+[06]\b`,
+	`:\(\)\s*\{.*\};\s*:`, // fork bomb
+	`\bchmod\s+(-[A-Za-z]+\s+)*777\s+/(\s|$)`,
+	`\bchown\s+-R\s+\S+\s+/(\s|$)`,
+	`\bkubectl\s+delete\b`,
+	`(?i)\bdrop\s+(table|database|schema)\b`,
+}
+
+// maskedArg 检查拒绝规则时替换自由文本参数的占位符
+const maskedArg = "ARG"
+
+// safeArgPattern 只包含这些字符的参数无需转义，保持命令可读
+var safeArgPattern = regexp.MustCompile(`^[A-Za-z0-9_./:=@%+,-]+$`)
+
+// PolicyError 参数或渲染后的命令未通过策略校验，命令不会被执行
+type PolicyError struct {
+	Tool   string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s rejected by policy: %s", e.Tool, e.Reason)
+}
+
+// IsPolicyError 判断错误是否由策略校验产生
+func IsPolicyError(err error) bool {
+	var pe *PolicyError
+	return errors.As(err, &pe)
+}
+
+// CommandPolicy 命令执行策略，规则为正则表达式
+// 拒绝规则匹配自由文本参数替换为占位符后的命令，允许规则匹配渲染后的完整命令
+type CommandPolicy struct {
+	Allow []string `json:"allow" yaml:"allow"` // 配置后命令必须匹配其中之一
+	Deny  []string `json:"deny" yaml:"deny"`   // 在内置规则之外追加的拒绝规则
+}
+
+type commandPolicy struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// compilePolicy 编译工具的命令策略，内置的拒绝规则始终生效
+func compilePolicy(p *CommandPolicy) (*commandPolicy, error) {
+	deny := defaultDenyPatterns
+	var allow []string
+	if p != nil {
+		deny = append(append([]string{}, deny...), p.Deny...)
+		allow = p.Allow
+	}
+
+	compiled := &commandPolicy{}
+	for _, pattern := range deny {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+		compiled.deny = append(compiled.deny, re)
+	}
+	for _, pattern := range allow {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow pattern %q: %w", pattern, err)
+		}
+		compiled.allow = append(compiled.allow, re)
+	}
+	return compiled, nil
+}
+
+// check 使用拒绝规则和允许规则校验命令
+func (p *commandPolicy) check(tool, cmd string) error {
+	if err := p.checkDeny(tool, cmd); err != nil {
+		return err
+	}
+	return p.checkAllow(tool, cmd)
+}
+
+func (p *commandPolicy) checkDeny(tool, cmd string) error {
+	for _, re := range p.deny {
+		if re.MatchString(cmd) {
+			return &PolicyError{Tool: tool, Reason: fmt.Sprintf("command matches deny rule %q", re.String())}
+		}
+	}
+	return nil
+}
+
+func (p *commandPolicy) checkAllow(tool, cmd string) error {
+	if len(p.allow) == 0 {
+		return nil
+	}
+	for _, re := range p.allow {
+		if re.MatchString(cmd) {
+			return nil
+		}
+	}
+	return &PolicyError{Tool: tool, Reason: "command does not match any allow rule"}
+}
+
+// validateArgs 按参数定义校验经过类型转换的参数
+func validateArgs(tool string, params []Parameter, args map[string]any) error {
+	for _, p := range params {
+		v, ok := args[p.Name]
+		if !ok {
+			continue
+		}
+		if err := validateValue(p, v); err != nil {
+			return &PolicyError{Tool: tool, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+func validateValue(p Parameter, v any) error {
+	switch value := v.(type) {
+	case []any:
+		item := p.itemParameter()
+		for _, it := range value {
+			if err := validateValue(item, it); err != nil {
+				return err
+			}
+		}
+		return nil
+	case int64:
+		return checkRange(p, float64(value))
+	case float64:
+		return checkRange(p, value)
+	case bool:
+		return nil
+	}
+
+	s := fmt.Sprint(v)
+	maxLength := p.MaxLength
+	if maxLength <= 0 {
+		maxLength = defaultMaxLength
+	}
+	if len(s) > maxLength {
+		return fmt.Errorf("parameter %s exceeds max length %d", p.Name, maxLength)
+	}
+	if strings.ContainsAny(s, "\x00\n\r") {
+		return fmt.Errorf("parameter %s contains control characters", p.Name)
+	}
+	if len(p.Enum) > 0 && !contains(p.Enum, s) {
+		return fmt.Errorf("parameter %s must be one of %v", p.Name, p.Enum)
+	}
+	// 以-开头的值会被命令解析为选项，如 kubectl 的 --server=...，转义无法避免，只有enum中配置的值允许
+	if len(p.Enum) == 0 && strings.HasPrefix(s, "-") {
+		return fmt.Errorf("parameter %s must not start with '-'", p.Name)
+	}
+	if p.pattern != nil && !p.pattern.MatchString(s) {
+		return fmt.Errorf("parameter %s does not match pattern %s", p.Name, p.Pattern)
+	}
+	return nil
+}
+
+func checkRange(p Parameter, n float64) error {
+	if p.Min != nil && n < *p.Min {
+		return fmt.Errorf("parameter %s must be >= %v", p.Name, *p.Min)
+	}
+	if p.Max != nil && n > *p.Max {
+		return fmt.Errorf("parameter %s must be <= %v", p.Name, *p.Max)
+	}
+	if len(p.Enum) > 0 && !contains(p.Enum, strconv.FormatFloat(n, 'f', -1, 64)) {
+		return fmt.Errorf("parameter %s must be one of %v", p.Name, p.Enum)
+	}
+	return nil
+}
+
+// quoteArgs 对字符串参数进行shell转义，配置了raw的参数原样保留
+// 数字和布尔值保持原类型，模板中可以直接用于条件判断；未传入的可选参数渲染为空
+func quoteArgs(params []Parameter, args map[string]any) map[string]any {
+	return renderArgs(params, args, func(p Parameter, v any) any {
+		if p.Raw {
+			return v
+		}
+		return quoteValue(v)
+	})
+}
+
+// maskArgs 生成检查拒绝规则使用的参数，自由文本参数替换为占位符
+// 参数值是用户数据，如名为 node-reboot-agent 的Pod或 grep 的关键字，不应触发拒绝规则
+// raw参数会成为命令的一部分，enum参数的取值来自配置，两者保留原值参与检查
+func maskArgs(params []Parameter, args map[string]any) map[string]any {
+	return renderArgs(params, args, func(p Parameter, v any) any {
+		switch {
+		case p.Raw:
+			return v
+		case len(p.Enum) > 0:
+			return quoteValue(v)
+		}
+		return maskValue(v)
+	})
+}
+
+func renderArgs(params []Parameter, args map[string]any, render func(p Parameter, v any) any) map[string]any {
+	defs := make(map[string]Parameter, len(params))
+	rendered := make(map[string]any, len(args)+len(params))
+	for _, p := range params {
+		defs[p.Name] = p
+		rendered[p.Name] = p.zeroValue()
+	}
+
+	for k, v := range args {
+		p, ok := defs[k]
+		if !ok {
+			p = Parameter{Name: k}
+		}
+		rendered[k] = render(p, v)
+	}
+	return rendered
+}
+
+func maskValue(v any) any {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case []any:
+		items := make([]string, 0, len(value))
+		for _, it := range value {
+			items = append(items, fmt.Sprint(maskValue(it)))
+		}
+		return items
+	case int64, float64, bool:
+		return value
+	}
+	return maskedArg
+}
+
+func quoteValue(v any) any {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return shellQuote(value)
+	case []any:
+		// 数组元素转义后以字符串形式渲染，模板中使用 range 或 join 展开
+		items := make([]string, 0, len(value))
+		for _, it := range value {
+			items = append(items, fmt.Sprint(quoteValue(it)))
+		}
+		return items
+	case int64, float64, bool:
+		return value
+	}
+	return shellQuote(fmt.Sprint(v))
+}
+
+// shellQuote 使用单引号包裹参数，参数中的单引号会被转义
+func shellQuote(s string) string {
+	if safeArgPattern.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// prepareCommand 转换并校验参数、转义后渲染命令，并检查命令策略
+func prepareCommand(tool string, tmpl ExecTemplate, policy *commandPolicy, args map[string]any) (string, error) {
+	args, err := coerceArgs(tool, tmpl.Parameters, args)
+	if err != nil {
+		return "", err
+	}
+	if err := validateArgs(tool, tmpl.Parameters, args); err != nil {
+		return "", err
+	}
+
+	cmd, err := renderCommandTemplate(tool, tmpl.Exec, quoteArgs(tmpl.Parameters, args))
+	if err != nil {
+		return "", err
+	}
+	masked, err := renderCommandTemplate(tool, tmpl.Exec, maskArgs(tmpl.Parameters, args))
+	if err != nil {
+		return "", err
+	}
+
+	if err := policy.checkDeny(tool, masked); err != nil {
+		return "", err
+	}
+	if err := policy.checkAllow(tool, cmd); err != nil {
+		return "", err
+	}
+	return cmd, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPolicyTool(t *testing.T, policy *CommandPolicy, tmpl ExecTemplate) *TemplateLocalTool {
+	t.Helper()
+	lt, err := NewTemplateLocalTool(&ToolConfig{
+		ToolName:      "shell",
+		Policy:        policy,
+		ExecTemplates: []ExecTemplate{tmpl},
+	}, tmpl.Name)
+	require.NoError(t, err)
+	return lt
+}
+
+func TestArgumentsAreQuoted(t *testing.T) {
+	lt := newPolicyTool(t, nil, ExecTemplate{
+		Name:       "echo",
+		Exec:       "echo {{.msg}}",
+		Parameters: []Parameter{{Name: "msg", Required: true}},
+	})
+
+	for _, msg := range []string{"/; echo injected", "$(echo injected)", "`echo injected`", "it's | cat"} {
+		out, err := lt.InvokableRun(context.Background(), `{"msg": `+jsonString(msg)+`}`)
+		require.NoError(t, err, msg)
+		assert.Equal(t, msg+"\n", out)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, "/var/log", shellQuote("/var/log"))
+	assert.Equal(t, "kube-system", shellQuote("kube-system"))
+	assert.Equal(t, "''", shellQuote(""))
+	assert.Equal(t, `'a b'`, shellQuote("a b"))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}
+
+func TestDenyDestructiveCommands(t *testing.T) {
+	policy, err := compilePolicy(&CommandPolicy{Deny: []string{`\bcrontab\s+-r\b`}})
+	require.NoError(t, err)
+
+	for _, cmd := range []string{
+		"rm -rf /",
+		"rm -r -f /var",
+		"mkfs.ext4 /dev/sda1",
+		"dd if=/dev/zero of=/dev/sda",
+		"shutdown -h now",
+		"reboot",
+		":(){ :|:& };:",
+		"chmod -R 777 /",
+		"kubectl delete pod web",
+		"psql -c 'DROP TABLE users'",
+		"crontab -r",
+	} {
+		err := policy.check("shell", cmd)
+		assert.True(t, IsPolicyError(err), cmd)
+	}
+
+	for _, cmd := range []string{"df -h /", "ls -rt /var/log", "kubectl get pods -n default", "rmdir /tmp/x"} {
+		assert.NoError(t, policy.check("shell", cmd), cmd)
+	}
+}
+
+func TestAllowList(t *testing.T) {
+	policy, err := compilePolicy(&CommandPolicy{Allow: []string{`^kubectl get `}})
+	require.NoError(t, err)
+	assert.NoError(t, policy.check("shell", "kubectl get pods"))
+	assert.True(t, IsPolicyError(policy.check("shell", "kubectl logs web")))
+
+	_, err = compilePolicy(&CommandPolicy{Deny: []string{"("}})
+	assert.Error(t, err)
+}
+
+func TestValidateArguments(t *testing.T) {
+	lt := newPolicyTool(t, nil, ExecTemplate{
+		Name: "check",
+		Exec: "echo {{.path}} {{.level}} {{.lines}}",
+		Parameters: []Parameter{
+			{Name: "path", Required: true, Pattern: `/[A-Za-z0-9_./-]*`, MaxLength: 16},
+			{Name: "level", Enum: []string{"info", "error"}},
+			{Name: "lines", Type: ParamTypeInteger},
+		},
+	})
+
+	out, err := lt.InvokableRun(context.Background(), `{"path": "/var/log", "level": "error", "lines": 10}`)
+	require.NoError(t, err)
+	assert.Equal(t, "/var/log error 10\n", out)
+
+	for _, args := range []string{
+		`{}`,
+		`{"path": "/; rm -rf /"}`,
+		`{"path": "/var/log/very/long/path"}`,
+		`{"path": "/var", "level": "debug"}`,
+		`{"path": "/var", "lines": "ten"}`,
+		`{"path": 1}`,
+	} {
+		_, err := lt.InvokableRun(context.Background(), args)
+		assert.True(t, IsPolicyError(err), args)
+	}
+}
+
+func TestOptionInjectionRejected(t *testing.T) {
+	lt := newPolicyTool(t, nil, ExecTemplate{
+		Name: "describe_pod",
+		Exec: "echo describe pod {{.pod_name}} {{.labels}} {{.flag}}",
+		Parameters: []Parameter{
+			{Name: "pod_name", Required: true},
+			{Name: "labels", Type: ParamTypeArray, Items: &Parameter{Pattern: `[A-Za-z0-9=-]+`}},
+			{Name: "flag", Enum: []string{"-A"}},
+		},
+	})
+
+	for _, args := range []string{
+		`{"pod_name": "--server=https://attacker:443"}`,
+		`{"pod_name": "-n"}`,
+		`{"pod_name": "web-1", "labels": ["-lapp=x"]}`,
+	} {
+		_, err := lt.InvokableRun(context.Background(), args)
+		assert.True(t, IsPolicyError(err), args)
+		assert.ErrorContains(t, err, "must not start with '-'", args)
+	}
+
+	// 名称中间的-和enum中配置的选项不受影响
+	out, err := lt.InvokableRun(context.Background(), `{"pod_name": "node-reboot-agent", "flag": "-A"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "describe pod node-reboot-agent [] -A\n", out)
+}
+
+func TestRenderedCommandIsChecked(t *testing.T) {
+	lt := newPolicyTool(t, nil, ExecTemplate{
+		Name:       "run",
+		Exec:       "{{.cmd}}",
+		Parameters: []Parameter{{Name: "cmd", Required: true, Raw: true, Pattern: `[A-Za-z0-9 /._-]+`}},
+	})
+
+	_, err := lt.InvokableRun(context.Background(), `{"cmd": "rm -rf /tmp/x"}`)
+	assert.True(t, IsPolicyError(err))
+	assert.Contains(t, err.Error(), "run rejected by policy")
+
+	// 模板本身的命令仍按拒绝规则检查
+	lt = newPolicyTool(t, nil, ExecTemplate{
+		Name:       "clean",
+		Exec:       "rm -rf {{.path}}",
+		Parameters: []Parameter{{Name: "path", Required: true}},
+	})
+	_, err = lt.InvokableRun(context.Background(), `{"path": "/tmp/x"}`)
+	assert.True(t, IsPolicyError(err))
+}
+
+func TestDenyIgnoresArgumentValues(t *testing.T) {
+	lt := newPolicyTool(t, nil, ExecTemplate{
+		Name:       "grep",
+		Exec:       "echo {{.pod}} {{.keyword}}",
+		Parameters: []Parameter{{Name: "pod", Required: true}, {Name: "keyword", Required: true}},
+	})
+
+	out, err := lt.InvokableRun(context.Background(), `{"pod": "node-reboot-agent", "keyword": "drop table"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "node-reboot-agent drop table\n", out)
+}
+
+func TestRawRequiresPattern(t *testing.T) {
+	_, err := NewTemplateLocalTool(&ToolConfig{
+		ToolName: "shell",
+		ExecTemplates: []ExecTemplate{{
+			Name:       "run",
+			Exec:       "{{.cmd}}",
+			Parameters: []Parameter{{Name: "cmd", Required: true, Raw: true}},
+		}},
+	}, "run")
+	assert.ErrorContains(t, err, "raw requires pattern or enum")
+
+	for _, p := range []Parameter{
+		{Name: "level", Raw: true, Enum: []string{"info", "error"}},
+		{Name: "flags", Raw: true, Type: ParamTypeArray, Items: &Parameter{Pattern: `-[a-z]`}},
+		{Name: "lines", Raw: true, Type: ParamTypeInteger},
+	} {
+		_, err := validateParameters([]Parameter{p})
+		assert.NoError(t, err, p.Name)
+	}
+	_, err = validateParameters([]Parameter{{Name: "flags", Raw: true, Type: ParamTypeArray}})
+	assert.Error(t, err)
+}
+
+func TestInvalidPatternFailsBuild(t *testing.T) {
+	_, err := NewTemplateLocalTool(&ToolConfig{
+		ToolName: "shell",
+		ExecTemplates: []ExecTemplate{{
+			Name:       "ls",
+			Exec:       "ls {{.path}}",
+			Parameters: []Parameter{{Name: "path", Pattern: `/[a-z`}},
+		}},
+	}, "ls")
+	assert.ErrorContains(t, err, "parameter path has invalid pattern")
+
+	_, err = validateParameters([]Parameter{{Name: "paths", Type: ParamTypeArray, Items: &Parameter{Pattern: `(`}}})
+	assert.ErrorContains(t, err, "parameter paths items")
+
+	// 编译后的pattern缓存在返回的参数定义中，不修改传入的配置
+	params := []Parameter{{Name: "path", Pattern: `/[a-z]+`}}
+	compiled, err := validateParameters(params)
+	require.NoError(t, err)
+	assert.Nil(t, params[0].pattern)
+	assert.NoError(t, validateValue(compiled[0], "/var"))
+	assert.Error(t, validateValue(compiled[0], "var"))
+}
+
+func jsonString(s string) string {
+	raw, _ := json.Marshal(s)
+	return string(raw)
+}
@@ -0,0 +1,195 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+)
+
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+	defaultMultiplier     = 2.0
+	defaultJitter         = 0.2
+)
+
+// retryableMessages 瞬时故障的错误信息，kubectl等命令行工具的错误只能通过输出判断
+var retryableMessages = []string{
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"too many requests",   // kubectl 被 apiserver 限流
+	"client rate limiter", // kubectl 客户端限流
+	"the server is currently unable to handle the request",
+	"etcdserver: request timed out",
+}
+
+// RetryPolicy 工具调用的重试策略，仅对瞬时故障重试
+type RetryPolicy struct {
+	MaxAttempts    int      `json:"maxAttempts" yaml:"maxAttempts"`       // 最大尝试次数（含首次），小于等于1时不重试
+	InitialBackoff int      `json:"initialBackoff" yaml:"initialBackoff"` // 首次重试前的等待时间（毫秒），默认500毫秒
+	MaxBackoff     int      `json:"maxBackoff" yaml:"maxBackoff"`         // 等待时间上限（毫秒），默认10秒
+	Multiplier     float64  `json:"multiplier" yaml:"multiplier"`         // 每次重试等待时间的增长倍数，默认2
+	Jitter         float64  `json:"jitter" yaml:"jitter"`                 // 等待时间的随机浮动比例，取值0~1，默认0.2
+	RetryOn        []string `json:"retryOn" yaml:"retryOn"`               // 在内置分类之外追加的可重试错误（正则），匹配错误信息
+}
+
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	jitter         float64
+	retryOn        []*regexp.Regexp
+}
+
+// compileRetryPolicy 编译重试策略，未配置时返回nil，即不重试
+func compileRetryPolicy(p *RetryPolicy) (*retryPolicy, error) {
+	if p == nil || p.MaxAttempts <= 1 {
+		return nil, nil
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 || p.Multiplier < 0 {
+		return nil, fmt.Errorf("retry backoff must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return nil, fmt.Errorf("retry jitter must be between 0 and 1")
+	}
+
+	compiled := &retryPolicy{
+		maxAttempts:    p.MaxAttempts,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		multiplier:     defaultMultiplier,
+		jitter:         defaultJitter,
+	}
+	if p.InitialBackoff > 0 {
+		compiled.initialBackoff = time.Duration(p.InitialBackoff) * time.Millisecond
+	}
+	if p.MaxBackoff > 0 {
+		compiled.maxBackoff = time.Duration(p.MaxBackoff) * time.Millisecond
+	}
+	if p.Multiplier > 0 {
+		compiled.multiplier = p.Multiplier
+	}
+	if p.Jitter > 0 {
+		compiled.jitter = p.Jitter
+	}
+	for _, pattern := range p.RetryOn {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retryOn pattern %q: %w", pattern, err)
+		}
+		compiled.retryOn = append(compiled.retryOn, re)
+	}
+	return compiled, nil
+}
+
+// backoff 第n次重试前的等待时间，按倍数增长并随机浮动，避免多个调用同时重试
+func (p *retryPolicy) backoff(n int) time.Duration {
+	d := float64(p.initialBackoff) * math.Pow(p.multiplier, float64(n-1))
+	d = math.Min(d, float64(p.maxBackoff))
+	d += d * p.jitter * (2*rand.Float64() - 1)
+	return time.Duration(d)
+}
+
+// retryable 判断错误是否为瞬时故障
+func (p *retryPolicy) retryable(err error) bool {
+	if IsRetryable(err) {
+		return true
+	}
+	if err == nil || IsPolicyError(err) || IsHostKeyMismatch(err) {
+		return false
+	}
+	for _, re := range p.retryOn {
+		if re.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRetryable 判断错误是否为可重试的瞬时故障：连接建立失败、连接被重置、apiserver限流等
+// 策略拒绝和主机密钥不一致永远不会重试；命令已产生输出后超时说明命令本身执行缓慢，重试无意义
+func IsRetryable(err error) bool {
+	if err == nil || IsPolicyError(err) || IsHostKeyMismatch(err) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var timeout *TimeoutError
+	if errors.As(err, &timeout) {
+		return timeout.Output == ""
+	}
+	if errors.Is(err, errSessionFailed) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, m := range retryableMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry 按重试策略执行fn，返回最后一次的结果和实际尝试次数
+// 等待重试期间ctx被取消时返回最后一次的错误
+func withRetry(ctx context.Context, p *retryPolicy, fn func(ctx context.Context) (string, error)) (string, int, error) {
+	out, err := fn(ctx)
+	if p == nil {
+		return out, 1, err
+	}
+
+	attempts := 1
+	for ; attempts < p.maxAttempts && p.retryable(err); attempts++ {
+		timer := time.NewTimer(p.backoff(attempts))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return out, attempts, err
+		case <-timer.C:
+		}
+		out, err = fn(ctx)
+	}
+	return out, attempts, err
+}
+
+// retryOptions 工具调用的实现相关选项
+type retryOptions struct {
+	attempts *int
+}
+
+// WithAttempts 调用结束后将实际尝试次数写入n，用于在执行记录中统计重试
+func WithAttempts(n *int) tool.Option {
+	return tool.WrapImplSpecificOptFn(func(o *retryOptions) {
+		o.attempts = n
+	})
+}
+
+// reportAttempts 将尝试次数写回调用方
+func reportAttempts(attempts int, opts ...tool.Option) {
+	o := tool.GetImplSpecificOptions(&retryOptions{}, opts...)
+	if o.attempts != nil {
+		*o.attempts = attempts
+	}
+}
@@ -0,0 +1,149 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyCommand 前fails次执行输出指定错误并失败，之后输出ok
+func flakyCommand(t *testing.T, fails int, stderr string) string {
+	counter := filepath.Join(t.TempDir(), "count")
+	return fmt.Sprintf(`n=$(cat %[1]s 2>/dev/null || echo 0); n=$((n+1)); echo $n > %[1]s; `+
+		`if [ $n -le %[2]d ]; then echo '%[3]s' >&2; exit 1; fi; echo ok`, counter, fails, stderr)
+}
+
+func TestLocalToolRetriesTransientFailure(t *testing.T) {
+	cfg := &ToolConfig{
+		ToolName: "kubectl",
+		Retry:    &RetryPolicy{MaxAttempts: 3, InitialBackoff: 10},
+		ExecTemplates: []ExecTemplate{
+			{Name: "throttled", Exec: flakyCommand(t, 2, "Error from server (TooManyRequests): the server has received too many requests")},
+		},
+	}
+	lt, err := NewTemplateLocalTool(cfg, "throttled")
+	require.NoError(t, err)
+
+	var attempts int
+	out, err := lt.InvokableRun(context.Background(), `{}`, WithAttempts(&attempts))
+	require.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestLocalToolDoesNotRetryPermanentFailure(t *testing.T) {
+	cfg := &ToolConfig{
+		ToolName: "kubectl",
+		ExecTemplates: []ExecTemplate{
+			{
+				Name:  "missing",
+				Exec:  flakyCommand(t, 2, "Error from server (NotFound): pods not found"),
+				Retry: &RetryPolicy{MaxAttempts: 3, InitialBackoff: 10},
+			},
+		},
+	}
+	lt, err := NewTemplateLocalTool(cfg, "missing")
+	require.NoError(t, err)
+
+	var attempts int
+	_, err = lt.InvokableRun(context.Background(), `{}`, WithAttempts(&attempts))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NotFound")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryOnPattern(t *testing.T) {
+	cfg := &ToolConfig{
+		ToolName: "kubectl",
+		Retry:    &RetryPolicy{MaxAttempts: 2, InitialBackoff: 10, RetryOn: []string{`(?i)leader changed`}},
+		ExecTemplates: []ExecTemplate{
+			{Name: "leader", Exec: flakyCommand(t, 1, "etcdserver: leader changed")},
+		},
+	}
+	lt, err := NewTemplateLocalTool(cfg, "leader")
+	require.NoError(t, err)
+
+	var attempts int
+	out, err := lt.InvokableRun(context.Background(), `{}`, WithAttempts(&attempts))
+	require.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestBashToolRetriesDialFailure(t *testing.T) {
+	// 监听后立即关闭，得到一个拒绝连接的端口
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	cfg := &ToolConfig{
+		ToolName: "bash",
+		Retry:    &RetryPolicy{MaxAttempts: 3, InitialBackoff: 10},
+		AuthConfig: &AuthConfig{GlobalAuth: map[string]string{
+			authUser:               "root",
+			authPassword:           "secret",
+			authHost:               "127.0.0.1",
+			authSSHPort:            strconv.Itoa(port),
+			authHostKeyFingerprint: "SHA256:unused",
+		}},
+		ExecTemplates: []ExecTemplate{{Name: "uptime", Exec: "uptime"}},
+	}
+	bt, err := NewTemplateBashTool(cfg, "uptime", nil)
+	require.NoError(t, err)
+
+	var attempts int
+	_, err = bt.InvokableRun(context.Background(), `{}`, WithAttempts(&attempts))
+	require.Error(t, err)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetryStopsWhenContextCanceled(t *testing.T) {
+	p, err := compileRetryPolicy(&RetryPolicy{MaxAttempts: 5, InitialBackoff: 10000})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, attempts, err := withRetry(ctx, p, func(ctx context.Context) (string, error) {
+		return "", errors.New("read: connection reset by peer")
+	})
+	require.Error(t, err)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(&TimeoutError{Tool: "ssh"}))
+	assert.False(t, IsRetryable(&TimeoutError{Tool: "ssh", Output: "partial"}))
+	assert.True(t, IsRetryable(fmt.Errorf("%w: EOF", errSessionFailed)))
+	assert.True(t, IsRetryable(&net.OpError{Op: "dial", Err: errors.New("no route to host")}))
+	assert.True(t, IsRetryable(errors.New("net/http: TLS handshake timeout")))
+	assert.False(t, IsRetryable(&PolicyError{Tool: "bash", Reason: "connection reset"}))
+	assert.False(t, IsRetryable(&HostKeyMismatchError{Host: "master"}))
+	assert.False(t, IsRetryable(context.Canceled))
+	assert.False(t, IsRetryable(nil))
+}
+
+func TestBackoff(t *testing.T) {
+	p, err := compileRetryPolicy(&RetryPolicy{MaxAttempts: 5, InitialBackoff: 100, MaxBackoff: 300, Jitter: 0.1})
+	require.NoError(t, err)
+	assert.InDelta(t, 100*time.Millisecond, p.backoff(1), float64(10*time.Millisecond))
+	assert.InDelta(t, 200*time.Millisecond, p.backoff(2), float64(20*time.Millisecond))
+	assert.InDelta(t, 300*time.Millisecond, p.backoff(4), float64(30*time.Millisecond))
+
+	_, err = compileRetryPolicy(&RetryPolicy{MaxAttempts: 2, Jitter: 2})
+	assert.Error(t, err)
+	noRetry, err := compileRetryPolicy(&RetryPolicy{MaxAttempts: 1})
+	require.NoError(t, err)
+	assert.Nil(t, noRetry)
+}
@@ -0,0 +1,279 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultMaxSessions = 10
+	defaultIdleTimeout = 5 * time.Minute
+	defaultKeepAlive   = 30 * time.Second
+
+	keepAliveRequest   = "keepalive@openssh.com"
+	healthCheckTimeout = 5 * time.Second
+	minJanitorInterval = 10 * time.Millisecond
+)
+
+var ErrPoolClosed = errors.New("ssh pool is closed")
+
+// SSHPoolConfig ssh连接池配置
+type SSHPoolConfig struct {
+	MaxSessions int `json:"maxSessions" yaml:"maxSessions"` // 单个节点最大并发会话数，默认10
+	IdleTimeout int `json:"idleTimeout" yaml:"idleTimeout"` // 空闲连接回收时间（秒），默认300秒
+	KeepAlive   int `json:"keepAlive" yaml:"keepAlive"`     // 空闲连接健康检查间隔（秒），默认30秒
+}
+
+// SSHPool 按节点复用ssh连接，并限制每个节点的并发会话数
+type SSHPool struct {
+	maxSessions int
+	idleTimeout time.Duration
+	keepAlive   time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+	closed  bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type pooledClient struct {
+	key      string
+	sessions chan struct{} // 并发会话信号量
+
+	mu       sync.Mutex // 保护client的建立和替换
+	client   *ssh.Client
+	inUse    int
+	lastUsed time.Time
+}
+
+// SSHLease 从连接池借出的连接，使用完毕后必须调用Release或Discard
+type SSHLease struct {
+	Client *ssh.Client
+
+	pool  *SSHPool
+	entry *pooledClient
+	once  sync.Once
+}
+
+func NewSSHPool(cfg *SSHPoolConfig) *SSHPool {
+	maxSessions, idleTimeout, keepAlive := defaultMaxSessions, defaultIdleTimeout, defaultKeepAlive
+	if cfg != nil {
+		if cfg.MaxSessions > 0 {
+			maxSessions = cfg.MaxSessions
+		}
+		if cfg.IdleTimeout > 0 {
+			idleTimeout = time.Duration(cfg.IdleTimeout) * time.Second
+		}
+		if cfg.KeepAlive > 0 {
+			keepAlive = time.Duration(cfg.KeepAlive) * time.Second
+		}
+	}
+	return newSSHPool(maxSessions, idleTimeout, keepAlive)
+}
+
+func newSSHPool(maxSessions int, idleTimeout, keepAlive time.Duration) *SSHPool {
+	p := &SSHPool{
+		maxSessions: maxSessions,
+		idleTimeout: idleTimeout,
+		keepAlive:   keepAlive,
+		clients:     make(map[string]*pooledClient),
+		done:        make(chan struct{}),
+	}
+
+	interval := keepAlive
+	if idleTimeout < interval {
+		interval = idleTimeout
+	}
+	p.wg.Add(1)
+	go p.janitor(max(interval/2, minJanitorInterval))
+
+	return p
+}
+
+// Acquire 获取节点的连接，连接不存在或不健康时使用dial重新建立
+func (p *SSHPool) Acquire(ctx context.Context, key string, dial func(ctx context.Context) (*ssh.Client, error)) (*SSHLease, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	entry, ok := p.clients[key]
+	if !ok {
+		entry = &pooledClient{key: key, sessions: make(chan struct{}, p.maxSessions)}
+		p.clients[key] = entry
+	}
+	entry.inUse++
+	p.mu.Unlock()
+
+	// 等待节点的空闲会话
+	select {
+	case entry.sessions <- struct{}{}:
+	case <-ctx.Done():
+		p.unref(entry)
+		return nil, ctx.Err()
+	}
+
+	client, err := p.ensureClient(ctx, entry, dial)
+	if err != nil {
+		<-entry.sessions
+		p.unref(entry)
+		return nil, err
+	}
+
+	return &SSHLease{Client: client, pool: p, entry: entry}, nil
+}
+
+func (p *SSHPool) ensureClient(ctx context.Context, entry *pooledClient, dial func(ctx context.Context) (*ssh.Client, error)) (*ssh.Client, error) {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	// 长时间未使用的连接在复用前进行健康检查
+	if entry.client != nil && time.Since(entry.lastUsed) > p.keepAlive && !isHealthy(entry.client) {
+		entry.client.Close()
+		entry.client = nil
+	}
+	if entry.client != nil {
+		return entry.client, nil
+	}
+
+	client, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entry.client = client
+	entry.lastUsed = time.Now()
+	return client, nil
+}
+
+// Release 归还连接
+func (l *SSHLease) Release() {
+	l.once.Do(func() {
+		l.entry.mu.Lock()
+		l.entry.lastUsed = time.Now()
+		l.entry.mu.Unlock()
+		<-l.entry.sessions
+		l.pool.unref(l.entry)
+	})
+}
+
+// Discard 连接已不可用，关闭连接并归还会话
+func (l *SSHLease) Discard() {
+	l.once.Do(func() {
+		l.entry.mu.Lock()
+		if l.entry.client == l.Client {
+			l.entry.client = nil
+		}
+		l.entry.mu.Unlock()
+		l.Client.Close()
+		<-l.entry.sessions
+		l.pool.unref(l.entry)
+	})
+}
+
+// unref 减少连接的使用计数，连接池关闭后最后一个使用者负责关闭连接
+func (p *SSHPool) unref(entry *pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry.inUse--
+	if p.closed && entry.inUse == 0 {
+		entry.close()
+	}
+}
+
+func (c *pooledClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		c.client.Close()
+		c.client = nil
+	}
+}
+
+// janitor 定期回收空闲连接并检查连接健康状态
+func (p *SSHPool) janitor(interval time.Duration) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.evict()
+		}
+	}
+}
+
+func (p *SSHPool) evict() {
+	p.mu.Lock()
+	idle := make([]*pooledClient, 0)
+	for key, entry := range p.clients {
+		if entry.inUse > 0 {
+			continue
+		}
+		entry.mu.Lock()
+		expired := entry.client == nil || time.Since(entry.lastUsed) > p.idleTimeout
+		entry.mu.Unlock()
+		if expired {
+			delete(p.clients, key)
+			entry.close()
+			continue
+		}
+		idle = append(idle, entry)
+	}
+	p.mu.Unlock()
+
+	// 健康检查需要网络往返，不持有连接池的锁
+	for _, entry := range idle {
+		entry.mu.Lock()
+		if entry.client != nil && !isHealthy(entry.client) {
+			entry.client.Close()
+			entry.client = nil
+		}
+		entry.mu.Unlock()
+	}
+}
+
+// Close 关闭连接池，空闲连接立即关闭，使用中的连接在归还后关闭
+func (p *SSHPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	for key, entry := range p.clients {
+		if entry.inUse == 0 {
+			entry.close()
+		}
+		delete(p.clients, key)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return nil
+}
+
+// isHealthy 发送keepalive请求检查连接是否可用
+func isHealthy(client *ssh.Client) bool {
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest(keepAliveRequest, true, nil)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return err == nil
+	case <-time.After(healthCheckTimeout):
+		return false
+	}
+}
@@ -0,0 +1,200 @@
+package impl
+
+import (
+	"agent-samples/pkg/secret"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newPooledBashTool(t *testing.T, server *testSSHServer, pool *SSHPool, exec string) *TemplateBashTool {
+	t.Helper()
+	cfg := &ToolConfig{
+		ToolName: "bash",
+		AuthConfig: &AuthConfig{
+			Type:      AuthTypePerNode,
+			NodeAuths: map[string]map[string]string{"master": server.nodeAuth()},
+		},
+		ExecTemplates: []ExecTemplate{{Name: "run", Exec: exec}},
+	}
+	bt, err := NewTemplateBashTool(cfg, "run", pool)
+	require.NoError(t, err)
+	return bt
+}
+
+func TestSSHPoolReusesConnection(t *testing.T) {
+	server := newTestSSHServer(t)
+	pool := newSSHPool(4, time.Minute, time.Minute)
+	defer pool.Close()
+	bt := newPooledBashTool(t, server, pool, "echo {{.msg}}")
+
+	for _, msg := range []string{"a", "b", "c"} {
+		out, err := bt.InvokableRun(context.Background(), `{"node": "master", "msg": "`+msg+`"}`)
+		require.NoError(t, err)
+		assert.Equal(t, "echo "+msg+"\n", out)
+	}
+	assert.Equal(t, int32(1), server.handshakes.Load())
+}
+
+func TestSSHPoolLimitsSessionsPerNode(t *testing.T) {
+	server := newTestSSHServer(t)
+	pool := newSSHPool(2, time.Minute, time.Minute)
+	defer pool.Close()
+	bt := newPooledBashTool(t, server, pool, "sleep 100")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := bt.InvokableRun(context.Background(), `{"node": "master"}`)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), server.maxSessions.Load())
+	assert.Equal(t, int32(1), server.handshakes.Load())
+}
+
+func TestSSHPoolEvictsIdleConnections(t *testing.T) {
+	server := newTestSSHServer(t)
+	pool := newSSHPool(2, 100*time.Millisecond, time.Minute)
+	defer pool.Close()
+	bt := newPooledBashTool(t, server, pool, "echo hi")
+
+	_, err := bt.InvokableRun(context.Background(), `{"node": "master"}`)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return len(pool.clients) == 0
+	}, 2*time.Second, 20*time.Millisecond)
+
+	_, err = bt.InvokableRun(context.Background(), `{"node": "master"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), server.handshakes.Load())
+}
+
+func TestSSHPoolKeepsConnectionAfterTimeout(t *testing.T) {
+	server := newTestSSHServer(t)
+	pool := newSSHPool(4, time.Minute, time.Minute)
+	defer pool.Close()
+	slow := newPooledBashTool(t, server, pool, "sleep 300")
+	bt := newPooledBashTool(t, server, pool, "sleep 2000")
+
+	// 同一连接上的其他会话不受超时命令的影响
+	done := make(chan error, 1)
+	go func() {
+		_, err := slow.InvokableRun(context.Background(), `{"node": "master"}`)
+		done <- err
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := bt.InvokableRun(ctx, `{"node": "master"}`)
+	var te *TimeoutError
+	require.ErrorAs(t, err, &te)
+	require.NoError(t, <-done)
+	assert.Equal(t, int32(1), server.handshakes.Load())
+}
+
+func TestBashToolCanceled(t *testing.T) {
+	server := newTestSSHServer(t)
+	pool := newSSHPool(4, time.Minute, time.Minute)
+	defer pool.Close()
+	bt := newPooledBashTool(t, server, pool, "sleep 2000")
+
+	// 取消不是超时，不应报告为超时
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := bt.InvokableRun(ctx, `{"node": "master"}`)
+	require.ErrorIs(t, err, context.Canceled)
+	var te *TimeoutError
+	assert.False(t, errors.As(err, &te))
+	assert.EqualError(t, err, "run canceled: context canceled")
+}
+
+func TestSSHPoolRedialsBrokenConnection(t *testing.T) {
+	server := newTestSSHServer(t)
+	// keepAlive很短时每次复用前都会检查连接
+	pool := newSSHPool(2, time.Minute, time.Nanosecond)
+	defer pool.Close()
+	bt := newPooledBashTool(t, server, pool, "echo hi")
+
+	_, err := bt.InvokableRun(context.Background(), `{"node": "master"}`)
+	require.NoError(t, err)
+
+	server.dropConnections()
+	out, err := bt.InvokableRun(context.Background(), `{"node": "master"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "echo hi\n", out)
+	assert.Equal(t, int32(2), server.handshakes.Load())
+}
+
+func TestSSHPoolClose(t *testing.T) {
+	server := newTestSSHServer(t)
+	pool := newSSHPool(2, time.Minute, time.Minute)
+	bt := newPooledBashTool(t, server, pool, "echo hi")
+
+	_, err := bt.InvokableRun(context.Background(), `{"node": "master"}`)
+	require.NoError(t, err)
+
+	lease, err := pool.Acquire(context.Background(), "other", func(ctx context.Context) (*ssh.Client, error) {
+		return bt.getSSHClient(ctx, mustAuth(t, bt))
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, pool.Close())
+	_, err = bt.InvokableRun(context.Background(), `{"node": "master"}`)
+	assert.ErrorIs(t, err, ErrPoolClosed)
+
+	// 使用中的连接在归还后关闭
+	_, _, err = lease.Client.SendRequest(keepAliveRequest, true, nil)
+	assert.NoError(t, err)
+	lease.Release()
+	_, _, err = lease.Client.SendRequest(keepAliveRequest, true, nil)
+	assert.Error(t, err)
+}
+
+func mustAuth(t *testing.T, bt *TemplateBashTool) *sshAuth {
+	t.Helper()
+	auth, err := bt.resolveSSHAuth("master")
+	require.NoError(t, err)
+	return auth
+}
+
+func TestBashToolResolvesSecretRefs(t *testing.T) {
+	server := newTestSSHServer(t)
+	t.Setenv("TEST_SSH_PASSWORD", testSSHPassword)
+	auth := server.nodeAuth()
+	auth[authPassword] = "${env:TEST_SSH_PASSWORD}"
+
+	bt, err := NewTemplateBashTool(&ToolConfig{
+		ToolName: "bash",
+		AuthConfig: &AuthConfig{
+			Type:      AuthTypePerNode,
+			NodeAuths: map[string]map[string]string{"master": auth},
+		},
+		ExecTemplates: []ExecTemplate{{Name: "run", Exec: "echo " + testSSHPassword}},
+	}, "run", nil)
+	require.NoError(t, err)
+
+	out, err := bt.InvokableRun(context.Background(), `{"node": "master"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "echo ******\n", secret.Mask(out))
+
+	info, err := bt.Info(context.Background())
+	require.NoError(t, err)
+	js, err := info.ParamsOneOf.ToJSONSchema()
+	require.NoError(t, err)
+	raw, err := js.MarshalJSON()
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), testSSHPassword)
+}
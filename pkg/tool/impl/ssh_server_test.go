@@ -0,0 +1,154 @@
+package impl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	testSSHUser     = "ops"
+	testSSHPassword = "secret"
+)
+
+// testSSHServer 进程内的ssh服务端，替代真实主机执行命令
+// 命令 "sleep <ms>" 会等待指定毫秒数，其余命令原样回显
+type testSSHServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+
+	handshakes  atomic.Int32 // 成功建立的连接数
+	sessions    atomic.Int32 // 当前并发会话数
+	maxSessions atomic.Int32 // 最大并发会话数
+
+	mu    sync.Mutex
+	conns []*ssh.ServerConn
+}
+
+func newTestSSHServer(t *testing.T) *testSSHServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &testSSHServer{listener: listener, hostKey: newHostKey(t)}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == testSSHUser && string(password) == testSSHPassword {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", conn.User())
+		},
+	}
+	cfg.AddHostKey(s.hostKey)
+
+	go s.serve(cfg)
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropConnections()
+	})
+	return s
+}
+
+// nodeAuth 生成连接该服务端的节点认证信息
+func (s *testSSHServer) nodeAuth() map[string]string {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return map[string]string{
+		authUser:               testSSHUser,
+		authPassword:           testSSHPassword,
+		authHost:               host,
+		authSSHPort:            port,
+		authHostKeyFingerprint: ssh.FingerprintSHA256(s.hostKey.PublicKey()),
+	}
+}
+
+// dropConnections 服务端主动断开所有连接，模拟网络中断
+func (s *testSSHServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testSSHServer) serve(cfg *ssh.ServerConfig) {
+	for {
+		nConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			conn, chans, reqs, err := ssh.NewServerConn(nConn, cfg)
+			if err != nil {
+				nConn.Close()
+				return
+			}
+			s.handshakes.Add(1)
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+
+			go func() {
+				// 响应keepalive请求
+				for req := range reqs {
+					if req.WantReply {
+						req.Reply(true, nil)
+					}
+				}
+			}()
+			for newChannel := range chans {
+				if newChannel.ChannelType() != "session" {
+					newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+					continue
+				}
+				channel, requests, err := newChannel.Accept()
+				if err != nil {
+					continue
+				}
+				go s.handleSession(channel, requests)
+			}
+		}()
+	}
+}
+
+func (s *testSSHServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		// exec请求的payload为长度前缀的命令字符串
+		cmd := string(req.Payload[4:])
+		current := s.sessions.Add(1)
+		for {
+			max := s.maxSessions.Load()
+			if current <= max || s.maxSessions.CompareAndSwap(max, current) {
+				break
+			}
+		}
+
+		var ms int
+		if _, err := fmt.Sscanf(cmd, "sleep %d", &ms); err == nil {
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+		} else {
+			fmt.Fprintf(channel, "%s\n", strings.TrimSpace(cmd))
+		}
+		s.sessions.Add(-1)
+
+		status := make([]byte, 4)
+		binary.BigEndian.PutUint32(status, 0)
+		channel.SendRequest("exit-status", false, status)
+		return
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
+	"agent-samples/pkg/secret"
+
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
 	"golang.org/x/crypto/ssh"
@@ -33,24 +36,57 @@ type sshAuth struct {
 	KeyPath  string
 	Host     string
 	Port     int
+
+	HostKeyFingerprint string
+	KnownHostsFile     string
+	HostKeyPolicy      HostKeyPolicy
 }
 
 type TemplateBashTool struct {
 	config       *ToolConfig
 	execTemplate ExecTemplate
 	templateName string
+	policy       *commandPolicy
+	approval     *regexp.Regexp // 审批匹配规则，为nil时配置了requires_approval的调用都需要审批
+	retry        *retryPolicy   // 重试策略，为nil时不重试
+	pool         *SSHPool       // 为nil时每次调用单独建立连接
 }
 
-func NewTemplateBashTool(cfg *ToolConfig, templateName string) (*TemplateBashTool, error) {
+func NewTemplateBashTool(cfg *ToolConfig, templateName string, pool *SSHPool) (*TemplateBashTool, error) {
 	tmpl, err := findExecTemplate(cfg.ExecTemplates, templateName)
 	if err != nil {
 		return nil, err
 	}
+	if tmpl.Parameters, err = validateParameters(tmpl.Parameters); err != nil {
+		return nil, fmt.Errorf("%s: %w", templateName, err)
+	}
+	policy, err := compilePolicy(cfg.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.ToolName, err)
+	}
+	approval, err := compileApprovalMatch(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", templateName, err)
+	}
+	retry, err := compileRetryPolicy(cfg.GetRetry(tmpl))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", templateName, err)
+	}
+	if err := validateOutputLimit(cfg.GetOutputLimit(tmpl)); err != nil {
+		return nil, fmt.Errorf("%s: %w", templateName, err)
+	}
+	if _, err := GetAuthTypeDescription(cfg.AuthConfig.GetType()); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", cfg.ToolName, err, cfg.AuthConfig.GetType())
+	}
 
 	return &TemplateBashTool{
 		config:       cfg,
 		execTemplate: tmpl,
 		templateName: templateName,
+		policy:       policy,
+		approval:     approval,
+		retry:        retry,
+		pool:         pool,
 	}, nil
 }
 
@@ -63,22 +99,10 @@ func (t *TemplateBashTool) Description() string {
 }
 
 func (t *TemplateBashTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
-	params := make(map[string]*schema.ParameterInfo)
-
-	for _, p := range t.execTemplate.Parameters {
-		info := &schema.ParameterInfo{
-			Type:     "string",
-			Desc:     p.Description,
-			Required: p.Required,
-			Enum:     p.Enum,
-		}
-		params[p.Name] = info
-	}
+	params := parameterInfos(t.execTemplate.Parameters)
 
-	params[paramNode] = &schema.ParameterInfo{
-		Type:     "string",
-		Desc:     "节点 IP",
-		Required: true,
+	if node := t.nodeParameter(); node != nil {
+		params[paramNode] = node
 	}
 
 	return &schema.ToolInfo{
@@ -95,54 +119,155 @@ func (t *TemplateBashTool) InvokableRun(ctx context.Context, argumentsInJSON str
 	}
 
 	node := getStringArg(args, paramNode)
-	if node == "" {
+	if node == "" && t.requireNode() {
 		return "", errors.New("node is required")
 	}
 
-	cmd, err := t.renderCommandTemplate(ctx, t.execTemplate.Exec, args)
+	cmd, err := prepareCommand(t.templateName, t.execTemplate, t.policy, args)
 	if err != nil {
 		return "", err
 	}
 
-	return t.executeCommandOnNode(ctx, cmd, node)
+	out, attempts, err := withRetry(ctx, t.retry, func(ctx context.Context) (string, error) {
+		return t.run(ctx, cmd, node)
+	})
+	reportAttempts(attempts, opts...)
+	return out, err
 }
 
-func (t *TemplateBashTool) renderCommandTemplate(ctx context.Context, tpl string, args map[string]any) (string, error) {
-	tmpl, err := template.New("bash").Parse(tpl)
-	if err != nil {
-		return "", err
+// run 执行一次命令，超时时间对每次尝试单独计算
+func (t *TemplateBashTool) run(ctx context.Context, cmd, node string) (string, error) {
+	timeout := t.config.GetTimeout(t.execTemplate)
+	// 无需认证时直接在agent所在主机执行
+	if t.config.AuthConfig.GetType() == AuthTypeNone {
+		return runLocalCommand(ctx, t.templateName, timeout, cmd)
 	}
 
-	var buf strings.Builder
-	if err := tmpl.Execute(&buf, args); err != nil {
-		return "", err
+	// 超时时间同时作用于建立连接和执行命令
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	out, err := t.executeCommandOnNode(ctx, cmd, node)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		te := &TimeoutError{Tool: t.templateName, Timeout: timeout}
+		errors.As(err, &te)
+		te.Timeout = timeout
+		return "", te
+	}
+	return out, err
+}
+
+// nodeParameter 根据认证类型生成node参数，无需节点信息时返回nil
+func (t *TemplateBashTool) nodeParameter() *schema.ParameterInfo {
+	authType := t.config.AuthConfig.GetType()
+	if authType == AuthTypeNone {
+		return nil
 	}
 
-	return buf.String(), nil
+	desc, _ := GetAuthTypeDescription(authType)
+	if authType == AuthTypePerNode {
+		desc = fmt.Sprintf("%s，可选节点: %s", desc, strings.Join(t.config.AuthConfig.NodeNames(), ", "))
+	}
+
+	return &schema.ParameterInfo{
+		Type:     "string",
+		Desc:     desc,
+		Required: t.requireNode(),
+	}
 }
 
-func (t *TemplateBashTool) getSSHClient(ctx context.Context, node string) (*ssh.Client, error) {
-	raw, ok := t.config.AuthConfig.NodeAuths[node]
-	if !ok {
-		return nil, fmt.Errorf("node auth not found: %s", node)
+// requireNode 是否必须传入node参数，全局认证中已配置host时可省略
+func (t *TemplateBashTool) requireNode() bool {
+	switch t.config.AuthConfig.GetType() {
+	case AuthTypePerNode:
+		return true
+	case AuthTypeGlobal:
+		return t.config.AuthConfig.GlobalAuth[authHost] == ""
 	}
+	return false
+}
 
-	auth, err := parseSSHAuth(raw)
+func (t *TemplateBashTool) getSSHClient(ctx context.Context, auth *sshAuth) (*ssh.Client, error) {
+	cfg, err := buildSSHConfig(auth)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg, err := buildSSHConfig(auth)
+	return dialSSH(ctx, auth.addr(), cfg)
+}
+
+func (a *sshAuth) addr() string {
+	return fmt.Sprintf("%s:%d", a.Host, a.Port)
+}
+
+// dialSSH 建立ssh连接，连接过程受ctx控制
+func dialSSH(ctx context.Context, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 握手阶段同样需要响应ctx取消
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
-	addr := fmt.Sprintf("%s:%d", auth.Host, auth.Port)
+	return ssh.NewClient(c, chans, reqs), nil
+}
 
-	return ssh.Dial("tcp", addr, cfg)
+// resolveSSHAuth 根据认证类型获取节点的ssh认证信息
+func (t *TemplateBashTool) resolveSSHAuth(node string) (*sshAuth, error) {
+	auth, err := t.resolveNodeAuth(node)
+	if err != nil {
+		return nil, err
+	}
+	auth.KnownHostsFile = t.config.AuthConfig.KnownHostsFile
+	auth.HostKeyPolicy = t.config.AuthConfig.HostKeyPolicy
+	return auth, nil
 }
 
-func parseSSHAuth(m map[string]string) (*sshAuth, error) {
+func (t *TemplateBashTool) resolveNodeAuth(node string) (*sshAuth, error) {
+	authConfig := t.config.AuthConfig
+	switch authConfig.GetType() {
+	case AuthTypeGlobal:
+		auth, err := parseSSHAuth(authConfig.GlobalAuth)
+		if err != nil {
+			return nil, err
+		}
+		// 全局认证时node即为目标主机
+		if node != "" {
+			auth.Host = node
+		}
+		if auth.Host == "" {
+			return nil, errors.New("node is required")
+		}
+		return auth, nil
+	case AuthTypePerNode:
+		raw, ok := authConfig.NodeAuths[node]
+		if !ok {
+			return nil, fmt.Errorf("node auth not found: %s", node)
+		}
+		return parseSSHAuth(raw)
+	}
+
+	return nil, fmt.Errorf("auth type %s does not support ssh", authConfig.GetType())
+}
+
+// parseSSHAuth 解析认证信息，配置值中的凭据引用在调用时才会解析
+func parseSSHAuth(raw map[string]string) (*sshAuth, error) {
+	m, err := secret.ResolveAll(raw)
+	if err != nil {
+		return nil, err
+	}
+	// 明文配置的密码同样不能出现在输出中
+	secret.Register(m[authPassword])
+
 	port := defaultSSHPort
 	if m[authSSHPort] != "" {
 		p, err := strconv.Atoi(m[authSSHPort])
@@ -158,6 +283,8 @@ func parseSSHAuth(m map[string]string) (*sshAuth, error) {
 		KeyPath:  m[authKeyPath],
 		Host:     m[authHost],
 		Port:     port,
+
+		HostKeyFingerprint: m[authHostKeyFingerprint],
 	}, nil
 }
 
@@ -182,32 +309,85 @@ func buildSSHConfig(a *sshAuth) (*ssh.ClientConfig, error) {
 		auths = append(auths, ssh.PublicKeys(signer))
 	}
 
+	callback, err := hostKeyCallback(a)
+	if err != nil {
+		return nil, err
+	}
+
 	return &ssh.ClientConfig{
 		User:            a.User,
 		Auth:            auths,
 		Timeout:         30 * time.Second,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // 可后续替换
+		HostKeyCallback: callback,
 	}, nil
 }
 
 func (t *TemplateBashTool) executeCommandOnNode(ctx context.Context, cmd string, node string) (string, error) {
-	client, err := t.getSSHClient(ctx, node)
+	auth, err := t.resolveSSHAuth(node)
 	if err != nil {
 		return "", err
 	}
-	defer client.Close()
 
-	session, err := client.NewSession()
+	if t.pool == nil {
+		client, err := t.getSSHClient(ctx, auth)
+		if err != nil {
+			return "", err
+		}
+		defer client.Close()
+		return t.runSession(ctx, client, cmd)
+	}
+
+	// 连接以用户和地址区分，同一节点的多个模板共用连接
+	lease, err := t.pool.Acquire(ctx, auth.User+"@"+auth.addr(), func(ctx context.Context) (*ssh.Client, error) {
+		return t.getSSHClient(ctx, auth)
+	})
 	if err != nil {
 		return "", err
 	}
+
+	out, err := t.runSession(ctx, lease.Client, cmd)
+	if errors.Is(err, errSessionFailed) {
+		// 会话无法建立时连接已不可用，不再复用
+		// 命令超时或被取消时会话已经关闭，连接仍由同一节点的其他会话使用
+		lease.Discard()
+	} else {
+		lease.Release()
+	}
+	return out, err
+}
+
+// errSessionFailed 连接上无法创建新的会话，通常说明连接已断开
+var errSessionFailed = errors.New("ssh: failed to open session")
+
+func (t *TemplateBashTool) runSession(ctx context.Context, client *ssh.Client, cmd string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errSessionFailed, err)
+	}
 	defer session.Close()
 
-	var stdout, stderr strings.Builder
+	var stdout, stderr syncBuffer
 	session.Stdout = &stdout
 	session.Stderr = &stderr
 
-	if err := session.Run(cmd); err != nil {
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(cmd)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// 超时或取消后终止远端命令，超时时返回已经产生的输出
+		_ = session.Signal(ssh.SIGKILL)
+		_ = session.Close()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", &TimeoutError{Tool: t.templateName, Output: partialOutput(&stdout, &stderr)}
+		}
+		return "", fmt.Errorf("%s canceled: %w", t.templateName, ctx.Err())
+	}
+
+	if err != nil {
 		return "", err
 	}
 
@@ -217,3 +397,13 @@ func (t *TemplateBashTool) executeCommandOnNode(ctx context.Context, cmd string,
 
 	return stdout.String(), nil
 }
+
+// CheckApproval 实现 ApprovalChecker
+func (t *TemplateBashTool) CheckApproval(ctx context.Context, argumentsInJSON string) (*Approval, error) {
+	return checkApproval(t.templateName, t.execTemplate, t.policy, t.approval, argumentsInJSON)
+}
+
+// OutputLimit 实现 OutputLimiter
+func (t *TemplateBashTool) OutputLimit() OutputLimit {
+	return t.config.GetOutputLimit(t.execTemplate)
+}
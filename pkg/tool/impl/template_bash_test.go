@@ -0,0 +1,111 @@
+package impl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBashTool(t *testing.T, auth *AuthConfig, exec string) *TemplateBashTool {
+	t.Helper()
+	cfg := &ToolConfig{
+		ToolName:   "bash",
+		AuthConfig: auth,
+		ExecTemplates: []ExecTemplate{
+			{Name: "echo", Description: "回显", Exec: exec},
+		},
+	}
+	bt, err := NewTemplateBashTool(cfg, "echo", nil)
+	require.NoError(t, err)
+	return bt
+}
+
+func nodeParam(t *testing.T, bt *TemplateBashTool) (exists bool, required bool, desc string) {
+	t.Helper()
+	info, err := bt.Info(context.Background())
+	require.NoError(t, err)
+	js, err := info.ParamsOneOf.ToJSONSchema()
+	require.NoError(t, err)
+	prop, ok := js.Properties.Get(paramNode)
+	if !ok {
+		return false, false, ""
+	}
+	for _, r := range js.Required {
+		if r == paramNode {
+			required = true
+		}
+	}
+	return true, required, prop.Description
+}
+
+func TestBashToolNodeSchema(t *testing.T) {
+	exists, _, _ := nodeParam(t, newBashTool(t, &AuthConfig{Type: AuthTypeNone}, "echo hi"))
+	assert.False(t, exists)
+
+	exists, required, desc := nodeParam(t, newBashTool(t, &AuthConfig{
+		Type:       AuthTypeGlobal,
+		GlobalAuth: map[string]string{authUser: "root"},
+	}, "echo hi"))
+	assert.True(t, exists)
+	assert.True(t, required)
+	assert.Equal(t, AuthTypeDescriptions[AuthTypeGlobal], desc)
+
+	// 全局认证中已配置host时node可省略
+	_, required, _ = nodeParam(t, newBashTool(t, &AuthConfig{
+		Type:       AuthTypeGlobal,
+		GlobalAuth: map[string]string{authUser: "root", authHost: "10.0.0.1"},
+	}, "echo hi"))
+	assert.False(t, required)
+
+	exists, required, desc = nodeParam(t, newBashTool(t, &AuthConfig{
+		Type:      AuthTypePerNode,
+		NodeAuths: map[string]map[string]string{"worker": {}, "master": {}},
+	}, "echo hi"))
+	assert.True(t, exists)
+	assert.True(t, required)
+	assert.Contains(t, desc, AuthTypeDescriptions[AuthTypePerNode])
+	assert.Contains(t, desc, "master, worker")
+}
+
+func TestBashToolResolveSSHAuth(t *testing.T) {
+	bt := newBashTool(t, &AuthConfig{
+		Type:       AuthTypeGlobal,
+		GlobalAuth: map[string]string{authUser: "ops", authKeyPath: "/tmp/key", authSSHPort: "2222"},
+	}, "echo hi")
+	auth, err := bt.resolveSSHAuth("10.0.0.2")
+	require.NoError(t, err)
+	assert.Equal(t, &sshAuth{User: "ops", KeyPath: "/tmp/key", Host: "10.0.0.2", Port: 2222}, auth)
+
+	_, err = bt.resolveSSHAuth("")
+	assert.EqualError(t, err, "node is required")
+
+	bt = newBashTool(t, &AuthConfig{
+		Type:      AuthTypePerNode,
+		NodeAuths: map[string]map[string]string{"master": {authUser: "root", authHost: "192.168.1.1"}},
+	}, "echo hi")
+	auth, err = bt.resolveSSHAuth("master")
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.1.1", auth.Host)
+	assert.Equal(t, defaultSSHPort, auth.Port)
+
+	_, err = bt.resolveSSHAuth("worker")
+	assert.EqualError(t, err, "node auth not found: worker")
+}
+
+func TestBashToolAuthNoneRunsLocally(t *testing.T) {
+	bt := newBashTool(t, nil, "echo {{.msg}}")
+	out, err := bt.InvokableRun(context.Background(), `{"msg": "local"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "local\n", out)
+}
+
+func TestBashToolUnknownAuthType(t *testing.T) {
+	_, err := NewTemplateBashTool(&ToolConfig{
+		ToolName:      "bash",
+		AuthConfig:    &AuthConfig{Type: "kerberos"},
+		ExecTemplates: []ExecTemplate{{Name: "echo", Exec: "echo"}},
+	}, "echo", nil)
+	assert.Error(t, err)
+}
